@@ -0,0 +1,378 @@
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/storage"
+	"go-chat-app/pkg/tracing"
+	"io"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	manifestKey     = "manifest.json"
+	manifestVersion = 1
+)
+
+// Chunk describes one compressed JSON lines file holding the messages of a
+// single room sent within [WindowStart, WindowEnd).
+type Chunk struct {
+	Key         string    `json:"key"`
+	Room        string    `json:"room"`
+	WindowStart time.Time `json:"window_start"`
+	WindowEnd   time.Time `json:"window_end"`
+	Count       int       `json:"count"`
+	// SHA256 is the checksum of the compressed file.
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c Chunk) overlaps(start, end time.Time) bool {
+	return c.WindowStart.Before(end) && start.Before(c.WindowEnd)
+}
+
+// mayHold reports whether the chunk may hold messages matching filter.
+func (c Chunk) mayHold(filter repositories.MessageFilter) bool {
+	if len(filter.Rooms) > 0 && !slices.Contains(filter.Rooms, c.Room) || slices.Contains(filter.ExcludeRooms, c.Room) {
+		return false
+	}
+	return (filter.After.IsZero() || filter.After.Before(c.WindowEnd)) &&
+		(filter.Before.IsZero() || c.WindowStart.Before(filter.Before))
+}
+
+// Manifest lists every chunk of the archive. A chunk only counts as archived
+// once the manifest that lists it has been written.
+type Manifest struct {
+	Version int     `json:"version"`
+	Chunks  []Chunk `json:"chunks"`
+}
+
+// Archive stores chat history as gzip-compressed JSON lines chunks on a blob
+// store. Writes are serialized within the process; only one process should
+// write to the same archive.
+type Archive struct {
+	blob storage.Blob
+	mu   sync.Mutex
+}
+
+func New(blob storage.Blob) *Archive {
+	return &Archive{blob: blob}
+}
+
+func (a *Archive) Manifest(ctx context.Context) (Manifest, error) {
+	r, err := a.blob.Get(ctx, manifestKey)
+	if errors.Is(err, storage.ErrNotExist) {
+		return Manifest{Version: manifestVersion}, nil
+	}
+	if err != nil {
+		return Manifest{}, err
+	}
+	defer r.Close()
+
+	var m Manifest
+	if err := json.NewDecoder(r).Decode(&m); err != nil {
+		return Manifest{}, fmt.Errorf("archive: invalid manifest: %w", err)
+	}
+	if m.Version != manifestVersion {
+		return Manifest{}, fmt.Errorf("archive: unsupported manifest version %d", m.Version)
+	}
+	return m, nil
+}
+
+// Append writes one chunk per room for the messages of a window and then
+// records them in the manifest.
+func (a *Archive) Append(ctx context.Context, start, end time.Time, msgs []models.MessagePayload) ([]Chunk, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	m, err := a.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	byRoom := make(map[string][]models.MessagePayload)
+	for _, msg := range msgs {
+		byRoom[msg.Room] = append(byRoom[msg.Room], msg)
+	}
+
+	var chunks []Chunk
+	for _, room := range sortedKeys(byRoom) {
+		chunk, err := a.writeChunk(ctx, room, start, end, byRoom[room])
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	m.Chunks = append(m.Chunks, chunks...)
+	return chunks, a.putManifest(ctx, m)
+}
+
+func (a *Archive) putManifest(ctx context.Context, m Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.blob.Put(ctx, manifestKey, bytes.NewReader(data))
+}
+
+// Prune deletes the archived messages matching filter and returns how many
+// it deleted.
+func (a *Archive) Prune(ctx context.Context, filter repositories.MessageFilter) (int64, error) {
+	span, ctx := tracing.StartSpan(ctx, "PruneArchive", "archive")
+	defer span.End()
+
+	deleted, err := a.rewrite(ctx, func(chunk Chunk) bool { return chunk.mayHold(filter) }, filter.Match)
+	span.RecordError(err)
+	return deleted, err
+}
+
+// DeleteMessage deletes the archived message with the id. It returns
+// repositories.ErrNotFound when there is none.
+func (a *Archive) DeleteMessage(ctx context.Context, id string) error {
+	span, ctx := tracing.StartSpan(ctx, "DeleteArchivedMessage", "archive")
+	defer span.End()
+
+	deleted, err := a.rewrite(ctx, func(Chunk) bool { return true }, func(msg models.MessagePayload) bool {
+		return msg.Id == id
+	})
+	if err == nil && deleted == 0 {
+		err = repositories.ErrNotFound
+	}
+	return err
+}
+
+// Message returns the archived message with the id, or
+// repositories.ErrNotFound.
+func (a *Archive) Message(ctx context.Context, id string) (models.MessagePayload, error) {
+	m, err := a.Manifest(ctx)
+	if err != nil {
+		return models.MessagePayload{}, err
+	}
+	for _, chunk := range m.Chunks {
+		msgs, err := a.readChunk(ctx, chunk)
+		if err != nil {
+			return models.MessagePayload{}, err
+		}
+		if i := slices.IndexFunc(msgs, func(msg models.MessagePayload) bool { return msg.Id == id }); i >= 0 {
+			return msgs[i], nil
+		}
+	}
+	return models.MessagePayload{}, repositories.ErrNotFound
+}
+
+// rewrite drops the messages for which drop reports true from the chunks
+// for which candidate does. A chunk that lost messages is replaced by a new
+// one holding the rest, or by none when it is empty. The old chunks are
+// deleted once the manifest no longer lists them.
+func (a *Archive) rewrite(ctx context.Context, candidate func(Chunk) bool, drop func(models.MessagePayload) bool) (int64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	m, err := a.Manifest(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	var stale []string
+	chunks := make([]Chunk, 0, len(m.Chunks))
+	for _, chunk := range m.Chunks {
+		if !candidate(chunk) {
+			chunks = append(chunks, chunk)
+			continue
+		}
+		msgs, err := a.readChunk(ctx, chunk)
+		if err != nil {
+			return 0, err
+		}
+		kept := slices.DeleteFunc(slices.Clone(msgs), drop)
+		if len(kept) == len(msgs) {
+			chunks = append(chunks, chunk)
+			continue
+		}
+		deleted += int64(len(msgs) - len(kept))
+		stale = append(stale, chunk.Key)
+		if len(kept) == 0 {
+			continue
+		}
+		replacement, err := a.writeChunk(ctx, chunk.Room, chunk.WindowStart, chunk.WindowEnd, kept)
+		if err != nil {
+			return 0, err
+		}
+		chunks = append(chunks, replacement)
+	}
+	if deleted == 0 {
+		return 0, nil
+	}
+
+	m.Chunks = chunks
+	if err := a.putManifest(ctx, m); err != nil {
+		return 0, err
+	}
+	for _, key := range stale {
+		if err := a.blob.Delete(ctx, key); err != nil {
+			slog.WarnContext(ctx, "failed to delete a replaced archive chunk", "key", key, "error", err)
+		}
+	}
+	return deleted, nil
+}
+
+func (a *Archive) writeChunk(ctx context.Context, room string, start, end time.Time, msgs []models.MessagePayload) (Chunk, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	enc := json.NewEncoder(zw)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg); err != nil {
+			return Chunk{}, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return Chunk{}, err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	chunk := Chunk{
+		Key:         fmt.Sprintf("chunks/%s/%s.jsonl.gz", start.UTC().Format("2006/01/02"), uuid.NewString()),
+		Room:        room,
+		WindowStart: start.UTC(),
+		WindowEnd:   end.UTC(),
+		Count:       len(msgs),
+		SHA256:      hex.EncodeToString(sum[:]),
+		CreatedAt:   time.Now().UTC(),
+	}
+	return chunk, a.blob.Put(ctx, chunk.Key, &buf)
+}
+
+// Messages returns the newest limit archived messages of a room sent
+// strictly before before, oldest first. A zero before means no upper bound.
+func (a *Archive) Messages(ctx context.Context, room string, before time.Time, limit int) ([]models.MessagePayload, error) {
+	span, ctx := tracing.StartSpan(ctx, "ReadArchive", "archive")
+	defer span.End()
+
+	m, err := a.Manifest(ctx)
+	if err != nil {
+		span.RecordError(err)
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for _, chunk := range m.Chunks {
+		if chunk.Room == room && (before.IsZero() || chunk.WindowStart.Before(before)) {
+			chunks = append(chunks, chunk)
+		}
+	}
+	// Newest windows first, so once the page is full the remaining chunks
+	// can be skipped without reading them. Windows of the same day may
+	// overlap, hence no early break.
+	sort.SliceStable(chunks, func(i, j int) bool {
+		return chunks[i].WindowStart.After(chunks[j].WindowStart)
+	})
+
+	var msgs []models.MessagePayload
+	for _, chunk := range chunks {
+		if len(msgs) >= limit && !chunk.WindowEnd.After(msgs[0].Date) {
+			continue
+		}
+		chunkMsgs, err := a.readChunk(ctx, chunk)
+		if err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+		for _, msg := range chunkMsgs {
+			if before.IsZero() || msg.Date.Before(before) {
+				msgs = append(msgs, msg)
+			}
+		}
+		sortByDate(msgs)
+		if len(msgs) > limit {
+			msgs = msgs[len(msgs)-limit:]
+		}
+	}
+	return msgs, nil
+}
+
+// All returns every archived message of every room, oldest first.
+func (a *Archive) All(ctx context.Context) ([]models.MessagePayload, error) {
+	m, err := a.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var msgs []models.MessagePayload
+	for _, chunk := range m.Chunks {
+		chunkMsgs, err := a.readChunk(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, chunkMsgs...)
+	}
+	sortByDate(msgs)
+	return msgs, nil
+}
+
+func (a *Archive) readChunk(ctx context.Context, chunk Chunk) ([]models.MessagePayload, error) {
+	r, err := a.blob.Get(ctx, chunk.Key)
+	if err != nil {
+		return nil, fmt.Errorf("archive: chunk %s: %w", chunk.Key, err)
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != chunk.SHA256 {
+		return nil, fmt.Errorf("archive: chunk %s is corrupt, checksum mismatch", chunk.Key)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("archive: chunk %s: %w", chunk.Key, err)
+	}
+	defer zr.Close()
+
+	msgs := make([]models.MessagePayload, 0, chunk.Count)
+	dec := json.NewDecoder(zr)
+	for {
+		var msg models.MessagePayload
+		err := dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("archive: chunk %s: %w", chunk.Key, err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func sortByDate(msgs []models.MessagePayload) {
+	sort.SliceStable(msgs, func(i, j int) bool {
+		return msgs[i].Date.Before(msgs[j].Date)
+	})
+}
+
+func sortedKeys(m map[string][]models.MessagePayload) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
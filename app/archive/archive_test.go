@@ -0,0 +1,232 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/storage"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// seed inserts one message per hour over the last n hours into room.
+func seed(t *testing.T, messages repositories.MessageRepository, room string, n int) {
+	t.Helper()
+	for i := n; i > 0; i-- {
+		msg := models.MessagePayload{Room: room, From: "alice01", Message: fmt.Sprintf("%s -%dh", room, i), Date: now.Add(-time.Duration(i) * time.Hour)}
+		if err := messages.InsertNewMessage(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func newArchiver(messages repositories.MessageRepository, archive *Archive) *Archiver {
+	archiver := NewArchiver(messages, archive, 24*time.Hour)
+	archiver.now = func() time.Time { return now }
+	return archiver
+}
+
+func TestArchiverMovesOldMessages(t *testing.T) {
+	ctx := context.Background()
+	messages := repositories.NewMemoryMessageRepository()
+	seed(t, messages, "ops", 72)
+	seed(t, messages, "", 30)
+	archive := New(storage.NewMemoryBlob())
+
+	moved, err := newArchiver(messages, archive).RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if moved != 48+6 {
+		t.Errorf("moved %d messages, want %d", moved, 48+6)
+	}
+
+	hot, _ := messages.GetAllMessage(ctx)
+	for _, msg := range hot {
+		if msg.Date.Before(now.Add(-24 * time.Hour)) {
+			t.Errorf("message %q older than the threshold is still in the store", msg.Message)
+		}
+	}
+
+	m, err := archive.Manifest(ctx)
+	if err != nil {
+		t.Fatalf("Manifest: %v", err)
+	}
+	count := 0
+	for _, chunk := range m.Chunks {
+		count += chunk.Count
+	}
+	if count != int(moved) {
+		t.Errorf("manifest lists %d messages, want %d", count, moved)
+	}
+
+	if again, err := newArchiver(messages, archive).RunOnce(ctx); err != nil || again != 0 {
+		t.Errorf("second run moved %d messages, err %v", again, err)
+	}
+}
+
+func TestHistoryReadsThroughToArchive(t *testing.T) {
+	ctx := context.Background()
+	hot := repositories.NewMemoryMessageRepository()
+	seed(t, hot, "ops", 72)
+	archive := New(storage.NewMemoryBlob())
+	if _, err := newArchiver(hot, archive).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	repo := NewMessageRepository(hot, archive, false)
+	var pages [][]models.MessagePayload
+	query := repositories.MessageQuery{Room: "ops", Limit: 20}
+	for {
+		page, err := repo.GetMessages(ctx, query)
+		if err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+		if len(page) == 0 {
+			break
+		}
+		pages = append(pages, page)
+		query.Before = page[0].Date
+	}
+
+	var all []string
+	for i := len(pages) - 1; i >= 0; i-- {
+		for _, msg := range pages[i] {
+			all = append(all, msg.Message)
+		}
+	}
+	if len(all) != 72 || all[0] != "ops -72h" || all[71] != "ops -1h" {
+		t.Fatalf("paged history has %d messages from %q to %q", len(all), all[0], all[len(all)-1])
+	}
+	if len(pages[1]) != 20 || pages[1][len(pages[1])-1].Message != "ops -21h" {
+		t.Errorf("page crossing the hot window = %v ... %v", pages[1][0].Message, pages[1][len(pages[1])-1].Message)
+	}
+
+	everything, err := repo.GetAllMessage(ctx)
+	if err != nil {
+		t.Fatalf("GetAllMessage: %v", err)
+	}
+	if len(everything) != 72 {
+		t.Errorf("GetAllMessage returned %d messages, want 72", len(everything))
+	}
+}
+
+func TestDeletesReachTheArchive(t *testing.T) {
+	ctx := context.Background()
+	hot := repositories.NewMemoryMessageRepository()
+	seed(t, hot, "ops", 72)
+	seed(t, hot, "", 72)
+	archive := New(storage.NewMemoryBlob())
+	repo := NewMessageRepository(hot, archive, true)
+	// The archiver is handed the wrapped repository, as in production, and
+	// must not prune what it just archived.
+	if _, err := newArchiver(repo, archive).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+
+	// Delete in batches, as retention does, everything in ops older than 60h.
+	filter := repositories.MessageFilter{Rooms: []string{"ops"}, Before: now.Add(-60 * time.Hour)}
+	var deleted int64
+	for {
+		n, err := repo.DeleteMessages(ctx, filter, 5)
+		if err != nil {
+			t.Fatalf("DeleteMessages: %v", err)
+		}
+		deleted += n
+		if n < 5 {
+			break
+		}
+	}
+	if deleted != 12 {
+		t.Errorf("deleted %d messages, want 12", deleted)
+	}
+	all, _ := repo.GetAllMessage(ctx)
+	if len(all) != 144-12 {
+		t.Errorf("%d messages left, want %d", len(all), 144-12)
+	}
+	for _, msg := range all {
+		if filter.Match(msg) {
+			t.Errorf("message %q survived the delete", msg.Message)
+		}
+	}
+	m, _ := archive.Manifest(ctx)
+	count := 0
+	for _, chunk := range m.Chunks {
+		count += chunk.Count
+	}
+	if count != 144-12-2*24 {
+		t.Errorf("manifest lists %d messages, want %d", count, 144-12-2*24)
+	}
+
+	archived := all[0]
+	if got, err := repo.GetMessage(ctx, archived.Id); err != nil || got.Message != archived.Message {
+		t.Errorf("GetMessage of an archived message = %+v, %v", got, err)
+	}
+	readOnly := NewMessageRepository(hot, archive, false)
+	if err := readOnly.DeleteMessage(ctx, archived.Id); !errors.Is(err, repositories.ErrReadOnly) {
+		t.Errorf("DeleteMessage outside the writer returned %v, want ErrReadOnly", err)
+	}
+	if err := repo.DeleteMessage(ctx, archived.Id); err != nil {
+		t.Fatalf("DeleteMessage of an archived message: %v", err)
+	}
+	if err := repo.DeleteMessage(ctx, archived.Id); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("second DeleteMessage returned %v, want ErrNotFound", err)
+	}
+	if _, err := repo.GetMessage(ctx, archived.Id); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("GetMessage of a deleted message returned %v, want ErrNotFound", err)
+	}
+	if err := readOnly.DeleteMessage(ctx, archived.Id); !errors.Is(err, repositories.ErrNotFound) {
+		t.Errorf("DeleteMessage of a deleted message outside the writer returned %v, want ErrNotFound", err)
+	}
+}
+
+func TestArchiverSkipsAlreadyArchivedMessages(t *testing.T) {
+	ctx := context.Background()
+	messages := repositories.NewMemoryMessageRepository()
+	seed(t, messages, "ops", 30)
+	archive := New(storage.NewMemoryBlob())
+
+	// Simulate a run that wrote its chunk but died before deleting.
+	start := now.Add(-30 * time.Hour).Truncate(window)
+	end := now.Add(-24 * time.Hour)
+	leftover, _ := messages.FindMessages(ctx, repositories.MessageFilter{After: start, Before: end}, 0)
+	if _, err := archive.Append(ctx, start, end, leftover); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	if _, err := newArchiver(messages, archive).RunOnce(ctx); err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	archived, _ := archive.All(ctx)
+	texts := make([]string, 0, len(archived))
+	for _, msg := range archived {
+		texts = append(texts, msg.Message)
+	}
+	if len(texts) != 6 || len(slices.Compact(slices.Clone(texts))) != 6 {
+		t.Errorf("archive holds %v, want six distinct messages", texts)
+	}
+}
+
+func TestCorruptChunk(t *testing.T) {
+	ctx := context.Background()
+	blob := storage.NewMemoryBlob()
+	archive := New(blob)
+	msgs := []models.MessagePayload{{Room: "ops", From: "alice01", Message: "hello", Date: now}}
+	chunks, err := archive.Append(ctx, now.Truncate(window), now.Add(time.Hour), msgs)
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if err := blob.Put(ctx, chunks[0].Key, strings.NewReader("not gzip")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := archive.Messages(ctx, "ops", time.Time{}, 10); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("Messages on a corrupt chunk: err = %v", err)
+	}
+}
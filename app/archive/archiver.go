@@ -0,0 +1,146 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"time"
+)
+
+const window = 24 * time.Hour
+
+// Archiver moves messages older than a threshold from the message store into
+// the archive, one UTC day at a time. A day is deleted from the store only
+// after its chunks are listed in the manifest.
+type Archiver struct {
+	messages repositories.MessageRepository
+	archive  *Archive
+	after    time.Duration
+	now      func() time.Time
+}
+
+func NewArchiver(messages repositories.MessageRepository, archive *Archive, after time.Duration) *Archiver {
+	return &Archiver{messages: Store(messages), archive: archive, after: after, now: time.Now}
+}
+
+// Run archives every interval until ctx is cancelled.
+func (a *Archiver) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.RunOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "archive run failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce archives every message older than the threshold and returns how
+// many were moved.
+func (a *Archiver) RunOnce(ctx context.Context) (int64, error) {
+	tx, ctx := tracing.StartTransaction(ctx, "Archive", "job")
+	defer tx.End()
+
+	cutoff := a.now().Add(-a.after)
+	var total int64
+	for {
+		oldest, err := a.messages.FindMessages(ctx, repositories.MessageFilter{Before: cutoff}, 1)
+		if err != nil {
+			tx.RecordError(err)
+			return total, err
+		}
+		if len(oldest) == 0 {
+			return total, nil
+		}
+
+		start := oldest[0].Date.UTC().Truncate(window)
+		end := start.Add(window)
+		if end.After(cutoff) {
+			end = cutoff
+		}
+		moved, err := a.archiveWindow(ctx, start, end)
+		total += moved
+		if err == nil && moved == 0 {
+			err = fmt.Errorf("archive: window starting %s made no progress", start.Format(time.RFC3339))
+		}
+		if err != nil {
+			tx.RecordError(err)
+			return total, err
+		}
+	}
+}
+
+func (a *Archiver) archiveWindow(ctx context.Context, start, end time.Time) (int64, error) {
+	filter := repositories.MessageFilter{After: start, Before: end}
+	msgs, err := a.messages.FindMessages(ctx, filter, 0)
+	if err != nil {
+		return 0, err
+	}
+	pending, err := a.unarchived(ctx, start, end, msgs)
+	if err != nil {
+		return 0, err
+	}
+
+	var chunks []Chunk
+	if len(pending) > 0 {
+		chunks, err = a.archive.Append(ctx, start, end, pending)
+		if err != nil {
+			return 0, err
+		}
+	}
+	deleted, err := a.messages.DeleteMessages(ctx, filter, 0)
+
+	args := []any{"window_start", start, "window_end", end, "archived", len(pending), "chunks", len(chunks), "deleted", deleted}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logger.Audit(ctx, "messages archived", args...)
+	return deleted, err
+}
+
+// unarchived drops messages that an earlier, interrupted run already wrote
+// to a chunk but did not delete from the store.
+func (a *Archiver) unarchived(ctx context.Context, start, end time.Time, msgs []models.MessagePayload) ([]models.MessagePayload, error) {
+	m, err := a.archive.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	archived := make(map[string]bool)
+	for _, chunk := range m.Chunks {
+		if !chunk.overlaps(start, end) {
+			continue
+		}
+		chunkMsgs, err := a.archive.readChunk(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		for _, msg := range chunkMsgs {
+			archived[messageKey(msg)] = true
+		}
+	}
+	if len(archived) == 0 {
+		return msgs, nil
+	}
+
+	pending := make([]models.MessagePayload, 0, len(msgs))
+	for _, msg := range msgs {
+		if !archived[messageKey(msg)] {
+			pending = append(pending, msg)
+		}
+	}
+	return pending, nil
+}
+
+func messageKey(msg models.MessagePayload) string {
+	return msg.Room + "\x00" + msg.From + "\x00" + msg.Message + "\x00" + msg.Date.UTC().Format(time.RFC3339Nano)
+}
@@ -0,0 +1,101 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+)
+
+type messageRepository struct {
+	repositories.MessageRepository
+	archive *Archive
+	// writer is set in the single process that writes the archive.
+	writer bool
+}
+
+// NewMessageRepository serves history from the message store and continues
+// from the archive once a page reaches past the messages still in the store.
+// Deletes also remove archived messages, but only in the archive's writer,
+// the process running the archive job; elsewhere they only touch the store.
+// Other writes and bulk operations only touch the store.
+func NewMessageRepository(messages repositories.MessageRepository, archive *Archive, writer bool) repositories.MessageRepository {
+	return &messageRepository{MessageRepository: messages, archive: archive, writer: writer}
+}
+
+// Store returns the message store behind messages, bypassing the archive.
+// The archiver moves messages with it, so that deleting them from the store
+// does not delete the chunks just written.
+func Store(messages repositories.MessageRepository) repositories.MessageRepository {
+	if r, ok := messages.(*messageRepository); ok {
+		return r.MessageRepository
+	}
+	return messages
+}
+
+func (r *messageRepository) GetMessages(ctx context.Context, query repositories.MessageQuery) ([]models.MessagePayload, error) {
+	query = query.Normalize()
+	hot, err := r.MessageRepository.GetMessages(ctx, query)
+	if err != nil || len(hot) >= query.Limit {
+		return hot, err
+	}
+
+	before := query.Before
+	if len(hot) > 0 {
+		before = hot[0].Date
+	}
+	cold, err := r.archive.Messages(ctx, query.Room, before, query.Limit-len(hot))
+	if err != nil {
+		return nil, err
+	}
+	return append(cold, hot...), nil
+}
+
+func (r *messageRepository) GetAllMessage(ctx context.Context) ([]models.MessagePayload, error) {
+	cold, err := r.archive.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hot, err := r.MessageRepository.GetAllMessage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return append(cold, hot...), nil
+}
+
+// DeleteMessages prunes the archive once the store holds no more matching
+// messages, in one pass regardless of limit.
+func (r *messageRepository) DeleteMessages(ctx context.Context, filter repositories.MessageFilter, limit int) (int64, error) {
+	deleted, err := r.MessageRepository.DeleteMessages(ctx, filter, limit)
+	if err != nil || !r.writer || (limit > 0 && deleted >= int64(limit)) {
+		return deleted, err
+	}
+	pruned, err := r.archive.Prune(ctx, filter)
+	return deleted + pruned, err
+}
+
+// GetMessage looks a message up in the store and then in the archive.
+func (r *messageRepository) GetMessage(ctx context.Context, id string) (models.MessagePayload, error) {
+	msg, err := r.MessageRepository.GetMessage(ctx, id)
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return msg, err
+	}
+	return r.archive.Message(ctx, id)
+}
+
+// DeleteMessage deletes a message from the store or, failing that, from the
+// archive. Outside the archive's writer an archived message is
+// repositories.ErrReadOnly.
+func (r *messageRepository) DeleteMessage(ctx context.Context, id string) error {
+	err := r.MessageRepository.DeleteMessage(ctx, id)
+	if !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	if r.writer {
+		return r.archive.DeleteMessage(ctx, id)
+	}
+	if _, err := r.archive.Message(ctx, id); err != nil {
+		return err
+	}
+	return repositories.ErrReadOnly
+}
@@ -0,0 +1,337 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/mailer"
+	"go-chat-app/pkg/response"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// mailTimeout bounds the delivery of a mail sent after the response.
+const mailTimeout = time.Minute
+
+// AccountMail configures the verification and password reset mails. Links
+// lead to the login page at BaseURL, which passes the token on to the API.
+type AccountMail struct {
+	Sender          mailer.Sender
+	BaseURL         string
+	VerificationTTL time.Duration
+	ResetTTL        time.Duration
+}
+
+// UpdateEmail sets the caller's email address and mails a verification link
+// to it. As the address can reset the password, an access token alone is not
+// enough: the caller also gives the current password or a second factor.
+func (u *UserController) UpdateEmail(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "UpdateEmail", "controller")
+	defer span.End()
+
+	req := new(models.EmailChangeRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+	user, ok := u.currentUser(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if !u.reauthenticate(spanCtx, ctx, user, *req) {
+		return nil
+	}
+
+	email := normalizeEmail(req.Email)
+	err := u.users.UpdateEmail(spanCtx, user.Username, &email)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Email already registered", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to update email", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to update email", nil)
+	}
+	logger.Audit(spanCtx, "email changed", "username", user.Username, "ip", ctx.IP())
+
+	user.Email = &email
+	if err := u.sendVerification(spanCtx, user); err != nil {
+		slog.ErrorContext(spanCtx, "failed to send verification mail", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to send verification mail", nil)
+	}
+	return response.SendSuccessResponse(ctx, fiber.Map{"email": email, "email_verified": false})
+}
+
+// reauthenticate checks the current password, or the second factor of an
+// account with two-factor authentication, given in req. Failures count
+// towards the login lockout. Unless the check passes it answers the request
+// and returns false.
+func (u *UserController) reauthenticate(spanCtx context.Context, ctx *fiber.Ctx, user models.User, req models.EmailChangeRequest) bool {
+	if !u.checkLockout(spanCtx, ctx, user.Username) {
+		return false
+	}
+
+	var valid bool
+	if req.CurrentPassword != "" {
+		passwordHash := user.Password
+		if passwordHash == "" {
+			passwordHash = dummyPasswordHash()
+		}
+		valid = bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(req.CurrentPassword)) == nil && user.Password != ""
+	} else if user.TwoFactorEnabled() {
+		var err error
+		valid, err = u.verifySecondFactor(spanCtx, user, models.TwoFactorRequest{Code: req.Code, RecoveryCode: req.RecoveryCode}, time.Now())
+		if err != nil {
+			slog.ErrorContext(spanCtx, "failed to verify second factor", "error", err)
+			_ = response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+			return false
+		}
+	}
+	if !valid {
+		slog.WarnContext(spanCtx, "reauthentication failed", "username", user.Username)
+		_ = u.loginFailed(spanCtx, ctx, user.Username, "Invalid credentials")
+		return false
+	}
+	if err := u.lockout.Succeed(spanCtx, user.Username); err != nil {
+		slog.ErrorContext(spanCtx, "failed to clear login failures", "error", err)
+	}
+	return true
+}
+
+// RequestEmailVerification mails a new verification link to the caller's
+// address. It replaces the links sent before.
+func (u *UserController) RequestEmailVerification(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "RequestEmailVerification", "controller")
+	defer span.End()
+
+	user, ok := u.currentUser(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if user.Email == nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "No email address set", nil)
+	}
+	if user.EmailVerified() {
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Email already verified", nil)
+	}
+	if err := u.sendVerification(spanCtx, user); err != nil {
+		slog.ErrorContext(spanCtx, "failed to send verification mail", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to send verification mail", nil)
+	}
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// VerifyEmail consumes the token from a verification mail. The token itself
+// is the proof, so no login is required.
+func (u *UserController) VerifyEmail(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "VerifyEmail", "controller")
+	defer span.End()
+
+	now := time.Now()
+	req := new(models.AccountTokenRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	token, err := u.tokens.UseAccountToken(spanCtx, models.TokenPurposeVerifyEmail, jwt.HashToken(req.Token), now)
+	if err == nil {
+		// The address may have changed since the mail was sent.
+		err = u.users.VerifyEmail(spanCtx, token.UserId, token.Email, now)
+	}
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid or expired token", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to verify email", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to verify email", nil)
+	}
+	return response.SendSuccessResponse(ctx, fiber.Map{"email": token.Email, "email_verified": true})
+}
+
+// RequestPasswordReset mails a reset link to the verified address given. The
+// response is the same, and sent before any lookup, whether or not an
+// account has the address, so it reveals nothing about registered addresses.
+func (u *UserController) RequestPasswordReset(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "RequestPasswordReset", "controller")
+	defer span.End()
+
+	req := new(models.EmailRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	email, ip := normalizeEmail(req.Email), ctx.IP()
+	go func() {
+		mailCtx, cancel := context.WithTimeout(context.WithoutCancel(spanCtx), mailTimeout)
+		defer cancel()
+		if err := u.sendPasswordReset(mailCtx, email, ip); err != nil {
+			slog.ErrorContext(mailCtx, "failed to send password reset mail", "error", err)
+		}
+	}()
+	return response.SendSuccessResponse(ctx, fiber.Map{
+		"message": "If an account has this verified address, a reset link was sent to it",
+	})
+}
+
+// ResetPassword consumes the token from a reset mail and sets a new password.
+// Every session of the account is revoked, since whoever held the old
+// password may have logged in with it.
+func (u *UserController) ResetPassword(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "ResetPassword", "controller")
+	defer span.End()
+
+	req := new(models.AccountTokenRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+	if req.Password == "" {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", "password is required")
+	}
+
+	token, err := u.tokens.UseAccountToken(spanCtx, models.TokenPurposeResetPassword, jwt.HashToken(req.Token), time.Now())
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid or expired token", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to use reset token", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to reset password", nil)
+	}
+	user, err := u.users.GetUserById(spanCtx, token.UserId)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to reset password", nil)
+	}
+	// The link was mailed to the address the account had then; once the
+	// address has changed it must no longer work.
+	if user.Email == nil || *user.Email != token.Email {
+		logger.Audit(spanCtx, "password reset refused", "username", user.Username, "reason", "email changed", "ip", ctx.IP())
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid or expired token", nil)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to hash password", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to reset password", nil)
+	}
+	if err := u.users.UpdateUserPassword(spanCtx, user.Username, string(hash)); err != nil {
+		slog.ErrorContext(spanCtx, "failed to update password", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to reset password", nil)
+	}
+
+	sessions, err := u.sessions.GetUserSessions(spanCtx, user.Id)
+	if err == nil {
+		_, err = u.sessions.DeleteUserSessions(spanCtx, user.Id)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to revoke sessions after password reset", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Password was reset, but sessions could not be revoked", nil)
+	}
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.Id)
+	}
+	u.sockets.CloseSessions(ids...)
+	logger.Audit(spanCtx, "password reset", "username", user.Username, "sessions_revoked", len(ids), "ip", ctx.IP())
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// sendVerification mails a link that verifies the current address of user.
+func (u *UserController) sendVerification(spanCtx context.Context, user models.User) error {
+	token, err := u.newAccountToken(spanCtx, user, models.TokenPurposeVerifyEmail, u.mail.VerificationTTL)
+	if err != nil {
+		return err
+	}
+	return u.mail.Sender.Send(spanCtx, mailer.Message{
+		To:      *user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nopen this link to verify your email address:\n\n%s\n\nThe link expires in %s. If you did not add this address, ignore this mail.\n",
+			user.FullName, u.link("verify_token", token), formatTTL(u.mail.VerificationTTL)),
+	})
+}
+
+// sendPasswordReset mails a reset link to the account with the verified
+// address email, if there is one and it may log in.
+func (u *UserController) sendPasswordReset(ctx context.Context, email, ip string) error {
+	user, err := u.users.GetUserByEmail(ctx, email)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !user.EmailVerified() || user.Disabled() {
+		return nil
+	}
+
+	token, err := u.newAccountToken(ctx, user, models.TokenPurposeResetPassword, u.mail.ResetTTL)
+	if err != nil {
+		return err
+	}
+	logger.Audit(ctx, "password reset requested", "username", user.Username, "ip", ip)
+	return u.mail.Sender.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nopen this link to choose a new password for %s:\n\n%s\n\nThe link expires in %s and works once. If you did not ask for it, ignore this mail; your password stays the same.\n",
+			user.FullName, user.Username, u.link("reset_token", token), formatTTL(u.mail.ResetTTL)),
+	})
+}
+
+// newAccountToken stores the hash of a new token for user and returns the
+// token.
+func (u *UserController) newAccountToken(ctx context.Context, user models.User, purpose string, ttl time.Duration) (string, error) {
+	token := rand.Text()
+	err := u.tokens.CreateAccountToken(ctx, &models.AccountToken{
+		UserId:    user.Id,
+		Purpose:   purpose,
+		TokenHash: jwt.HashToken(token),
+		Email:     *user.Email,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	return token, err
+}
+
+func (u *UserController) link(param, token string) string {
+	return strings.TrimSuffix(u.mail.BaseURL, "/") + "/auth?" + url.Values{param: {token}}.Encode()
+}
+
+// formatTTL writes a link lifetime the way a person would.
+func formatTTL(d time.Duration) string {
+	switch {
+	case d == time.Hour:
+		return "1 hour"
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	default:
+		return fmt.Sprintf("%d minutes", (d+time.Minute-1)/time.Minute)
+	}
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
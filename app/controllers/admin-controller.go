@@ -0,0 +1,237 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"go-chat-app/app/moderation"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/response"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SocketHub is the WebSocket hub as the routes see it.
+type SocketHub interface {
+	SessionCloser
+	moderation.Notifier
+	// Connections counts the WebSockets open on this instance.
+	Connections() int
+	QueueDepth() int
+}
+
+// AdminController serves the admin API. Every route is restricted to admins
+// by the router.
+type AdminController struct {
+	users    repositories.UserRepository
+	sessions repositories.SessionRepository
+	messages repositories.MessageRepository
+	sockets  SocketHub
+	started  time.Time
+}
+
+func NewAdminController(users repositories.UserRepository, sessions repositories.SessionRepository,
+	messages repositories.MessageRepository, sockets SocketHub) *AdminController {
+	return &AdminController{users: users, sessions: sessions, messages: messages, sockets: sockets, started: time.Now()}
+}
+
+// ListUsers returns one page of the users, optionally only those matching
+// the search query parameter.
+func (a *AdminController) ListUsers(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "AdminListUsers", "controller")
+	defer span.End()
+
+	users, err := a.users.ListUsers(spanCtx, repositories.UserQuery{
+		Search: ctx.Query("search"),
+		Limit:  ctx.QueryInt("limit", repositories.DefaultUserLimit),
+		Offset: ctx.QueryInt("offset"),
+	})
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to list users", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to list users", nil)
+	}
+
+	resp := make([]models.UserResponse, 0, len(users))
+	for _, user := range users {
+		resp = append(resp, models.NewUserResponse(user))
+	}
+	return response.SendSuccessResponse(ctx, resp)
+}
+
+// DisableUser disables an account and logs it out everywhere.
+func (a *AdminController) DisableUser(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "AdminDisableUser", "controller")
+	defer span.End()
+
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	user, ok := a.user(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if user.Username == claims.Username {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "You cannot disable your own account", nil)
+	}
+
+	if err := a.users.SetUserDisabled(spanCtx, user.Username, true); err != nil {
+		slog.ErrorContext(spanCtx, "failed to disable user", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to disable user", nil)
+	}
+	revoked, err := a.logout(spanCtx, user)
+	if err != nil {
+		// The account is disabled either way, and the admin can retry to
+		// revoke the sessions.
+		slog.ErrorContext(spanCtx, "failed to revoke sessions of disabled user", "error", err)
+		logger.Audit(spanCtx, "user disabled", "username", user.Username, "by", claims.Username, "ip", ctx.IP(), "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "User disabled, but sessions could not be revoked", nil)
+	}
+	logger.Audit(spanCtx, "user disabled", "username", user.Username, "sessions_revoked", revoked,
+		"by", claims.Username, "ip", ctx.IP())
+	return response.SendSuccessResponse(ctx, fiber.Map{"disabled": true, "revoked": revoked})
+}
+
+// EnableUser re-enables a disabled account.
+func (a *AdminController) EnableUser(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "AdminEnableUser", "controller")
+	defer span.End()
+
+	user, ok := a.user(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if err := a.users.SetUserDisabled(spanCtx, user.Username, false); err != nil {
+		slog.ErrorContext(spanCtx, "failed to enable user", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to enable user", nil)
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	logger.Audit(spanCtx, "user enabled", "username", user.Username, "by", claims.Username, "ip", ctx.IP())
+	return response.SendSuccessResponse(ctx, fiber.Map{"disabled": false})
+}
+
+// LogoutUser revokes every session of a user and closes their WebSockets.
+// The account stays usable; the user can log in again.
+func (a *AdminController) LogoutUser(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "AdminLogoutUser", "controller")
+	defer span.End()
+
+	user, ok := a.user(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	revoked, err := a.logout(spanCtx, user)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to revoke user sessions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to revoke sessions", nil)
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	logger.Audit(spanCtx, "user logged out by admin", "username", user.Username, "sessions_revoked", revoked,
+		"by", claims.Username, "ip", ctx.IP())
+	return response.SendSuccessResponse(ctx, fiber.Map{"revoked": revoked})
+}
+
+// DeleteMessage deletes a message by the id the history API returned for it.
+func (a *AdminController) DeleteMessage(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "AdminDeleteMessage", "controller")
+	defer span.End()
+
+	id := ctx.Params("id")
+	err := a.messages.DeleteMessage(spanCtx, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Message not found", nil)
+	}
+	if errors.Is(err, repositories.ErrReadOnly) {
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Archived messages can only be deleted on the instance running the archive job", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to delete message", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to delete message", nil)
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	logger.Audit(spanCtx, "message deleted", "message_id", id, "by", claims.Username, "ip", ctx.IP())
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// Stats reports counts of users, sessions and messages, and the state of the
+// WebSocket hub of the instance that answers.
+func (a *AdminController) Stats(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "AdminStats", "controller")
+	defer span.End()
+
+	now := time.Now()
+	users, err := a.users.CountUsers(spanCtx)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to count users", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get stats", nil)
+	}
+	sessions, err := a.sessions.CountActiveSessions(spanCtx, now)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to count sessions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get stats", nil)
+	}
+	messages, err := a.messages.CountMessages(spanCtx, repositories.MessageFilter{})
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to count messages", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get stats", nil)
+	}
+	recent, err := a.messages.CountMessages(spanCtx, repositories.MessageFilter{After: now.Add(-24 * time.Hour)})
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to count messages", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get stats", nil)
+	}
+
+	return response.SendSuccessResponse(ctx, fiber.Map{
+		"users":           users,
+		"active_sessions": sessions,
+		"messages":        fiber.Map{"total": messages, "last_24h": recent},
+		"websocket": fiber.Map{
+			"connections":           a.sockets.Connections(),
+			"broadcast_queue_depth": a.sockets.QueueDepth(),
+		},
+		"uptime_seconds": int64(now.Sub(a.started).Seconds()),
+	})
+}
+
+// logout revokes every session of user and closes their WebSockets on this
+// instance.
+func (a *AdminController) logout(spanCtx context.Context, user models.User) (int64, error) {
+	sessions, err := a.sessions.GetUserSessions(spanCtx, user.Id)
+	if err != nil {
+		return 0, err
+	}
+	revoked, err := a.sessions.DeleteUserSessions(spanCtx, user.Id)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.Id)
+	}
+	a.sockets.CloseSessions(ids...)
+	return revoked, nil
+}
+
+// user loads the user named by the username route parameter. When it fails
+// it writes the error response and returns false.
+func (a *AdminController) user(spanCtx context.Context, ctx *fiber.Ctx) (models.User, bool) {
+	user, err := a.users.GetUserByUsername(spanCtx, ctx.Params("username"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		_ = response.SendFailureResponse(ctx, fiber.StatusNotFound, "User not found", nil)
+		return user, false
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user", "error", err)
+		_ = response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+		return user, false
+	}
+	return user, true
+}
@@ -0,0 +1,23 @@
+package controllers
+
+import (
+	"go-chat-app/pkg/health"
+	"go-chat-app/pkg/response"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const readinessTimeout = 2 * time.Second
+
+func Liveness(ctx *fiber.Ctx) error {
+	return response.SendSuccessResponse(ctx, fiber.Map{"status": health.StatusUp})
+}
+
+func Readiness(ctx *fiber.Ctx) error {
+	report := health.Check(ctx.Context(), readinessTimeout)
+	if report.Status != health.StatusUp {
+		return response.SendFailureResponse(ctx, fiber.StatusServiceUnavailable, "Service Unavailable", report)
+	}
+	return response.SendSuccessResponse(ctx, report)
+}
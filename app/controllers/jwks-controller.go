@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"go-chat-app/pkg/jwt"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// jwksMaxAge lets verifiers cache the key set. A new signing key should be
+// published as a verification key at least this long before it is used.
+const jwksMaxAge = "public, max-age=300"
+
+// JWKS serves the public keys tokens are signed with as a bare RFC 7517 key
+// set, without the response envelope, as JWT libraries expect.
+func JWKS(ctx *fiber.Ctx) error {
+	ctx.Set(fiber.HeaderCacheControl, jwksMaxAge)
+	return ctx.JSON(jwt.JWKS())
+}
@@ -1,21 +1,81 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
 	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/jwt"
 	"go-chat-app/pkg/response"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"slices"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.elastic.co/apm"
 )
 
-func GetMessagesHistory(ctx *fiber.Ctx) error {
+type MessageController struct {
+	messages  repositories.MessageRepository
+	users     repositories.UserRepository
+	sanctions repositories.SanctionRepository
+}
+
+func NewMessageController(messages repositories.MessageRepository, users repositories.UserRepository,
+	sanctions repositories.SanctionRepository) *MessageController {
+	return &MessageController{messages: messages, users: users, sanctions: sanctions}
+}
 
-	span, spanCtx := apm.StartSpan(ctx.Context(), "GetMessagesHistory", "controller")
+// GetMessagesHistory returns one page of a room's history, oldest first. Pass
+// the date of the first returned message as `before` to get the previous page.
+// Users banned from the room cannot read it, as they cannot join it.
+func (m *MessageController) GetMessagesHistory(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "GetMessagesHistory", "controller")
 	defer span.End()
 
-	resp, err := repositories.GetAllMessage(spanCtx)
+	query := repositories.MessageQuery{
+		Room:  ctx.Query("room"),
+		Limit: ctx.QueryInt("limit", repositories.DefaultMessageLimit),
+	}
+	if before := ctx.Query("before"); before != "" {
+		t, err := time.Parse(time.RFC3339Nano, before)
+		if err != nil {
+			slog.WarnContext(spanCtx, "invalid before parameter", "error", err)
+			return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid before parameter, expected RFC 3339", nil)
+		}
+		query.Before = t
+	}
+
+	banned, err := m.banned(spanCtx, ctx.Locals(ClaimsKey).(*jwt.ClaimToken), query.Room)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+	}
 	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get sanctions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal Server Error", nil)
+	}
+	if banned {
+		return response.SendFailureResponse(ctx, fiber.StatusForbidden, "You are banned from this room", nil)
+	}
+
+	resp, err := m.messages.GetMessages(spanCtx, query)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get messages", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal Server Error", nil)
 	}
 	return response.SendSuccessResponse(ctx, resp)
 }
+
+// banned reports whether the holder of claims is banned from room.
+func (m *MessageController) banned(spanCtx context.Context, claims *jwt.ClaimToken, room string) (bool, error) {
+	user, err := m.users.GetUserByUsername(spanCtx, claims.Username)
+	if err != nil {
+		return false, err
+	}
+	sanctions, err := m.sanctions.GetActiveSanctions(spanCtx, room, user.Id, time.Now())
+	if err != nil {
+		return false, err
+	}
+	return slices.ContainsFunc(sanctions, func(s models.Sanction) bool { return s.Kind == models.SanctionBan }), nil
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/oidc"
+	"go-chat-app/pkg/response"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// OIDCFlowCookie carries the state of a login flow from Login or Link
+	// to Callback. It is only sent to the OIDC endpoints.
+	OIDCFlowCookie = "oidc_flow"
+	oidcCookiePath = "/api/user/v1/oidc"
+
+	// createUserAttempts bounds the usernames tried for a new account
+	// before giving up.
+	createUserAttempts = 5
+	minUsernameLength  = 6
+	maxUsernameLength  = 20
+)
+
+// OIDCController signs users in through an OpenID Connect provider. Its
+// provider is nil when none is configured.
+type OIDCController struct {
+	provider   *oidc.Provider
+	autoCreate bool
+	users      *UserController
+}
+
+func NewOIDCController(provider *oidc.Provider, autoCreate bool, users *UserController) *OIDCController {
+	return &OIDCController{provider: provider, autoCreate: autoCreate, users: users}
+}
+
+// Enabled reports whether a provider is configured.
+func (o *OIDCController) Enabled() bool {
+	return o.provider != nil
+}
+
+// Provider tells the login page whether to offer single sign-on and under
+// which name.
+func (o *OIDCController) Provider(ctx *fiber.Ctx) error {
+	if !o.Enabled() {
+		return response.SendSuccessResponse(ctx, fiber.Map{"enabled": false})
+	}
+	return response.SendSuccessResponse(ctx, fiber.Map{"enabled": true, "name": o.provider.Name()})
+}
+
+// Login sends the browser to the provider.
+func (o *OIDCController) Login(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "OIDCLogin", "controller")
+	defer span.End()
+
+	authURL, cookie, err := o.provider.Start(spanCtx, "")
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to start oidc login", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusServiceUnavailable, "Single sign-on unavailable", nil)
+	}
+	o.setFlowCookie(ctx, cookie, time.Now().Add(oidc.FlowTimeout))
+	return ctx.Redirect(authURL, fiber.StatusFound)
+}
+
+// Link starts a flow that links the provider account the user signs in with
+// to the caller's account. It returns the URL to send the browser to.
+func (o *OIDCController) Link(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "OIDCLink", "controller")
+	defer span.End()
+
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	authURL, cookie, err := o.provider.Start(spanCtx, claims.Username)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to start oidc link", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusServiceUnavailable, "Single sign-on unavailable", nil)
+	}
+	o.setFlowCookie(ctx, cookie, time.Now().Add(oidc.FlowTimeout))
+	return response.SendSuccessResponse(ctx, fiber.Map{"url": authURL})
+}
+
+// Callback finishes a flow with the code the provider redirected back with.
+// A login flow logs in the user the identity is linked to, creating one if
+// allowed, exactly as LoginUser does after the password check. A link flow
+// links the identity to the account that started it.
+func (o *OIDCController) Callback(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "OIDCCallback", "controller")
+	defer span.End()
+
+	now := time.Now()
+	if reason := ctx.Query("error"); reason != "" {
+		slog.WarnContext(spanCtx, "oidc provider refused login", "error", reason, "description", ctx.Query("error_description"))
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Single sign-on failed", reason)
+	}
+
+	cookie := ctx.Cookies(OIDCFlowCookie)
+	o.setFlowCookie(ctx, "", time.Unix(0, 0))
+	identity, link, err := o.provider.Finish(spanCtx, cookie, ctx.Query("state"), ctx.Query("code"))
+	if errors.Is(err, oidc.ErrInvalidFlow) || errors.Is(err, oidc.ErrInvalidToken) {
+		slog.WarnContext(spanCtx, "oidc login rejected", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Single sign-on failed", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to finish oidc login", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusBadGateway, "Single sign-on failed", nil)
+	}
+
+	if link != "" {
+		return o.link(ctx, identity, link)
+	}
+
+	users := o.users.users
+	for attempt := 0; attempt < createUserAttempts; attempt++ {
+		user, err := users.GetUserByIdentity(spanCtx, identity.Issuer, identity.Subject)
+		if err == nil {
+			return o.users.completeLogin(spanCtx, ctx, user, now)
+		}
+		if !errors.Is(err, repositories.ErrNotFound) {
+			slog.ErrorContext(spanCtx, "failed to get user by identity", "error", err)
+			return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+		}
+		if !o.autoCreate {
+			slog.WarnContext(spanCtx, "oidc identity not linked", "issuer", identity.Issuer, "subject", identity.Subject)
+			return response.SendFailureResponse(ctx, fiber.StatusForbidden, "No account is linked to this identity", nil)
+		}
+
+		// The account has no password: its only way in is the provider,
+		// until an operator resets the password.
+		user = models.User{Username: username(identity, attempt), FullName: identity.Name}
+		if len(user.FullName) < minUsernameLength {
+			user.FullName = user.Username
+		}
+		external := &models.ExternalIdentity{Issuer: identity.Issuer, Subject: identity.Subject, Email: identity.Email}
+		err = users.CreateUserWithIdentity(spanCtx, &user, external)
+		if errors.Is(err, repositories.ErrDuplicate) {
+			// Either the username is taken or a concurrent callback
+			// created the account; the next attempt finds out which.
+			continue
+		}
+		if err != nil {
+			slog.ErrorContext(spanCtx, "failed to create user", "error", err)
+			return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to create user", nil)
+		}
+		logger.Audit(spanCtx, "user created by single sign-on", "username", user.Username,
+			"issuer", identity.Issuer, "subject", identity.Subject, "ip", ctx.IP())
+		return o.users.completeLogin(spanCtx, ctx, user, now)
+	}
+
+	slog.ErrorContext(spanCtx, "no free username for oidc identity", "issuer", identity.Issuer, "subject", identity.Subject)
+	return response.SendFailureResponse(ctx, fiber.StatusConflict, "Failed to create user", nil)
+}
+
+func (o *OIDCController) link(ctx *fiber.Ctx, identity oidc.Identity, username string) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "OIDCLinkIdentity", "controller")
+	defer span.End()
+
+	user, err := o.users.users.GetUserByUsername(spanCtx, username)
+	if err != nil {
+		slog.WarnContext(spanCtx, "failed to get user", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+	}
+
+	err = o.users.users.LinkIdentity(spanCtx, &models.ExternalIdentity{
+		UserId:  user.Id,
+		Issuer:  identity.Issuer,
+		Subject: identity.Subject,
+		Email:   identity.Email,
+	})
+	if errors.Is(err, repositories.ErrDuplicate) {
+		linked, err := o.users.users.GetUserByIdentity(spanCtx, identity.Issuer, identity.Subject)
+		if err == nil && linked.Id == user.Id {
+			return response.SendSuccessResponse(ctx, fiber.Map{"linked": true})
+		}
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Identity is linked to another account", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to link identity", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to link identity", nil)
+	}
+	logger.Audit(spanCtx, "external identity linked", "username", user.Username,
+		"issuer", identity.Issuer, "subject", identity.Subject, "ip", ctx.IP())
+	return response.SendSuccessResponse(ctx, fiber.Map{"linked": true})
+}
+
+func (o *OIDCController) setFlowCookie(ctx *fiber.Ctx, value string, expires time.Time) {
+	ctx.Cookie(&fiber.Cookie{
+		Name:     OIDCFlowCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		Expires:  expires,
+		Secure:   ctx.Protocol() == "https",
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+}
+
+// username derives a username from the provider's preferred username or the
+// email address, padded to the minimum length. Attempts after the first add
+// a random suffix.
+func username(identity oidc.Identity, attempt int) string {
+	base := usernameChars(identity.PreferredUsername)
+	if base == "" {
+		local, _, _ := strings.Cut(identity.Email, "@")
+		base = usernameChars(local)
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	suffix := ""
+	if attempt > 0 {
+		suffix = fmt.Sprintf("%04d", rand.IntN(10000))
+	}
+	name := truncate(base, maxUsernameLength-len(suffix)) + suffix
+	for len(name) < minUsernameLength {
+		name += fmt.Sprint(rand.IntN(10))
+	}
+	return name
+}
+
+func usernameChars(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + ('a' - 'A')
+		}
+		return -1
+	}, s)
+}
@@ -0,0 +1,360 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"go-chat-app/app/moderation"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/response"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxRoomLength mirrors the column size of models.RoomRole.Room.
+const maxRoomLength = 100
+
+// RoomController manages the roles users hold in single rooms and the
+// sanctions moderators impose there, and lets moderators delete messages. The
+// room is named by the room query parameter; without it, the default room.
+type RoomController struct {
+	users     repositories.UserRepository
+	roles     repositories.RoomRoleRepository
+	sanctions repositories.SanctionRepository
+	messages  repositories.MessageRepository
+	notifier  moderation.Notifier
+}
+
+func NewRoomController(users repositories.UserRepository, roles repositories.RoomRoleRepository,
+	sanctions repositories.SanctionRepository, messages repositories.MessageRepository, notifier moderation.Notifier) *RoomController {
+	return &RoomController{users: users, roles: roles, sanctions: sanctions, messages: messages, notifier: notifier}
+}
+
+// RoleIn returns the role the holder of claims has in room: the higher of
+// their global role and their role in that room.
+func RoleIn(claims *jwt.ClaimToken, room string) models.Role {
+	return models.Role(claims.Role).Max(models.Role(claims.Rooms[room]))
+}
+
+// tokenRoles collects the roles of user that go into its access tokens.
+func tokenRoles(ctx context.Context, roomRoles repositories.RoomRoleRepository, user models.User) (jwt.Roles, error) {
+	held, err := roomRoles.GetUserRoomRoles(ctx, user.Id)
+	if err != nil {
+		return jwt.Roles{}, err
+	}
+	roles := jwt.Roles{Role: string(user.Role)}
+	for _, role := range held {
+		if roles.Rooms == nil {
+			roles.Rooms = make(map[string]string, len(held))
+		}
+		roles.Rooms[role.Room] = string(role.Role)
+	}
+	return roles, nil
+}
+
+// ListRoles returns the users holding a role in the room.
+func (r *RoomController) ListRoles(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "ListRoomRoles", "controller")
+	defer span.End()
+
+	members, err := r.roles.GetRoomMembers(spanCtx, ctx.Query("room"))
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get room roles", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get roles", nil)
+	}
+	return response.SendSuccessResponse(ctx, members)
+}
+
+// GrantRole makes a user moderator or owner of the room, replacing the role
+// they held there. Callers can only change the role of users they outrank in
+// the room, and only grant roles below their own.
+func (r *RoomController) GrantRole(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "GrantRoomRole", "controller")
+	defer span.End()
+
+	req := new(models.RoomRoleRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+	room := ctx.Query("room")
+	if len(room) > maxRoomLength {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Room name too long", nil)
+	}
+	user, ok := r.user(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	if req.Role.AtLeast(RoleIn(claims, room)) {
+		return response.SendFailureResponse(ctx, fiber.StatusForbidden, "You can only grant roles below your own", nil)
+	}
+	if !r.outranks(spanCtx, ctx, claims, user, room) {
+		return nil
+	}
+
+	if err := r.roles.SetRoomRole(spanCtx, room, user.Id, req.Role); err != nil {
+		slog.ErrorContext(spanCtx, "failed to set room role", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to grant role", nil)
+	}
+	logger.Audit(spanCtx, "room role granted", "room", room, "username", user.Username, "role", req.Role,
+		"by", claims.Username, "ip", ctx.IP())
+	return response.SendSuccessResponse(ctx, models.RoomMember{Username: user.Username, Role: req.Role})
+}
+
+// RevokeRole takes the role a user holds in the room, leaving them a member.
+// Callers can only revoke the roles of users they outrank in the room.
+func (r *RoomController) RevokeRole(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "RevokeRoomRole", "controller")
+	defer span.End()
+
+	room := ctx.Query("room")
+	user, ok := r.user(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	if !r.outranks(spanCtx, ctx, claims, user, room) {
+		return nil
+	}
+
+	err := r.roles.DeleteRoomRole(spanCtx, room, user.Id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Role not found", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to delete room role", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to revoke role", nil)
+	}
+	logger.Audit(spanCtx, "room role revoked", "room", room, "username", user.Username,
+		"by", claims.Username, "ip", ctx.IP())
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// DeleteMessage deletes a message of the room by the id the history API
+// returned for it. Moderators can only delete messages of users they outrank
+// there.
+func (r *RoomController) DeleteMessage(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "RoomDeleteMessage", "controller")
+	defer span.End()
+
+	room := ctx.Query("room")
+	id := ctx.Params("id")
+	msg, err := r.messages.GetMessage(spanCtx, id)
+	if errors.Is(err, repositories.ErrNotFound) || (err == nil && msg.Room != room) {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Message not found", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get message", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to delete message", nil)
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	sender, err := r.users.GetUserByUsername(spanCtx, msg.From)
+	switch {
+	case errors.Is(err, repositories.ErrNotFound):
+		// The sender's account is gone, so there is no one to outrank.
+	case err != nil:
+		slog.ErrorContext(spanCtx, "failed to get sender", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to delete message", nil)
+	case !r.outranks(spanCtx, ctx, claims, sender, room):
+		return nil
+	}
+
+	err = r.messages.DeleteMessage(spanCtx, id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Message not found", nil)
+	}
+	if errors.Is(err, repositories.ErrReadOnly) {
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Archived messages can only be deleted on the instance running the archive job", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to delete message", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to delete message", nil)
+	}
+	logger.Audit(spanCtx, "message deleted", "message_id", id, "room", room, "sender", msg.From,
+		"by", claims.Username, "ip", ctx.IP())
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// ListSanctions returns the mutes and bans in force in the room.
+func (r *RoomController) ListSanctions(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "ListSanctions", "controller")
+	defer span.End()
+
+	sanctions, err := r.sanctions.GetRoomSanctions(spanCtx, ctx.Query("room"), time.Now())
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get sanctions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get sanctions", nil)
+	}
+	return response.SendSuccessResponse(ctx, sanctions)
+}
+
+// Mute keeps a user from sending to the room. They can still read it.
+func (r *RoomController) Mute(ctx *fiber.Ctx) error {
+	return r.impose(ctx, models.SanctionMute)
+}
+
+// Kick removes a user from the room. They may join it again.
+func (r *RoomController) Kick(ctx *fiber.Ctx) error {
+	return r.impose(ctx, models.SanctionKick)
+}
+
+// Ban removes a user from the room and keeps them out.
+func (r *RoomController) Ban(ctx *fiber.Ctx) error {
+	return r.impose(ctx, models.SanctionBan)
+}
+
+func (r *RoomController) Unmute(ctx *fiber.Ctx) error {
+	return r.lift(ctx, models.SanctionMute)
+}
+
+func (r *RoomController) Unban(ctx *fiber.Ctx) error {
+	return r.lift(ctx, models.SanctionBan)
+}
+
+// impose records a sanction of kind against the user named by the route
+// and tells the room. Moderators can only sanction users they outrank there.
+func (r *RoomController) impose(ctx *fiber.Ctx, kind models.SanctionKind) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "ImposeSanction", "controller")
+	defer span.End()
+
+	req := new(models.SanctionRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+	room := ctx.Query("room")
+	if len(room) > maxRoomLength {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Room name too long", nil)
+	}
+	user, ok := r.user(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	if !r.outranks(spanCtx, ctx, claims, user, room) {
+		return nil
+	}
+	moderator, err := r.users.GetUserByUsername(spanCtx, claims.Username)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get moderator", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+
+	now := time.Now()
+	sanction := &models.Sanction{
+		Room:        room,
+		UserId:      user.Id,
+		Kind:        kind,
+		ModeratorId: moderator.Id,
+		Reason:      req.Reason,
+		ExpiresAt:   req.Until(now),
+		CreatedAt:   now,
+	}
+	if kind == models.SanctionKick {
+		sanction.ExpiresAt, sanction.LiftedAt = &now, &now
+	}
+	if err := r.sanctions.CreateSanction(spanCtx, sanction); err != nil {
+		slog.ErrorContext(spanCtx, "failed to create sanction", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to moderate user", nil)
+	}
+	event := models.NewModerationEvent(models.ModerationAction(kind), room, user.Username, claims.Username)
+	event.Reason = req.Reason
+	if kind != models.SanctionKick {
+		event.ExpiresAt = sanction.ExpiresAt
+	}
+	logger.Audit(spanCtx, "user sanctioned", "room", room, "username", user.Username, "kind", kind,
+		"reason", req.Reason, "expires_at", event.ExpiresAt, "by", claims.Username, "ip", ctx.IP())
+	r.notifier.Moderate(spanCtx, event)
+	return response.SendSuccessResponse(ctx, models.SanctionResponse{
+		Id:        sanction.Id,
+		Room:      room,
+		Username:  user.Username,
+		Kind:      kind,
+		Moderator: claims.Username,
+		Reason:    req.Reason,
+		ExpiresAt: event.ExpiresAt,
+		CreatedAt: now,
+	})
+}
+
+// lift lifts the sanction of kind on the user named by the route and tells
+// the room.
+func (r *RoomController) lift(ctx *fiber.Ctx, kind models.SanctionKind) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "LiftSanction", "controller")
+	defer span.End()
+
+	room := ctx.Query("room")
+	user, ok := r.user(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+
+	err := r.sanctions.LiftSanction(spanCtx, room, user.Id, kind, time.Now())
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Sanction not found", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to lift sanction", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to lift sanction", nil)
+	}
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	logger.Audit(spanCtx, "sanction lifted", "room", room, "username", user.Username, "kind", kind,
+		"by", claims.Username, "ip", ctx.IP())
+	r.notifier.Moderate(spanCtx, models.NewModerationEvent(models.LiftAction(kind), room, user.Username, claims.Username))
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// outranks reports whether the holder of claims has a higher role in room
+// than user. When not, or when it fails, it writes the error response.
+func (r *RoomController) outranks(spanCtx context.Context, ctx *fiber.Ctx, claims *jwt.ClaimToken, user models.User, room string) bool {
+	held, err := r.roles.GetUserRoomRoles(spanCtx, user.Id)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get room roles", "error", err)
+		_ = response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+		return false
+	}
+	role := user.Role
+	for _, h := range held {
+		if h.Room == room {
+			role = role.Max(h.Role)
+		}
+	}
+	if role.AtLeast(RoleIn(claims, room)) {
+		_ = response.SendFailureResponse(ctx, fiber.StatusForbidden, "You do not outrank this user", nil)
+		return false
+	}
+	return true
+}
+
+// user loads the user named by the username route parameter. When it fails
+// it writes the error response and returns false.
+func (r *RoomController) user(spanCtx context.Context, ctx *fiber.Ctx) (models.User, bool) {
+	user, err := r.users.GetUserByUsername(spanCtx, ctx.Params("username"))
+	if errors.Is(err, repositories.ErrNotFound) {
+		_ = response.SendFailureResponse(ctx, fiber.StatusNotFound, "User not found", nil)
+		return user, false
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user", "error", err)
+		_ = response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+		return user, false
+	}
+	return user, true
+}
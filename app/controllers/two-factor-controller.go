@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/response"
+	"go-chat-app/pkg/totp"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/skip2/go-qrcode"
+)
+
+const (
+	recoveryCodeCount = 10
+	qrCodeSize        = 256
+)
+
+// EnrollTwoFactor starts enrollment with a new secret. Two-factor
+// authentication only applies once a first code is confirmed, so a
+// half-finished enrollment locks nobody out.
+func (u *UserController) EnrollTwoFactor(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "EnrollTwoFactor", "controller")
+	defer span.End()
+
+	user, ok := u.currentUser(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if user.TwoFactorEnabled() {
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Two-factor authentication already enabled", nil)
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to generate totp secret", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	if err := u.users.UpdateTwoFactor(spanCtx, user.Username, secret, false); err != nil {
+		slog.ErrorContext(spanCtx, "failed to store totp secret", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to start enrollment", err.Error())
+	}
+
+	return response.SendSuccessResponse(ctx, models.TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.URI(jwt.Issuer(), user.Username, secret),
+	})
+}
+
+// TwoFactorQRCode renders the otpauth URI of a pending enrollment as a PNG.
+func (u *UserController) TwoFactorQRCode(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "TwoFactorQRCode", "controller")
+	defer span.End()
+
+	user, ok := u.currentUser(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if user.TwoFactorSecret == "" || user.TwoFactorEnabled() {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "No pending enrollment", nil)
+	}
+
+	png, err := qrcode.Encode(totp.URI(jwt.Issuer(), user.Username, user.TwoFactorSecret), qrcode.Medium, qrCodeSize)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to render qr code", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	// The image holds the secret.
+	ctx.Set(fiber.HeaderCacheControl, "no-store")
+	ctx.Set(fiber.HeaderContentType, "image/png")
+	return ctx.Send(png)
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the first code
+// checks out, and returns the recovery codes. They are shown only once.
+func (u *UserController) ConfirmTwoFactor(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "ConfirmTwoFactor", "controller")
+	defer span.End()
+
+	req := new(models.TwoFactorRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if req.Code == "" {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", "code is required")
+	}
+
+	user, ok := u.currentUser(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if user.TwoFactorEnabled() {
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Two-factor authentication already enabled", nil)
+	}
+	if user.TwoFactorSecret == "" {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "No pending enrollment", nil)
+	}
+	if !u.checkLockout(spanCtx, ctx, user.Username) {
+		return nil
+	}
+
+	valid, err := u.verifySecondFactor(spanCtx, user, models.TwoFactorRequest{Code: req.Code}, time.Now())
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to verify totp code", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	if !valid {
+		slog.WarnContext(spanCtx, "invalid second factor", "username", user.Username)
+		return u.loginFailed(spanCtx, ctx, user.Username, "Invalid code")
+	}
+	if err := u.lockout.Succeed(spanCtx, user.Username); err != nil {
+		slog.ErrorContext(spanCtx, "failed to clear login failures", "error", err)
+	}
+
+	codes, err := u.newRecoveryCodes(spanCtx, user.Id)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to store recovery codes", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to enable two-factor authentication", nil)
+	}
+	if err := u.users.UpdateTwoFactor(spanCtx, user.Username, user.TwoFactorSecret, true); err != nil {
+		slog.ErrorContext(spanCtx, "failed to enable two-factor authentication", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to enable two-factor authentication", nil)
+	}
+	logger.Audit(spanCtx, "two-factor authentication enabled", "username", user.Username, "ip", ctx.IP())
+
+	return response.SendSuccessResponse(ctx, fiber.Map{"recovery_codes": codes})
+}
+
+// DisableTwoFactor turns two-factor authentication off. It takes a current
+// code or a recovery code, so a stolen access token is not enough.
+func (u *UserController) DisableTwoFactor(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "DisableTwoFactor", "controller")
+	defer span.End()
+
+	req := new(models.TwoFactorRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	user, ok := u.currentUser(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	if !user.TwoFactorEnabled() {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Two-factor authentication not enabled", nil)
+	}
+	// A stolen access token must not allow unlimited guesses at the code.
+	if !u.checkLockout(spanCtx, ctx, user.Username) {
+		return nil
+	}
+
+	valid, err := u.verifySecondFactor(spanCtx, user, *req, time.Now())
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to verify second factor", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	if !valid {
+		slog.WarnContext(spanCtx, "invalid second factor", "username", user.Username)
+		return u.loginFailed(spanCtx, ctx, user.Username, "Invalid code")
+	}
+	if err := u.lockout.Succeed(spanCtx, user.Username); err != nil {
+		slog.ErrorContext(spanCtx, "failed to clear login failures", "error", err)
+	}
+
+	if err := u.users.UpdateTwoFactor(spanCtx, user.Username, "", false); err != nil {
+		slog.ErrorContext(spanCtx, "failed to disable two-factor authentication", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to disable two-factor authentication", nil)
+	}
+	if err := u.users.ReplaceRecoveryCodes(spanCtx, user.Id, nil); err != nil {
+		slog.ErrorContext(spanCtx, "failed to delete recovery codes", "error", err)
+	}
+	logger.Audit(spanCtx, "two-factor authentication disabled", "username", user.Username, "ip", ctx.IP())
+
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// LoginTwoFactor completes a login by exchanging the intermediate token and
+// a second factor for the session tokens. The intermediate token works once.
+func (u *UserController) LoginTwoFactor(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "LoginTwoFactor", "controller")
+	defer span.End()
+
+	now := time.Now()
+	req := new(models.TwoFactorRequest)
+	if err := ctx.BodyParser(req); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
+	}
+	if err := req.Validate(); err != nil {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
+	}
+
+	claims, err := jwt.ValidateToken(spanCtx, req.Token)
+	if err != nil || claims.TokenType != "2fa" || claims.ID == "" {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid token", nil)
+	}
+	revoked, err := u.revocations.IsTokenRevoked(spanCtx, claims.ID)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to check token revocation", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	if revoked {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid token", nil)
+	}
+
+	user, err := u.users.GetUserByUsername(spanCtx, claims.Username)
+	if err != nil || !user.TwoFactorEnabled() {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid token", nil)
+	}
+	if user.Disabled() {
+		return response.SendFailureResponse(ctx, fiber.StatusForbidden, "Account disabled", nil)
+	}
+	// Codes are guessed like passwords and count towards the same lockout.
+	if !u.checkLockout(spanCtx, ctx, user.Username) {
+		return nil
+	}
+
+	valid, err := u.verifySecondFactor(spanCtx, user, *req, now)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to verify second factor", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	if !valid {
+		slog.WarnContext(spanCtx, "invalid second factor", "username", user.Username)
+		return u.loginFailed(spanCtx, ctx, user.Username, "Invalid code")
+	}
+	if err := u.lockout.Succeed(spanCtx, user.Username); err != nil {
+		slog.ErrorContext(spanCtx, "failed to clear login failures", "error", err)
+	}
+
+	if err := u.revocations.RevokeToken(spanCtx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		slog.ErrorContext(spanCtx, "failed to revoke token", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	return u.startSession(spanCtx, ctx, user, now)
+}
+
+// verifySecondFactor checks the TOTP code or recovery code of req. Either is
+// used up by a successful check.
+func (u *UserController) verifySecondFactor(spanCtx context.Context, user models.User, req models.TwoFactorRequest, now time.Time) (bool, error) {
+	if req.RecoveryCode != "" {
+		err := u.users.UseRecoveryCode(spanCtx, user.Id, totp.HashRecoveryCode(req.RecoveryCode))
+		if errors.Is(err, repositories.ErrNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		logger.Audit(spanCtx, "recovery code used", "username", user.Username)
+		return true, nil
+	}
+
+	step, ok := totp.Validate(user.TwoFactorSecret, req.Code, now)
+	if !ok {
+		return false, nil
+	}
+	err := u.users.UseTwoFactorStep(spanCtx, user.Username, step)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// newRecoveryCodes replaces the recovery codes of a user and returns the new
+// ones in plain text.
+func (u *UserController) newRecoveryCodes(spanCtx context.Context, userId uint) ([]string, error) {
+	codes, err := totp.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = totp.HashRecoveryCode(code)
+	}
+	return codes, u.users.ReplaceRecoveryCodes(spanCtx, userId, hashes)
+}
+
+// currentUser loads the account of the access token that authenticated the
+// request. When it fails it writes the error response and returns false.
+func (u *UserController) currentUser(spanCtx context.Context, ctx *fiber.Ctx) (models.User, bool) {
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	user, err := u.users.GetUserByUsername(spanCtx, claims.Username)
+	if errors.Is(err, repositories.ErrNotFound) {
+		_ = response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+		return user, false
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user", "error", err)
+		_ = response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get user", err.Error())
+		return user, false
+	}
+	return user, true
+}
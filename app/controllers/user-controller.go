@@ -1,162 +1,331 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"go-chat-app/app/lockout"
 	"go-chat-app/app/models"
 	"go-chat-app/app/repositories"
 	"go-chat-app/pkg/jwt"
 	"go-chat-app/pkg/response"
-	"log"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.elastic.co/apm"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func RegisterUser(ctx *fiber.Ctx) error {
+// SessionKey is the fiber.Ctx local holding the models.UserSession that
+// authenticated the request.
+const SessionKey = "session"
 
-	span, spanCtx := apm.StartSpan(ctx.Context(), "Register", "controller")
+// ClaimsKey is the fiber.Ctx local holding the *jwt.ClaimToken of the token
+// that authenticated the request.
+const ClaimsKey = "claims"
+
+const maxUserAgentLength = 255
+
+// SessionCloser disconnects the WebSockets opened with the given sessions.
+type SessionCloser interface {
+	CloseSessions(ids ...uint) int
+}
+
+type UserController struct {
+	users       repositories.UserRepository
+	tokens      repositories.AccountTokenRepository
+	roomRoles   repositories.RoomRoleRepository
+	sessions    repositories.SessionRepository
+	revocations repositories.RevocationRepository
+	sockets     SessionCloser
+	mail        AccountMail
+	lockout     *lockout.Guard
+}
+
+func NewUserController(users repositories.UserRepository, tokens repositories.AccountTokenRepository,
+	roomRoles repositories.RoomRoleRepository, sessions repositories.SessionRepository,
+	revocations repositories.RevocationRepository, sockets SessionCloser, mail AccountMail, guard *lockout.Guard) *UserController {
+	return &UserController{users: users, tokens: tokens, roomRoles: roomRoles, sessions: sessions, revocations: revocations,
+		sockets: sockets, mail: mail, lockout: guard}
+}
+
+func (u *UserController) RegisterUser(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "Register", "controller")
 	defer span.End()
 
 	user := new(models.User)
 
 	if err := ctx.BodyParser(&user); err != nil {
-		log.Printf("Failed to parse request body: %v", err)
+		slog.WarnContext(spanCtx, "failed to parse request body", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
 	}
 
+	if user.Email != nil && *user.Email == "" {
+		user.Email = nil
+	}
 	if err := user.Validate(); err != nil {
-		log.Printf("User validation failed: %v", err)
+		slog.WarnContext(spanCtx, "user validation failed", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
 	}
+	if user.Email != nil {
+		email := normalizeEmail(*user.Email)
+		user.Email = &email
+	}
+	user.EmailVerifiedAt = nil
 
 	hashPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
-		log.Printf("Failed to hash password: %v", err)
+		slog.ErrorContext(spanCtx, "failed to hash password", "error", err)
 	}
 	user.Password = string(hashPassword)
 
-	err = repositories.CreateUser(spanCtx, user)
+	err = u.users.CreateUser(spanCtx, user)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		slog.WarnContext(spanCtx, "username or email already taken", "username", user.Username)
+		return response.SendFailureResponse(ctx, fiber.StatusConflict, "Username or email already taken", nil)
+	}
 	if err != nil {
-		log.Printf("Failed to create user: %v", err)
+		slog.ErrorContext(spanCtx, "failed to create user", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to create user", nil)
 	}
 
+	// The account works without a verified address, so a mail that could
+	// not be sent is only logged; the user can ask for another.
+	if user.Email != nil {
+		if err := u.sendVerification(spanCtx, *user); err != nil {
+			slog.ErrorContext(spanCtx, "failed to send verification mail", "error", err)
+		}
+	}
+
 	bodyResp := user.Username
 
 	return response.SendSuccessResponse(ctx, bodyResp)
 }
 
-func LoginUser(ctx *fiber.Ctx) error {
+func (u *UserController) LoginUser(ctx *fiber.Ctx) error {
 
-	span, spanCtx := apm.StartSpan(ctx.Context(), "Login", "controller")
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "Login", "controller")
 	defer span.End()
 
 	now := time.Now()
 	loginReq := new(models.LoginRequest)
-	loginResp := new(models.LoginResponse)
 
 	if err := ctx.BodyParser(&loginReq); err != nil {
-		log.Printf("Failed to parse request body: %v", err)
+		slog.WarnContext(spanCtx, "failed to parse request body", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid request format", err.Error())
 	}
 
 	if err := loginReq.Validate(); err != nil {
-		log.Printf("User validation failed: %v", err)
+		slog.WarnContext(spanCtx, "user validation failed", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Validation failed", err.Error())
 	}
 
-	user, err := repositories.GetUserByUsername(spanCtx, loginReq.Username)
+	if !u.checkLockout(spanCtx, ctx, loginReq.Username) {
+		return nil
+	}
+
+	// Unknown users and wrong passwords get the same answer in about the
+	// same time, so that the response does not tell which accounts exist.
+	user, err := u.users.GetUserByUsername(spanCtx, loginReq.Username)
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		slog.ErrorContext(spanCtx, "failed to get user", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+	}
+	// Accounts created by single sign-on have no password.
+	known := err == nil && user.Password != ""
+	passwordHash := user.Password
+	if !known {
+		passwordHash = dummyPasswordHash()
+	}
+	if bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(loginReq.Password)) != nil || !known {
+		slog.WarnContext(spanCtx, "invalid credentials", "username", loginReq.Username)
+		return u.loginFailed(spanCtx, ctx, loginReq.Username, "Invalid credentials")
+	}
+	// With a second factor the failures are cleared by /login/2fa, or the
+	// password alone would reset the count that throttles code guessing.
+	if !user.TwoFactorEnabled() {
+		if err := u.lockout.Succeed(spanCtx, user.Username); err != nil {
+			slog.ErrorContext(spanCtx, "failed to clear login failures", "error", err)
+		}
+	}
+
+	return u.completeLogin(spanCtx, ctx, user, now)
+}
+
+// checkLockout refuses the attempt with 429 and Retry-After while the
+// username or the client IP is backing off. When it refuses it writes the
+// response and returns false.
+func (u *UserController) checkLockout(spanCtx context.Context, ctx *fiber.Ctx, username string) bool {
+	wait, err := u.lockout.Check(spanCtx, username, ctx.IP())
 	if err != nil {
-		log.Printf("Failed to get user: %v", err)
-		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Validation failed", err.Error())
+		slog.ErrorContext(spanCtx, "failed to check login failures", "error", err)
+		_ = response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
+		return false
+	}
+	if wait > 0 {
+		slog.WarnContext(spanCtx, "login throttled", "username", username, "retry_after", wait)
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		_ = response.SendFailureResponse(ctx, fiber.StatusTooManyRequests, "Too many failed attempts, try again later", nil)
+		return false
+	}
+	return true
+}
+
+// loginFailed counts a failed attempt and answers 401 with message.
+func (u *UserController) loginFailed(spanCtx context.Context, ctx *fiber.Ctx, username, message string) error {
+	if err := u.lockout.Fail(spanCtx, username, ctx.IP()); err != nil {
+		slog.ErrorContext(spanCtx, "failed to record login failure", "error", err)
+	}
+	return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, message, nil)
+}
+
+// dummyPasswordHash is compared against when there is no real hash, so that
+// such logins take as long as any other.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	return string(hash)
+})
+
+// completeLogin finishes the login of a user whose first factor checked out:
+// it refuses disabled accounts, asks for the second factor when one is
+// enrolled and otherwise starts a session.
+func (u *UserController) completeLogin(spanCtx context.Context, ctx *fiber.Ctx, user models.User, now time.Time) error {
+	if user.Disabled() {
+		slog.WarnContext(spanCtx, "login to disabled account", "username", user.Username)
+		return response.SendFailureResponse(ctx, fiber.StatusForbidden, "Account disabled", nil)
+	}
+
+	// The first factor alone only earns a short-lived token to present with
+	// the second factor at /login/2fa.
+	if user.TwoFactorEnabled() {
+		twoFactorToken, _, err := jwt.GenerateToken(spanCtx, user.Username, user.FullName, `2fa`, jwt.Roles{}, now)
+		if err != nil {
+			slog.ErrorContext(spanCtx, "failed to generate token", "error", err)
+			return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", err.Error())
+		}
+		return response.SendSuccessResponse(ctx, models.LoginResponse{
+			Username:          user.Username,
+			FullName:          user.FullName,
+			TwoFactorRequired: true,
+			TwoFactorToken:    twoFactorToken,
+		})
 	}
 
-	// Compare password
-	err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginReq.Password))
+	return u.startSession(spanCtx, ctx, user, now)
+}
+
+// startSession issues the access and refresh tokens of a new session and
+// writes them as the login response.
+func (u *UserController) startSession(spanCtx context.Context, ctx *fiber.Ctx, user models.User, now time.Time) error {
+	roles, err := tokenRoles(spanCtx, u.roomRoles, user)
 	if err != nil {
-		log.Printf("Failed to compare password: %v", err)
-		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid credentials", err.Error())
+		slog.ErrorContext(spanCtx, "failed to get user roles", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", nil)
 	}
 
-	token, err := jwt.GenerateToken(spanCtx, user.Username, user.FullName, `access`, now)
+	token, tokenId, err := jwt.GenerateToken(spanCtx, user.Username, user.FullName, `access`, roles, now)
 	if err != nil {
-		log.Printf("Failed to generate token: %v", err)
+		slog.ErrorContext(spanCtx, "failed to generate token", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", err.Error())
 	}
 
-	refreshToken, err := jwt.GenerateToken(spanCtx, user.Username, user.FullName, `refresh`, now)
+	refreshToken, _, err := jwt.GenerateToken(spanCtx, user.Username, user.FullName, `refresh`, jwt.Roles{}, now)
 	if err != nil {
-		log.Printf("Failed to refresh token: %v", err)
+		slog.ErrorContext(spanCtx, "failed to refresh token", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Internal server error", err.Error())
 	}
 
 	// Create a user session
 	userSession := &models.UserSession{
 		UserId:              user.Id,
-		Token:               token,
-		RefreshToken:        refreshToken,
+		Token:               tokenId,
+		RefreshToken:        jwt.HashToken(refreshToken),
 		TokenExpired:        now.Add(jwt.MapTokenTypes[`access`]),
 		RefreshTokenExpired: now.Add(jwt.MapTokenTypes[`refresh`]),
+		IP:                  ctx.IP(),
+		UserAgent:           truncate(ctx.Get(fiber.HeaderUserAgent), maxUserAgentLength),
+		LastUsedAt:          now,
 	}
-	err = repositories.CreateUserSession(spanCtx, userSession)
+	err = u.sessions.CreateUserSession(spanCtx, userSession)
 	if err != nil {
-		log.Printf("Failed to create user session: %v", err)
+		slog.ErrorContext(spanCtx, "failed to create user session", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to create session", err.Error())
 	}
 
-	loginResp.Username = user.Username
-	loginResp.FullName = user.FullName
-	loginResp.Token = token
-	loginResp.RefreshToken = refreshToken
-
-	return response.SendSuccessResponse(ctx, loginResp)
+	return response.SendSuccessResponse(ctx, models.LoginResponse{
+		Username:     user.Username,
+		FullName:     user.FullName,
+		Token:        token,
+		RefreshToken: refreshToken,
+	})
 }
 
-func LogoutUser(ctx *fiber.Ctx) error {
+func (u *UserController) LogoutUser(ctx *fiber.Ctx) error {
 
-	span, spanCtx := apm.StartSpan(ctx.Context(), "LogoutUser", "controller")
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "LogoutUser", "controller")
 	defer span.End()
 
-	authHeader := ctx.Get("Authorization")
-	var token string
-	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-		token = authHeader[7:]
-	} else {
-		token = authHeader
-	}
-	err := repositories.DeleteUserSession(spanCtx, token)
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	err := u.sessions.DeleteUserSession(spanCtx, claims.ID)
 	if err != nil {
-		log.Printf("Failed to delete user session: %v", err)
+		slog.ErrorContext(spanCtx, "failed to delete user session", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to delete session", err.Error())
 	}
 	return ctx.SendStatus(fiber.StatusOK)
 }
 
-func RefreshToken(ctx *fiber.Ctx) error {
+func (u *UserController) RefreshToken(ctx *fiber.Ctx) error {
 
-	span, spanCtx := apm.StartSpan(ctx.Context(), "RefreshToken", "controller")
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "RefreshToken", "controller")
 	defer span.End()
 
 	now := time.Now()
-	username := ctx.Get("username")
-	refreshToken := ctx.Get("refresh_token")
-	fullName := ctx.Get("full_name")
+	session := ctx.Locals(SessionKey).(models.UserSession)
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+
+	// Roles are looked up again, so changes reach the user with the next
+	// refresh.
+	user, err := u.users.GetUserById(spanCtx, session.UserId)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to generate access token", nil)
+	}
+	// A session that outlived the disabling of its account must not be
+	// kept alive.
+	if user.Disabled() {
+		slog.WarnContext(spanCtx, "refresh for disabled account", "username", user.Username, "session_id", session.Id)
+		return response.SendFailureResponse(ctx, fiber.StatusForbidden, "Account disabled", nil)
+	}
+	roles, err := tokenRoles(spanCtx, u.roomRoles, user)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user roles", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to generate access token", nil)
+	}
 
 	// Generate new tokens
-	newAccessToken, err := jwt.GenerateToken(spanCtx, username, fullName, "access", now)
+	newAccessToken, newTokenId, err := jwt.GenerateToken(spanCtx, claims.Username, claims.FullName, "access", roles, now)
 	if err != nil {
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to generate access token", err.Error())
 	}
 
-	newRefreshToken, err := jwt.GenerateToken(spanCtx, username, fullName, "refresh", now)
+	newRefreshToken, _, err := jwt.GenerateToken(spanCtx, claims.Username, claims.FullName, "refresh", jwt.Roles{}, now)
 	if err != nil {
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to generate refresh token", err.Error())
 	}
 
-	// Update the session with new tokens and expiration times
-	err = repositories.UpdateUserSessionTokens(spanCtx, newAccessToken, newRefreshToken,
-		now.Add(jwt.MapTokenTypes["access"]), now.Add(jwt.MapTokenTypes["refresh"]), refreshToken)
+	// Rotate the tokens; the presented refresh token is remembered so that
+	// presenting it again revokes the session.
+	err = u.sessions.UpdateUserSessionTokens(spanCtx, newTokenId, jwt.HashToken(newRefreshToken),
+		now.Add(jwt.MapTokenTypes["access"]), now.Add(jwt.MapTokenTypes["refresh"]), session.RefreshToken)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid refresh token", nil)
+	}
 	if err != nil {
 		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to update session", err.Error())
 	}
@@ -166,3 +335,124 @@ func RefreshToken(ctx *fiber.Ctx) error {
 		"refresh_token": newRefreshToken,
 	})
 }
+
+func (u *UserController) ListSessions(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "ListSessions", "controller")
+	defer span.End()
+
+	current, ok := u.currentSession(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	sessions, err := u.sessions.GetUserSessions(spanCtx, current.UserId)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user sessions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get sessions", err.Error())
+	}
+
+	resp := make([]models.SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, models.SessionResponse{
+			Id:         session.Id,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			Current:    session.Id == current.Id,
+		})
+	}
+	return response.SendSuccessResponse(ctx, resp)
+}
+
+func (u *UserController) RevokeSession(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "RevokeSession", "controller")
+	defer span.End()
+
+	id, err := ctx.ParamsInt("id")
+	if err != nil || id <= 0 {
+		return response.SendFailureResponse(ctx, fiber.StatusBadRequest, "Invalid session id", nil)
+	}
+
+	// Only the caller's own sessions can be revoked; any other id is
+	// reported as missing.
+	current, ok := u.currentSession(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	sessions, err := u.sessions.GetUserSessions(spanCtx, current.UserId)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user sessions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to revoke session", err.Error())
+	}
+	if !slices.ContainsFunc(sessions, func(s models.UserSession) bool { return s.Id == uint(id) }) {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Session not found", nil)
+	}
+
+	err = u.sessions.DeleteUserSessionById(spanCtx, uint(id))
+	if errors.Is(err, repositories.ErrNotFound) {
+		return response.SendFailureResponse(ctx, fiber.StatusNotFound, "Session not found", nil)
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to delete user session", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to revoke session", err.Error())
+	}
+	u.sockets.CloseSessions(uint(id))
+	return ctx.SendStatus(fiber.StatusOK)
+}
+
+// RevokeAllSessions logs the caller out everywhere, including the session
+// that made the request.
+func (u *UserController) RevokeAllSessions(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "RevokeAllSessions", "controller")
+	defer span.End()
+
+	current, ok := u.currentSession(spanCtx, ctx)
+	if !ok {
+		return nil
+	}
+	sessions, err := u.sessions.GetUserSessions(spanCtx, current.UserId)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user sessions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to revoke sessions", err.Error())
+	}
+
+	revoked, err := u.sessions.DeleteUserSessions(spanCtx, current.UserId)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to delete user sessions", "error", err)
+		return response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to revoke sessions", err.Error())
+	}
+
+	ids := make([]uint, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.Id)
+	}
+	u.sockets.CloseSessions(ids...)
+	return response.SendSuccessResponse(ctx, fiber.Map{"revoked": revoked})
+}
+
+// currentSession loads the session of the access token that authenticated
+// the request. When it fails it writes the error response and returns false.
+func (u *UserController) currentSession(spanCtx context.Context, ctx *fiber.Ctx) (models.UserSession, bool) {
+	claims := ctx.Locals(ClaimsKey).(*jwt.ClaimToken)
+	session, err := u.sessions.GetUserSession(spanCtx, claims.ID)
+	if errors.Is(err, repositories.ErrNotFound) {
+		_ = response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+		return session, false
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to get user session", "error", err)
+		_ = response.SendFailureResponse(ctx, fiber.StatusInternalServerError, "Failed to get session", err.Error())
+		return session, false
+	}
+	return session, true
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
@@ -0,0 +1,130 @@
+// Package filter screens chat messages before they are stored and
+// broadcast. A Chain runs a message through its filters in order; each one
+// lets it pass, changes its text, flags it to the audit log or rejects it.
+package filter
+
+import (
+	"context"
+	"fmt"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/metrics"
+)
+
+type Action int
+
+const (
+	Allow Action = iota
+	Modify
+	Flag
+	Reject
+)
+
+func (a Action) String() string {
+	switch a {
+	case Modify:
+		return "modify"
+	case Flag:
+		return "flag"
+	case Reject:
+		return "reject"
+	default:
+		return "allow"
+	}
+}
+
+// Result is what a filter decided about a message. Text replaces the text of
+// a modified message. Reason explains a flag or rejection, and Code, one of
+// the models.ErrorCode values, names a rejection for the sender's client.
+type Result struct {
+	Action Action
+	Text   string
+	Code   string
+	Reason string
+}
+
+type Filter interface {
+	Name() string
+	Check(msg models.MessagePayload) Result
+}
+
+// RejectedError is returned for a message a filter rejected. Code and
+// Reason are meant for the sender.
+type RejectedError struct {
+	Filter string
+	Code   string
+	Reason string
+}
+
+func (e *RejectedError) Error() string {
+	return fmt.Sprintf("message rejected by the %s filter: %s", e.Filter, e.Reason)
+}
+
+// Chain runs messages through filters in order.
+type Chain struct {
+	filters []Filter
+}
+
+func NewChain(filters ...Filter) *Chain {
+	return &Chain{filters: filters}
+}
+
+// New builds the chain cfg describes: the length limit, the HTML sanitizer,
+// the secret redactor and the word filter, each unless turned off.
+func New(cfg config.FilterConfig) (*Chain, error) {
+	var filters []Filter
+	if cfg.MaxLength > 0 {
+		filters = append(filters, NewLengthFilter(cfg.MaxLength))
+	}
+	if cfg.SanitizeHTML {
+		filters = append(filters, NewHTMLFilter())
+	}
+	if cfg.SecretsAction != config.FilterActionOff {
+		secrets, err := NewSecretFilter(cfg.SecretsAction, cfg.SecretPatterns)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, secrets)
+	}
+	if words := NewWordFilter(cfg); words != nil {
+		filters = append(filters, words)
+	}
+	return NewChain(filters...), nil
+}
+
+// Apply returns msg as the filters leave it. A filter sees the text the
+// previous ones passed on. Flags are audit-logged without the text, which may
+// hold the very secret that was found; the first rejection ends the chain
+// with a *RejectedError.
+func (c *Chain) Apply(ctx context.Context, msg models.MessagePayload) (models.MessagePayload, error) {
+	for _, f := range c.filters {
+		result := f.Check(msg)
+		if result.Action != Allow {
+			metrics.MessagesFiltered.WithLabelValues(f.Name(), result.Action.String()).Inc()
+		}
+		switch result.Action {
+		case Modify:
+			msg.Message = result.Text
+		case Flag:
+			logger.Audit(ctx, "message flagged", "filter", f.Name(), "room", msg.Room, "from", msg.From,
+				"reason", result.Reason)
+		case Reject:
+			return msg, &RejectedError{Filter: f.Name(), Code: result.Code, Reason: result.Reason}
+		}
+	}
+	return msg, nil
+}
+
+// matched turns a match of a filter configured with action into a result,
+// with text as the masked text.
+func matched(action, text, code, reason string) Result {
+	switch action {
+	case config.FilterActionFlag:
+		return Result{Action: Flag, Reason: reason}
+	case config.FilterActionReject:
+		return Result{Action: Reject, Code: code, Reason: reason}
+	default:
+		return Result{Action: Modify, Text: text}
+	}
+}
@@ -0,0 +1,73 @@
+package filter
+
+import (
+	"go-chat-app/app/models"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// droppedElements are removed together with their content: scripts and
+// styles, and the elements whose content is not parsed as markup.
+var droppedElements = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "template": true,
+	"noscript": true, "noembed": true, "noframes": true, "textarea": true, "title": true, "xmp": true,
+	"plaintext": true,
+}
+
+// HTMLFilter strips markup, so messages stay plain text even for clients
+// that render them as HTML. Text is kept as written, entities included.
+type HTMLFilter struct{}
+
+func NewHTMLFilter() *HTMLFilter {
+	return &HTMLFilter{}
+}
+
+func (f *HTMLFilter) Name() string { return "html" }
+
+func (f *HTMLFilter) Check(msg models.MessagePayload) Result {
+	text := msg.Message
+	// Removing a tag can join the text around it into a new one, so strip
+	// until nothing changes.
+	for {
+		stripped := stripMarkup(text)
+		if stripped == text {
+			break
+		}
+		text = stripped
+	}
+	switch {
+	case text == msg.Message:
+		return Result{}
+	case strings.TrimSpace(text) == "":
+		return Result{Action: Reject, Code: models.ErrorCodeEmptyMessage, Reason: "Messages must contain text"}
+	default:
+		return Result{Action: Modify, Text: text}
+	}
+}
+
+func stripMarkup(s string) string {
+	z := html.NewTokenizer(strings.NewReader(s))
+	var b strings.Builder
+	dropping := ""
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return b.String()
+		case html.TextToken:
+			if dropping == "" {
+				b.Write(z.Raw())
+			}
+		case html.StartTagToken:
+			name, _ := z.TagName()
+			if dropping == "" && droppedElements[string(name)] {
+				dropping = string(name)
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			if string(name) == dropping {
+				dropping = ""
+			}
+		}
+	}
+}
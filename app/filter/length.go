@@ -0,0 +1,26 @@
+package filter
+
+import (
+	"go-chat-app/app/models"
+	"strconv"
+	"unicode/utf8"
+)
+
+// LengthFilter rejects messages longer than a number of characters.
+type LengthFilter struct {
+	max int
+}
+
+func NewLengthFilter(max int) *LengthFilter {
+	return &LengthFilter{max: max}
+}
+
+func (f *LengthFilter) Name() string { return "length" }
+
+func (f *LengthFilter) Check(msg models.MessagePayload) Result {
+	if utf8.RuneCountInString(msg.Message) <= f.max {
+		return Result{}
+	}
+	return Result{Action: Reject, Code: models.ErrorCodeMessageTooLong,
+		Reason: "Messages are limited to " + strconv.Itoa(f.max) + " characters"}
+}
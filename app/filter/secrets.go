@@ -0,0 +1,103 @@
+package filter
+
+import (
+	"go-chat-app/app/models"
+	"regexp"
+)
+
+const redacted = "[REDACTED]"
+
+// secretPatterns match credentials that tend to be pasted into chat by
+// mistake.
+var secretPatterns = []*regexp.Regexp{
+	// AWS access key ids
+	regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`),
+	// GitHub tokens
+	regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,}\b`),
+	regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,}\b`),
+	// Slack tokens
+	regexp.MustCompile(`\bxox[abposr]-[A-Za-z0-9-]{10,}`),
+	// Stripe keys
+	regexp.MustCompile(`\b[rsp]k_(?:live|test)_[A-Za-z0-9]{16,}\b`),
+	// OpenAI and other sk- keys
+	regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{20,}`),
+	// Google API keys
+	regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	// JSON Web Tokens, such as the access tokens of this application
+	regexp.MustCompile(`\beyJ[A-Za-z0-9_-]{10,}\.eyJ[A-Za-z0-9_-]{10,}\.[A-Za-z0-9_-]{10,}`),
+	// PEM private keys, up to the end of the message when cut off
+	regexp.MustCompile(`-----BEGIN[A-Z ]* PRIVATE KEY-----(?s:.*?)(?:-----END[A-Z ]* PRIVATE KEY-----|$)`),
+}
+
+// cardNumber matches 13 to 19 digits, optionally grouped by spaces or
+// dashes. Only those passing the Luhn check count as card numbers.
+var cardNumber = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+// SecretFilter finds API keys, tokens, private keys and card numbers and,
+// depending on its action, masks, flags or rejects them.
+type SecretFilter struct {
+	action   string
+	patterns []*regexp.Regexp
+}
+
+// NewSecretFilter matches the built-in patterns and the extra ones.
+func NewSecretFilter(action string, extra []string) (*SecretFilter, error) {
+	patterns := append([]*regexp.Regexp{}, secretPatterns...)
+	for _, expr := range extra {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, pattern)
+	}
+	return &SecretFilter{action: action, patterns: patterns}, nil
+}
+
+func (f *SecretFilter) Name() string { return "secrets" }
+
+func (f *SecretFilter) Check(msg models.MessagePayload) Result {
+	text, found := f.redact(msg.Message)
+	if !found {
+		return Result{}
+	}
+	return matched(f.action, text, models.ErrorCodeSecret, "Messages must not contain secrets such as API keys or card numbers")
+}
+
+// redact replaces every secret in s and reports whether there was one.
+func (f *SecretFilter) redact(s string) (string, bool) {
+	found := false
+	for _, pattern := range f.patterns {
+		s = pattern.ReplaceAllStringFunc(s, func(string) string {
+			found = true
+			return redacted
+		})
+	}
+	s = cardNumber.ReplaceAllStringFunc(s, func(match string) string {
+		if !luhn(match) {
+			return match
+		}
+		found = true
+		return redacted
+	})
+	return s, found
+}
+
+// luhn reports whether the digits in s pass the Luhn check of card numbers.
+func luhn(s string) bool {
+	sum, n := 0, 0
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+		d := int(s[i] - '0')
+		if n%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,77 @@
+package filter
+
+import (
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/config"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// profanity is the list config.FilterConfig.Profanity adds.
+var profanity = []string{
+	"asshole", "bastard", "bitch", "bullshit", "cunt", "fuck", "fucked", "fucking", "motherfucker", "shit",
+	"wanker",
+}
+
+// wordRule is the word filter of a room. A nil pattern matches nothing.
+type wordRule struct {
+	action  string
+	pattern *regexp.Regexp
+}
+
+// WordFilter finds blocked words and, depending on the room's action, masks,
+// flags or rejects them. Words match whole and ignoring case.
+type WordFilter struct {
+	rule  wordRule
+	rooms map[string]wordRule
+}
+
+// NewWordFilter returns nil when no room blocks any word.
+func NewWordFilter(cfg config.FilterConfig) *WordFilter {
+	f := &WordFilter{rule: newWordRule(cfg.WordsAction, cfg.Words, cfg.Profanity), rooms: make(map[string]wordRule)}
+	active := f.rule.pattern != nil
+	for room, rc := range cfg.Rooms {
+		action := cfg.WordsAction
+		if rc.Action != "" {
+			action = rc.Action
+		}
+		rule := newWordRule(action, append(append([]string{}, cfg.Words...), rc.Words...), cfg.Profanity || rc.Profanity)
+		f.rooms[room] = rule
+		active = active || rule.pattern != nil
+	}
+	if !active {
+		return nil
+	}
+	return f
+}
+
+func newWordRule(action string, words []string, withProfanity bool) wordRule {
+	if withProfanity {
+		words = append(words, profanity...)
+	}
+	if action == config.FilterActionOff || len(words) == 0 {
+		return wordRule{action: action}
+	}
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		quoted = append(quoted, regexp.QuoteMeta(word))
+	}
+	return wordRule{action: action, pattern: regexp.MustCompile(`(?i)\b(?:` + strings.Join(quoted, "|") + `)\b`)}
+}
+
+func (f *WordFilter) Name() string { return "words" }
+
+func (f *WordFilter) Check(msg models.MessagePayload) Result {
+	rule, ok := f.rooms[msg.Room]
+	if !ok {
+		rule = f.rule
+	}
+	if rule.pattern == nil || !rule.pattern.MatchString(msg.Message) {
+		return Result{}
+	}
+	masked := rule.pattern.ReplaceAllStringFunc(msg.Message, func(word string) string {
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	})
+	return matched(rule.action, masked, models.ErrorCodeBlockedWords, "Your message contains blocked words")
+}
@@ -0,0 +1,189 @@
+// Package flood protects the WebSocket from clients that send too much. It
+// rate limits inbound frames per connection and per user with token buckets,
+// caps the connections of a user, and escalates against a user who keeps
+// exceeding the limits: a warning first, then a temporary mute, then
+// disconnection.
+package flood
+
+import (
+	"errors"
+	"go-chat-app/pkg/config"
+	"sync"
+	"time"
+)
+
+// ErrTooManyConnections is returned by Connect when the user has
+// config.FloodConfig.MaxConnections connections open already.
+var ErrTooManyConnections = errors.New("too many connections")
+
+// Verdict is what becomes of a frame.
+type Verdict int
+
+const (
+	// Allow lets the frame through.
+	Allow Verdict = iota
+	// Drop drops the frame.
+	Drop
+	// Warn drops the frame, the first one over the limit; the sender should
+	// be told to slow down.
+	Warn
+	// Mute drops the frame, which got the user muted.
+	Mute
+	// Disconnect drops the frame, which got the connection closed.
+	Disconnect
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Drop:
+		return "drop"
+	case Warn:
+		return "warn"
+	case Mute:
+		return "mute"
+	case Disconnect:
+		return "disconnect"
+	default:
+		return "allow"
+	}
+}
+
+// bucket holds up to burst tokens and gains rate of them per second.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(burst int, now time.Time) bucket {
+	return bucket{tokens: float64(burst), last: now}
+}
+
+// refill adds the tokens earned since the last refill.
+func (b *bucket) refill(rate, burst int, now time.Time) {
+	b.tokens = min(float64(burst), b.tokens+now.Sub(b.last).Seconds()*float64(rate))
+	b.last = now
+}
+
+// user is the state shared by the connections of a user.
+type user struct {
+	bucket     bucket
+	conns      int
+	strikes    int
+	lastStrike time.Time
+	mutedUntil time.Time
+}
+
+// idle reports whether u holds nothing worth remembering once it has no
+// connections left.
+func (u *user) idle(now time.Time, window time.Duration) bool {
+	return !now.Before(u.mutedUntil) && now.Sub(u.lastStrike) >= window
+}
+
+// Guard keeps the buckets and strikes of the users connected to this
+// process.
+type Guard struct {
+	cfg   config.FloodConfig
+	mu    sync.Mutex
+	users map[uint]*user
+	now   func() time.Time
+}
+
+func NewGuard(cfg config.FloodConfig) *Guard {
+	return &Guard{cfg: cfg, users: make(map[uint]*user), now: time.Now}
+}
+
+// MaxFrameSize is the size in bytes of the largest frame to read.
+func (g *Guard) MaxFrameSize() int64 {
+	return int64(g.cfg.MaxFrameSize)
+}
+
+// Connect opens a connection of the user. The returned Conn must be closed
+// when the connection ends.
+func (g *Guard) Connect(userId uint) (*Conn, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	u, ok := g.users[userId]
+	if !ok {
+		u = &user{bucket: newBucket(g.cfg.UserBurst, now)}
+		g.users[userId] = u
+	}
+	if g.cfg.MaxConnections > 0 && u.conns >= g.cfg.MaxConnections {
+		return nil, ErrTooManyConnections
+	}
+	u.conns++
+	return &Conn{guard: g, userId: userId, user: u, bucket: newBucket(g.cfg.ConnBurst, now)}, nil
+}
+
+// Conn limits the frames of one connection.
+type Conn struct {
+	guard  *Guard
+	userId uint
+	user   *user
+	bucket bucket
+	closed bool
+}
+
+// Allow takes a token from the connection and from its user for a frame
+// and decides what becomes of the frame. Without tokens the user earns a
+// strike, and the verdict says how far the escalation went.
+func (c *Conn) Allow() Verdict {
+	g := c.guard
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := g.now()
+	c.bucket.refill(g.cfg.ConnRate, g.cfg.ConnBurst, now)
+	c.user.bucket.refill(g.cfg.UserRate, g.cfg.UserBurst, now)
+	if c.bucket.tokens >= 1 && c.user.bucket.tokens >= 1 {
+		c.bucket.tokens--
+		c.user.bucket.tokens--
+		return Allow
+	}
+
+	u := c.user
+	if now.Sub(u.lastStrike) >= g.cfg.StrikeWindow {
+		u.strikes = 0
+	}
+	u.strikes++
+	u.lastStrike = now
+	switch {
+	case u.strikes >= g.cfg.DisconnectAfter:
+		return Disconnect
+	case u.strikes == g.cfg.MuteAfter:
+		u.mutedUntil = now.Add(g.cfg.MuteDuration)
+		return Mute
+	case u.strikes == 1:
+		return Warn
+	default:
+		return Drop
+	}
+}
+
+// MutedUntil returns when the mute of the user ends, if they are muted.
+func (c *Conn) MutedUntil() (time.Time, bool) {
+	g := c.guard
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return c.user.mutedUntil, g.now().Before(c.user.mutedUntil)
+}
+
+// Close ends the connection. The user is forgotten with their last
+// connection unless they are muted or have recent strikes, so reconnecting
+// does not start them over.
+func (c *Conn) Close() {
+	g := c.guard
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.user.conns--
+	if c.user.conns == 0 && c.user.idle(g.now(), g.cfg.StrikeWindow) {
+		delete(g.users, c.userId)
+	}
+}
@@ -0,0 +1,140 @@
+package flood
+
+import (
+	"errors"
+	"go-chat-app/pkg/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+var cfg = config.FloodConfig{
+	UserRate:        4,
+	UserBurst:       6,
+	ConnRate:        2,
+	ConnBurst:       4,
+	MaxFrameSize:    1024,
+	MaxConnections:  2,
+	MuteAfter:       3,
+	MuteDuration:    time.Minute,
+	DisconnectAfter: 5,
+	StrikeWindow:    time.Minute,
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newGuard() (*Guard, *clock) {
+	c := &clock{now: time.Now()}
+	g := NewGuard(cfg)
+	g.now = c.Now
+	return g, c
+}
+
+func connect(t *testing.T, g *Guard, userId uint) *Conn {
+	t.Helper()
+	conn, err := g.Connect(userId)
+	if err != nil {
+		t.Fatalf("Connect(%d): %v", userId, err)
+	}
+	return conn
+}
+
+func allow(conn *Conn, n int) []Verdict {
+	verdicts := make([]Verdict, n)
+	for i := range verdicts {
+		verdicts[i] = conn.Allow()
+	}
+	return verdicts
+}
+
+func TestConnBurst(t *testing.T) {
+	g, c := newGuard()
+	conn := connect(t, g, 1)
+
+	got := allow(conn, 5)
+	want := []Verdict{Allow, Allow, Allow, Allow, Warn}
+	if !slices.Equal(got, want) {
+		t.Fatalf("verdicts = %v, want %v", got, want)
+	}
+
+	c.now = c.now.Add(time.Second)
+	if got := allow(conn, 3); !slices.Equal(got, []Verdict{Allow, Allow, Drop}) {
+		t.Errorf("after a second, verdicts = %v, want two allowed", got)
+	}
+}
+
+func TestUserBucketIsShared(t *testing.T) {
+	g, _ := newGuard()
+	first, second := connect(t, g, 1), connect(t, g, 1)
+
+	allow(first, 4)
+	if got := allow(second, 3); !slices.Equal(got, []Verdict{Allow, Allow, Warn}) {
+		t.Errorf("second connection verdicts = %v, want the user's last two tokens", got)
+	}
+	if v := connect(t, g, 2).Allow(); v != Allow {
+		t.Errorf("other user got %v", v)
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	g, c := newGuard()
+	conn := connect(t, g, 1)
+	allow(conn, 4)
+
+	got := allow(conn, 5)
+	want := []Verdict{Warn, Drop, Mute, Drop, Disconnect}
+	if !slices.Equal(got, want) {
+		t.Fatalf("verdicts = %v, want %v", got, want)
+	}
+	until, muted := conn.MutedUntil()
+	if !muted || !until.Equal(c.now.Add(cfg.MuteDuration)) {
+		t.Errorf("MutedUntil = %v, %v, want muted for %v", until, muted, cfg.MuteDuration)
+	}
+
+	c.now = c.now.Add(cfg.MuteDuration)
+	if _, muted := conn.MutedUntil(); muted {
+		t.Error("mute did not expire")
+	}
+	allow(conn, 4)
+	if v := conn.Allow(); v != Warn {
+		t.Errorf("after the strike window, verdict = %v, want a new warning", v)
+	}
+}
+
+func TestMaxConnections(t *testing.T) {
+	g, _ := newGuard()
+	first := connect(t, g, 1)
+	connect(t, g, 1)
+
+	if _, err := g.Connect(1); !errors.Is(err, ErrTooManyConnections) {
+		t.Fatalf("third Connect error = %v, want ErrTooManyConnections", err)
+	}
+	first.Close()
+	first.Close()
+	connect(t, g, 1)
+	if _, err := g.Connect(1); !errors.Is(err, ErrTooManyConnections) {
+		t.Errorf("Close released more than one connection")
+	}
+}
+
+func TestCloseKeepsStrikes(t *testing.T) {
+	g, c := newGuard()
+	conn := connect(t, g, 1)
+	allow(conn, 4+cfg.MuteAfter)
+	conn.Close()
+
+	conn = connect(t, g, 1)
+	if _, muted := conn.MutedUntil(); !muted {
+		t.Error("reconnecting lifted the mute")
+	}
+	conn.Close()
+
+	c.now = c.now.Add(cfg.StrikeWindow)
+	conn = connect(t, g, 1)
+	conn.Close()
+	if len(g.users) != 0 {
+		t.Errorf("%d users remembered after their strikes expired", len(g.users))
+	}
+}
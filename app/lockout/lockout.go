@@ -0,0 +1,116 @@
+// Package lockout slows down password and two-factor guessing. It counts
+// failed logins per username and per client IP, makes a key wait longer
+// after every failure past its free attempts, and locks it for a while once
+// it failed too often.
+package lockout
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/logger"
+	"strings"
+	"time"
+)
+
+// policy is how many failures a kind of key gets for free and at how many it
+// is locked.
+type policy struct {
+	kind         string
+	free         int
+	lockoutAfter int
+}
+
+// Guard decides whether a login may be attempted.
+type Guard struct {
+	attempts repositories.LoginAttemptRepository
+	user, ip policy
+	backoff  time.Duration
+	duration time.Duration
+	now      func() time.Time
+}
+
+func NewGuard(attempts repositories.LoginAttemptRepository, cfg config.LoginConfig) *Guard {
+	return &Guard{
+		attempts: attempts,
+		user:     policy{kind: "user", free: cfg.UserFreeAttempts, lockoutAfter: cfg.UserLockoutAfter},
+		ip:       policy{kind: "ip", free: cfg.IPFreeAttempts, lockoutAfter: cfg.IPLockoutAfter},
+		backoff:  cfg.Backoff,
+		duration: cfg.LockoutDuration,
+		now:      time.Now,
+	}
+}
+
+// Check returns how long the username or the IP must wait before their next
+// attempt, or zero if they may try now. Unknown usernames are counted like
+// known ones, so the answer tells nothing about which accounts exist.
+func (g *Guard) Check(ctx context.Context, username, ip string) (time.Duration, error) {
+	now := g.now()
+	var wait time.Duration
+	for _, k := range g.keys(username, ip) {
+		attempt, err := g.attempts.GetLoginAttempt(ctx, k.key, now.Add(-g.duration))
+		if errors.Is(err, repositories.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		wait = max(wait, attempt.LastFailureAt.Add(g.delay(k.policy, attempt.Failures)).Sub(now))
+	}
+	return wait, nil
+}
+
+// Fail records a failed attempt. Reaching the lockout threshold is
+// audit-logged.
+func (g *Guard) Fail(ctx context.Context, username, ip string) error {
+	now := g.now()
+	for _, k := range g.keys(username, ip) {
+		attempt, err := g.attempts.RecordLoginFailure(ctx, k.key, now, now.Add(-g.duration))
+		if err != nil {
+			return err
+		}
+		if attempt.Failures == k.lockoutAfter {
+			logger.Audit(ctx, "login locked out", "username", username, "ip", ip, "key", k.kind,
+				"failures", attempt.Failures, "until", now.Add(g.duration))
+		}
+	}
+	return nil
+}
+
+// Succeed forgets the failures of the username. Those of the IP stay, so
+// that logging into one account does not earn more guesses at others.
+func (g *Guard) Succeed(ctx context.Context, username string) error {
+	return g.attempts.ClearLoginAttempts(ctx, userKey(username))
+}
+
+// delay is how long after its last failure a key with the given number of
+// failures must wait.
+func (g *Guard) delay(p policy, failures int) time.Duration {
+	switch {
+	case failures >= p.lockoutAfter:
+		return g.duration
+	case failures <= p.free:
+		return 0
+	}
+	delay := g.backoff
+	for i := p.free + 1; i < failures && delay < g.duration; i++ {
+		delay *= 2
+	}
+	return min(delay, g.duration)
+}
+
+type key struct {
+	policy
+	key string
+}
+
+func (g *Guard) keys(username, ip string) []key {
+	return []key{{g.user, userKey(username)}, {g.ip, "ip:" + ip}}
+}
+
+// userKey is the key of a username. Usernames are compared case-insensitively
+// by the database, so every spelling of one counts as the same key.
+func userKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
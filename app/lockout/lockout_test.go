@@ -0,0 +1,135 @@
+package lockout
+
+import (
+	"context"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/config"
+	"testing"
+	"time"
+)
+
+var cfg = config.LoginConfig{
+	UserFreeAttempts: 3,
+	UserLockoutAfter: 6,
+	IPFreeAttempts:   5,
+	IPLockoutAfter:   8,
+	Backoff:          time.Second,
+	LockoutDuration:  time.Minute,
+}
+
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func newGuard() (*Guard, *clock) {
+	c := &clock{now: time.Now()}
+	g := NewGuard(repositories.NewMemoryLoginAttemptRepository(), cfg)
+	g.now = c.Now
+	return g, c
+}
+
+func check(t *testing.T, g *Guard, username, ip string) time.Duration {
+	t.Helper()
+	wait, err := g.Check(context.Background(), username, ip)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	return wait
+}
+
+func fail(t *testing.T, g *Guard, username, ip string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := g.Fail(context.Background(), username, ip); err != nil {
+			t.Fatalf("Fail: %v", err)
+		}
+	}
+}
+
+func TestBackoffAndLockout(t *testing.T) {
+	g, c := newGuard()
+
+	fail(t, g, "alice01", "192.0.2.1", 3)
+	if wait := check(t, g, "alice01", "192.0.2.1"); wait != 0 {
+		t.Errorf("wait after the free attempts = %v, want 0", wait)
+	}
+	// Past the free attempts the wait doubles with every failure.
+	for _, want := range []time.Duration{time.Second, 2 * time.Second} {
+		fail(t, g, "alice01", "192.0.2.1", 1)
+		if wait := check(t, g, "alice01", "192.0.2.1"); wait != want {
+			t.Errorf("wait = %v, want %v", wait, want)
+		}
+	}
+	fail(t, g, "alice01", "192.0.2.1", 1)
+	if wait := check(t, g, "alice01", "192.0.2.1"); wait != time.Minute {
+		t.Errorf("wait when locked = %v, want %v", wait, time.Minute)
+	}
+
+	// The lockout is per username, whichever IP tries.
+	if wait := check(t, g, "alice01", "198.51.100.7"); wait != time.Minute {
+		t.Errorf("locked username from another IP waits %v", wait)
+	}
+	if wait := check(t, g, "bob0001", "198.51.100.7"); wait != 0 {
+		t.Errorf("another username waits %v", wait)
+	}
+
+	c.now = c.now.Add(time.Minute + time.Second)
+	if wait := check(t, g, "alice01", "192.0.2.1"); wait != 0 {
+		t.Errorf("wait after the lockout = %v, want 0", wait)
+	}
+	fail(t, g, "alice01", "198.51.100.7", 1)
+	if wait := check(t, g, "alice01", "198.51.100.7"); wait != 0 {
+		t.Errorf("failures were not forgotten after the lockout: wait %v", wait)
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	g, _ := newGuard()
+
+	// Spreading guesses over usernames is caught by the IP count.
+	for i := 0; i < cfg.IPLockoutAfter; i++ {
+		fail(t, g, string(rune('a'+i))+"user01", "192.0.2.1", 1)
+	}
+	if wait := check(t, g, "zuser01", "192.0.2.1"); wait != time.Minute {
+		t.Errorf("wait of a locked IP = %v, want %v", wait, time.Minute)
+	}
+	if wait := check(t, g, "zuser01", "192.0.2.2"); wait != 0 {
+		t.Errorf("another IP waits %v", wait)
+	}
+}
+
+func TestSucceedClearsUsername(t *testing.T) {
+	g, _ := newGuard()
+
+	fail(t, g, "alice01", "192.0.2.1", 5)
+	if err := g.Succeed(context.Background(), "alice01"); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+	if wait := check(t, g, "alice01", "192.0.2.9"); wait != 0 {
+		t.Errorf("wait after a successful login = %v, want 0", wait)
+	}
+	// The IP keeps its failures.
+	fail(t, g, "bob0001", "192.0.2.1", 1)
+	if wait := check(t, g, "bob0001", "192.0.2.1"); wait != time.Second {
+		t.Errorf("wait of the IP = %v, want %v", wait, time.Second)
+	}
+}
+
+func TestUsernameCase(t *testing.T) {
+	g, _ := newGuard()
+
+	// Other spellings of a username share its count rather than each
+	// getting their own attempts.
+	for _, username := range []string{"alice01", "Alice01", "ALICE01", "aLiCe01", "AlIcE01", "alicE01"} {
+		fail(t, g, username, "192.0.2.1", 1)
+	}
+	if wait := check(t, g, "ALIce01", "198.51.100.7"); wait != time.Minute {
+		t.Errorf("wait of another spelling = %v, want %v", wait, time.Minute)
+	}
+	if err := g.Succeed(context.Background(), "alice01"); err != nil {
+		t.Fatalf("Succeed: %v", err)
+	}
+	if wait := check(t, g, "ALICE01", "198.51.100.7"); wait != 0 {
+		t.Errorf("wait after a successful login = %v, want 0", wait)
+	}
+}
@@ -1,9 +1,106 @@
 package models
 
-import "time"
+import (
+	"strconv"
+	"time"
+)
 
+// MessagePayload is a chat message as sent over the WebSocket and returned by
+// the history API. An empty Room is the default, global room. Id is assigned
+// by the message store and only set on messages read from it.
 type MessagePayload struct {
-	From    string    `json:"from"`
-	Message string    `json:"message"`
-	Date    time.Time `json:"date"`
+	Id      string    `json:"id,omitempty" bson:"-"`
+	Room    string    `json:"room,omitempty" bson:"room,omitempty"`
+	From    string    `json:"from" bson:"from"`
+	Message string    `json:"message" bson:"message"`
+	Date    time.Time `json:"date" bson:"date"`
+}
+
+// Message is the relational representation of a MessagePayload, used when
+// messages are stored in SQL instead of MongoDB.
+type Message struct {
+	Id      uint      `gorm:"primaryKey"`
+	Room    string    `gorm:"type:varchar(100);not null;default:'';index:idx_messages_room_date,priority:1"`
+	From    string    `gorm:"column:sender;type:varchar(20);not null"`
+	Message string    `gorm:"type:text;not null"`
+	Date    time.Time `gorm:"not null;index:idx_messages_room_date,priority:2;index:idx_messages_date"`
+}
+
+func NewMessage(payload MessagePayload) Message {
+	return Message{
+		Room:    payload.Room,
+		From:    payload.From,
+		Message: payload.Message,
+		Date:    payload.Date.UTC(),
+	}
+}
+
+func (m Message) Payload() MessagePayload {
+	return MessagePayload{
+		Id:      strconv.FormatUint(uint64(m.Id), 10),
+		Room:    m.Room,
+		From:    m.From,
+		Message: m.Message,
+		Date:    m.Date,
+	}
+}
+
+// Frame types. Clients send messages, which carry no type, and join and leave
+// frames; the server sends messages, error frames and moderation events.
+const (
+	FrameTypeJoin       = "join"
+	FrameTypeLeave      = "leave"
+	FrameTypeError      = "error"
+	FrameTypeModeration = "moderation"
+)
+
+// ClientFrame is a frame read from a WebSocket client. A join or leave frame
+// names only the room.
+type ClientFrame struct {
+	Type string `json:"type,omitempty"`
+	MessagePayload
+}
+
+// Error codes of an ErrorFrame.
+const (
+	ErrorCodeForbidden  = "forbidden"
+	ErrorCodeMuted      = "muted"
+	ErrorCodeBanned     = "banned"
+	ErrorCodeBadRequest = "bad_request"
+	// Codes of messages the content filters reject.
+	ErrorCodeMessageTooLong = "message_too_long"
+	ErrorCodeEmptyMessage   = "empty_message"
+	ErrorCodeSecret         = "secret_detected"
+	ErrorCodeBlockedWords   = "blocked_words"
+	// ErrorCodeRateLimited warns a client that sends frames too fast.
+	ErrorCodeRateLimited = "rate_limited"
+)
+
+// ErrorFrame tells a WebSocket client why its message was refused. Clients
+// act on Code; Message is meant for people.
+type ErrorFrame struct {
+	Type    string `json:"type"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Room    string `json:"room,omitempty"`
+}
+
+func NewErrorFrame(code, room, message string) ErrorFrame {
+	return ErrorFrame{Type: FrameTypeError, Code: code, Message: message, Room: room}
+}
+
+// ModerationEvent tells a room that a user was sanctioned or that a sanction
+// was lifted. Moderator is empty when a sanction expired.
+type ModerationEvent struct {
+	Type      string           `json:"type"`
+	Action    ModerationAction `json:"action"`
+	Room      string           `json:"room,omitempty"`
+	Username  string           `json:"username"`
+	Moderator string           `json:"moderator,omitempty"`
+	Reason    string           `json:"reason,omitempty"`
+	ExpiresAt *time.Time       `json:"expires_at,omitempty"`
+}
+
+func NewModerationEvent(action ModerationAction, room, username, moderator string) ModerationEvent {
+	return ModerationEvent{Type: FrameTypeModeration, Action: action, Room: room, Username: username, Moderator: moderator}
 }
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// SanctionKind is what a moderator did to a user in a room.
+type SanctionKind string
+
+const (
+	// SanctionMute lets the user read the room but not send to it.
+	SanctionMute SanctionKind = "mute"
+	// SanctionKick removes the user from the room, which they may join
+	// again at once.
+	SanctionKick SanctionKind = "kick"
+	// SanctionBan removes the user from the room and keeps them out.
+	SanctionBan SanctionKind = "ban"
+)
+
+// Sanction records a moderation action against a user in a room, with the
+// moderator who took it and why. It is in force until ExpiresAt, or, when
+// that is nil, until it is lifted. Lifted sanctions are kept with LiftedAt
+// set; a kick takes effect once and is stored lifted.
+type Sanction struct {
+	Id          uint         `gorm:"primaryKey"`
+	Room        string       `gorm:"type:varchar(100);not null;default:'';index:idx_sanctions_room_user,priority:1"`
+	UserId      uint         `gorm:"type:int;index:idx_sanctions_room_user,priority:2"`
+	Kind        SanctionKind `gorm:"type:varchar(10)"`
+	ModeratorId uint         `gorm:"type:int"`
+	Reason      string       `gorm:"type:varchar(255)"`
+	ExpiresAt   *time.Time   `gorm:"index"`
+	LiftedAt    *time.Time
+	CreatedAt   time.Time
+}
+
+// Active reports whether the sanction is in force at now.
+func (s Sanction) Active(now time.Time) bool {
+	return s.LiftedAt == nil && (s.ExpiresAt == nil || s.ExpiresAt.After(now))
+}
+
+// SanctionResponse describes a sanction in force to a moderator.
+type SanctionResponse struct {
+	Id        uint         `json:"id"`
+	Room      string       `json:"room,omitempty"`
+	Username  string       `json:"username"`
+	Kind      SanctionKind `json:"kind"`
+	Moderator string       `json:"moderator"`
+	Reason    string       `json:"reason,omitempty"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// SanctionRequest mutes, kicks or bans a user. Duration is a Go duration
+// such as "30m"; without it a mute or ban lasts until it is lifted. Kicks
+// ignore it.
+type SanctionRequest struct {
+	Reason   string `json:"reason" validate:"max=255"`
+	Duration string `json:"duration"`
+}
+
+func (i SanctionRequest) Validate() error {
+	v := validator.New()
+	if err := v.Struct(i); err != nil {
+		return err
+	}
+	if i.Duration == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(i.Duration)
+	if err != nil {
+		return err
+	}
+	if d <= 0 {
+		return errors.New("duration must be positive")
+	}
+	return nil
+}
+
+// Until returns when a sanction requested at now expires, or nil if it does
+// not. The request must be valid.
+func (i SanctionRequest) Until(now time.Time) *time.Time {
+	if i.Duration == "" {
+		return nil
+	}
+	d, _ := time.ParseDuration(i.Duration)
+	until := now.Add(d)
+	return &until
+}
+
+// ModerationAction names a ModerationEvent: a SanctionKind, or one of the
+// actions lifting a sanction.
+type ModerationAction string
+
+const (
+	ModerationMute   ModerationAction = "mute"
+	ModerationUnmute ModerationAction = "unmute"
+	ModerationKick   ModerationAction = "kick"
+	ModerationBan    ModerationAction = "ban"
+	ModerationUnban  ModerationAction = "unban"
+)
+
+// LiftAction is the action lifting a sanction of kind.
+func LiftAction(kind SanctionKind) ModerationAction {
+	return "un" + ModerationAction(kind)
+}
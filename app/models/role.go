@@ -0,0 +1,94 @@
+package models
+
+import (
+	"time"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// Role grants a set of permissions, either globally or in one room. Roles are
+// ordered: each holds every permission of the roles below it. Globally a user
+// is an admin or a member; in a room they may also be a moderator or owner.
+type Role string
+
+const (
+	RoleMember    Role = "member"
+	RoleModerator Role = "moderator"
+	RoleOwner     Role = "owner"
+	RoleAdmin     Role = "admin"
+)
+
+// roleRanks orders the roles. An empty or unknown role ranks as a member.
+var roleRanks = map[Role]int{RoleMember: 0, RoleModerator: 1, RoleOwner: 2, RoleAdmin: 3}
+
+type Permission string
+
+const (
+	PermissionSendMessage   Permission = "message:send"
+	PermissionDeleteMessage Permission = "message:delete"
+	// PermissionModerate allows muting, kicking and banning users.
+	PermissionModerate Permission = "room:moderate"
+	// PermissionManageRoles allows granting and revoking room roles.
+	PermissionManageRoles Permission = "room:manage_roles"
+	// PermissionAdminister allows the admin API.
+	PermissionAdminister Permission = "system:administer"
+)
+
+// permissionRoles holds the lowest role with each permission.
+var permissionRoles = map[Permission]Role{
+	PermissionSendMessage:   RoleMember,
+	PermissionDeleteMessage: RoleModerator,
+	PermissionModerate:      RoleModerator,
+	PermissionManageRoles:   RoleOwner,
+	PermissionAdminister:    RoleAdmin,
+}
+
+// AtLeast reports whether r ranks as high as other.
+func (r Role) AtLeast(other Role) bool {
+	return roleRanks[r] >= roleRanks[other]
+}
+
+// Can reports whether r holds the permission p.
+func (r Role) Can(p Permission) bool {
+	lowest, ok := permissionRoles[p]
+	return ok && r.AtLeast(lowest)
+}
+
+// Max returns the higher of r and other.
+func (r Role) Max(other Role) Role {
+	if roleRanks[other] > roleRanks[r] {
+		return other
+	}
+	return r
+}
+
+// Global reports whether r can be held globally.
+func (r Role) Global() bool {
+	return r == RoleMember || r == RoleAdmin
+}
+
+// RoomRole grants a user a role in one room, above the member role everyone
+// holds there. An empty Room is the default room.
+type RoomRole struct {
+	Id        uint   `gorm:"primaryKey"`
+	Room      string `gorm:"type:varchar(100);not null;default:'';uniqueIndex:idx_room_roles_user,priority:1"`
+	UserId    uint   `gorm:"type:int;uniqueIndex:idx_room_roles_user,priority:2;index"`
+	Role      Role   `gorm:"type:varchar(20)"`
+	CreatedAt time.Time
+}
+
+// RoomMember is a user holding a role in a room.
+type RoomMember struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
+}
+
+// RoomRoleRequest grants a role in a room.
+type RoomRoleRequest struct {
+	Role Role `json:"role" validate:"required,oneof=moderator owner"`
+}
+
+func (i RoomRoleRequest) Validate() error {
+	v := validator.New()
+	return v.Struct(i)
+}
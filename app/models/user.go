@@ -1,6 +1,7 @@
 package models
 
 import (
+	"errors"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -13,6 +14,35 @@ type User struct {
 	FullName  string `json:"full_name" gorm:"type:varchar(100);" validate:"required,min=6"`
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	// Email is optional and unique. EmailVerifiedAt is set once the owner
+	// of the address followed the link mailed to it, and cleared when the
+	// address changes; password reset mails only go to verified addresses.
+	Email           *string    `json:"email,omitempty" gorm:"type:varchar(255);uniqueIndex" validate:"omitempty,email,max=255"`
+	EmailVerifiedAt *time.Time `json:"-"`
+	// DisabledAt is set when an operator disables the account. A disabled
+	// user cannot log in.
+	DisabledAt *time.Time `json:"-"`
+	// TwoFactorSecret is the TOTP secret, set on enrollment and in use from
+	// TwoFactorEnabledAt. TwoFactorLastStep is the time step of the last
+	// accepted code, which cannot be used again.
+	TwoFactorSecret    string     `json:"-" gorm:"type:varchar(64)"`
+	TwoFactorEnabledAt *time.Time `json:"-"`
+	TwoFactorLastStep  int64      `json:"-" gorm:"not null;default:0"`
+	// Role is the global role, admin or member. Roles in single rooms are
+	// RoomRoles.
+	Role Role `json:"-" gorm:"type:varchar(20);not null;default:member"`
+}
+
+func (i User) Disabled() bool {
+	return i.DisabledAt != nil
+}
+
+func (i User) EmailVerified() bool {
+	return i.Email != nil && i.EmailVerifiedAt != nil
+}
+
+func (i User) TwoFactorEnabled() bool {
+	return i.TwoFactorEnabledAt != nil
 }
 
 func (i User) Validate() error {
@@ -25,10 +55,15 @@ type UserSession struct {
 	CreatedAt           time.Time
 	UpdatedAt           time.Time
 	UserId              uint      `json:"user_id" gorm:"type:int" validate:"required"`
-	Token               string    `json:"token" gorm:"type:varchar(255)" validate:"required"`
-	RefreshToken        string    `json:"refresh_token" gorm:"type:varchar(255)" validate:"required"`
+	Token               string    `json:"token" gorm:"type:varchar(255)" validate:"required"`         // jti of the access token
+	RefreshToken        string    `json:"refresh_token" gorm:"type:varchar(255)" validate:"required"` // hashed, see jwt.HashToken
 	TokenExpired        time.Time `json:"-" validate:"required"`
 	RefreshTokenExpired time.Time `json:"-" validate:"required"`
+	// IP and UserAgent identify the client that logged in. LastUsedAt is
+	// updated whenever the session's tokens are refreshed.
+	IP         string    `json:"ip" gorm:"type:varchar(45)"`
+	UserAgent  string    `json:"user_agent" gorm:"type:varchar(255)"`
+	LastUsedAt time.Time `json:"last_used_at"`
 }
 
 func (i UserSession) Validate() error {
@@ -36,8 +71,122 @@ func (i UserSession) Validate() error {
 	return v.Struct(i)
 }
 
+// RotatedRefreshToken remembers a refresh token that was exchanged for a new
+// one. The session it belonged to is its token family: presenting it again
+// means a copy leaked, and the family is revoked.
+type RotatedRefreshToken struct {
+	Id        uint      `gorm:"primaryKey"`
+	SessionId uint      `gorm:"type:int;index"`
+	UserId    uint      `gorm:"type:int"`
+	TokenHash string    `gorm:"type:varchar(64);index"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// RevokedToken marks an access token, by its jti, as unusable until it
+// expires.
+type RevokedToken struct {
+	Id        string    `gorm:"primaryKey;type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// RecoveryCode is a single-use code that stands in for a TOTP code when the
+// authenticator is lost. Only its hash is stored, see totp.HashRecoveryCode.
+type RecoveryCode struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"type:int;index"`
+	CodeHash  string `gorm:"type:varchar(64)"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// ExternalIdentity links an account at an OpenID Connect provider, named by
+// its issuer and subject, to a user.
+type ExternalIdentity struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"type:int;index"`
+	Issuer    string `gorm:"type:varchar(255);uniqueIndex:idx_external_identities_subject"`
+	Subject   string `gorm:"type:varchar(255);uniqueIndex:idx_external_identities_subject"`
+	Email     string `gorm:"type:varchar(255)"`
+	CreatedAt time.Time
+}
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// AccountToken is a single-use, time-limited token mailed to a user to verify
+// their email address or reset their password. Only its hash is stored, see
+// jwt.HashToken. Email is the address the token was sent to, so that a
+// verification token stops working when the address changes.
+type AccountToken struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"type:int;index"`
+	Purpose   string `gorm:"type:varchar(20)"`
+	TokenHash string `gorm:"type:varchar(64);uniqueIndex"`
+	Email     string `gorm:"type:varchar(255)"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// LoginAttempt counts the failed logins of a username or client IP, named by
+// Id, such as "user:alice01" or "ip:192.0.2.1", since the count was last
+// cleared.
+type LoginAttempt struct {
+	Id            string    `gorm:"primaryKey;type:varchar(128)"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"index"`
+}
+
+// UserResponse describes an account to an admin. Secrets are never listed.
+type UserResponse struct {
+	Id               uint       `json:"id"`
+	Username         string     `json:"username"`
+	FullName         string     `json:"full_name"`
+	Email            *string    `json:"email,omitempty"`
+	EmailVerified    bool       `json:"email_verified"`
+	Role             Role       `json:"role"`
+	DisabledAt       *time.Time `json:"disabled_at,omitempty"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+func NewUserResponse(user User) UserResponse {
+	return UserResponse{
+		Id:               user.Id,
+		Username:         user.Username,
+		FullName:         user.FullName,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerified(),
+		Role:             user.Role,
+		DisabledAt:       user.DisabledAt,
+		TwoFactorEnabled: user.TwoFactorEnabled(),
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+// UserStats counts the accounts.
+type UserStats struct {
+	Total    int64 `json:"total"`
+	Disabled int64 `json:"disabled"`
+	Admins   int64 `json:"admins"`
+}
+
+// SessionResponse describes one active session of the caller. Tokens are
+// never listed.
+type SessionResponse struct {
+	Id         uint      `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Current    bool      `json:"current"`
+}
+
 type LoginRequest struct {
-	Username string `json:"username" validate:"required"`
+	Username string `json:"username" validate:"required,max=20"`
 	Password string `json:"password" validate:"required"`
 }
 
@@ -46,14 +195,86 @@ func (i LoginRequest) Validate() error {
 	return v.Struct(i)
 }
 
+// LoginResponse carries the session tokens, or, for an account with
+// two-factor authentication, only TwoFactorToken, which is exchanged for them
+// at /login/2fa.
 type LoginResponse struct {
-	Username     string `json:"username"`
-	FullName     string `json:"full_name"`
-	Token        string `json:"token"`
-	RefreshToken string `json:"refresh_token"`
+	Username          string `json:"username"`
+	FullName          string `json:"full_name"`
+	Token             string `json:"token,omitempty"`
+	RefreshToken      string `json:"refresh_token,omitempty"`
+	TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+	TwoFactorToken    string `json:"two_factor_token,omitempty"`
 }
 
 func (i LoginResponse) Validate() error {
 	v := validator.New()
 	return v.Struct(i)
 }
+
+// EmailRequest names an email address to request a password reset for the
+// account it belongs to.
+type EmailRequest struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+func (i EmailRequest) Validate() error {
+	v := validator.New()
+	return v.Struct(i)
+}
+
+// EmailChangeRequest sets the caller's email address. Reset links go to that
+// address, so the caller proves to hold the account with CurrentPassword or,
+// with two-factor authentication enabled, a code or recovery code.
+type EmailChangeRequest struct {
+	Email           string `json:"email" validate:"required,email,max=255"`
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+	RecoveryCode    string `json:"recovery_code"`
+}
+
+func (i EmailChangeRequest) Validate() error {
+	v := validator.New()
+	if err := v.Struct(i); err != nil {
+		return err
+	}
+	if i.CurrentPassword == "" && i.Code == "" && i.RecoveryCode == "" {
+		return errors.New("current_password, code or recovery_code is required")
+	}
+	return nil
+}
+
+// AccountTokenRequest presents the token from a verification or password
+// reset mail. Password is the new password and only used for a reset.
+type AccountTokenRequest struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"omitempty,min=6"`
+}
+
+func (i AccountTokenRequest) Validate() error {
+	v := validator.New()
+	return v.Struct(i)
+}
+
+// TwoFactorRequest proves possession of the second factor with either a TOTP
+// code or a recovery code. Token is the intermediate login token and only
+// used at /login/2fa.
+type TwoFactorRequest struct {
+	Token        string `json:"token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (i TwoFactorRequest) Validate() error {
+	if (i.Code == "") == (i.RecoveryCode == "") {
+		return errors.New("exactly one of code and recovery_code is required")
+	}
+	return nil
+}
+
+// TwoFactorEnrollment is returned when enrollment starts. The secret is shown
+// for manual entry; the QR code of URI is served at /2fa/qr.
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
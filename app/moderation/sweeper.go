@@ -0,0 +1,74 @@
+// Package moderation lifts expired mutes and bans and tells the rooms about
+// it. Sanctions are imposed through the room API and enforced by the
+// WebSocket hub.
+package moderation
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"time"
+)
+
+// Notifier applies moderation events to the WebSockets connected to this
+// instance and broadcasts them to the room.
+type Notifier interface {
+	Moderate(ctx context.Context, event models.ModerationEvent)
+}
+
+// Sweeper marks expired sanctions lifted. Lifting is idempotent across
+// instances: each expired sanction is lifted, and announced, by one of them.
+type Sweeper struct {
+	sanctions repositories.SanctionRepository
+	users     repositories.UserRepository
+	notifier  Notifier
+	interval  time.Duration
+	now       func() time.Time
+}
+
+func NewSweeper(sanctions repositories.SanctionRepository, users repositories.UserRepository, notifier Notifier, interval time.Duration) *Sweeper {
+	return &Sweeper{sanctions: sanctions, users: users, notifier: notifier, interval: interval, now: time.Now}
+}
+
+// Run sweeps every interval until ctx is cancelled.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.RunOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "moderation sweep failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce lifts the sanctions that have expired and returns how many.
+func (s *Sweeper) RunOnce(ctx context.Context) (int, error) {
+	tx, ctx := tracing.StartTransaction(ctx, "Moderation Sweep", "job")
+	defer tx.End()
+
+	lifted, err := s.sanctions.LiftExpiredSanctions(ctx, s.now())
+	if err != nil {
+		tx.RecordError(err)
+		return 0, err
+	}
+	for _, sanction := range lifted {
+		user, err := s.users.GetUserById(ctx, sanction.UserId)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to get sanctioned user", "user_id", sanction.UserId, "error", err)
+			continue
+		}
+		logger.Audit(ctx, "sanction expired", "room", sanction.Room, "username", user.Username, "kind", sanction.Kind,
+			"sanction_id", sanction.Id)
+		s.notifier.Moderate(ctx, models.NewModerationEvent(models.LiftAction(sanction.Kind), sanction.Room, user.Username, ""))
+	}
+	return len(lifted), nil
+}
@@ -0,0 +1,67 @@
+package moderation
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"slices"
+	"testing"
+	"time"
+)
+
+type recorder struct{ events []models.ModerationEvent }
+
+func (r *recorder) Moderate(ctx context.Context, event models.ModerationEvent) {
+	r.events = append(r.events, event)
+}
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	users := repositories.NewMemoryUserRepository()
+	sanctions := repositories.NewMemorySanctionRepository(users)
+	troll := &models.User{Username: "troll01", FullName: "Troll Under Bridge"}
+	if err := users.CreateUser(ctx, troll); err != nil {
+		t.Fatal(err)
+	}
+
+	at := func(d time.Duration) *time.Time {
+		at := now.Add(d)
+		return &at
+	}
+	for _, s := range []models.Sanction{
+		{Room: "ops", Kind: models.SanctionMute, ExpiresAt: at(-time.Minute)},
+		{Room: "dev", Kind: models.SanctionBan, ExpiresAt: at(-time.Second)},
+		{Room: "ops", Kind: models.SanctionBan, ExpiresAt: at(time.Hour)},
+		{Room: "", Kind: models.SanctionMute},
+	} {
+		s.UserId = troll.Id
+		s.CreatedAt = now.Add(-2 * time.Hour)
+		if err := sanctions.CreateSanction(ctx, &s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notifier := &recorder{}
+	sweeper := NewSweeper(sanctions, users, notifier, time.Minute)
+	sweeper.now = func() time.Time { return now }
+
+	lifted, err := sweeper.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if lifted != 2 {
+		t.Errorf("lifted %d sanctions, want 2", lifted)
+	}
+	want := []models.ModerationEvent{
+		models.NewModerationEvent(models.ModerationUnmute, "ops", "troll01", ""),
+		models.NewModerationEvent(models.ModerationUnban, "dev", "troll01", ""),
+	}
+	if !slices.Equal(notifier.events, want) {
+		t.Errorf("events = %+v, want %+v", notifier.events, want)
+	}
+
+	if lifted, _ := sweeper.RunOnce(ctx); lifted != 0 {
+		t.Errorf("second run lifted %d sanctions", lifted)
+	}
+}
@@ -0,0 +1,61 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type accountTokenRepository struct {
+	db *gorm.DB
+}
+
+// NewAccountTokenRepository returns an AccountTokenRepository on the
+// relational database.
+func NewAccountTokenRepository(db *gorm.DB) AccountTokenRepository {
+	return &accountTokenRepository{db: db}
+}
+
+func (r *accountTokenRepository) CreateAccountToken(ctx context.Context, token *models.AccountToken) error {
+
+	span, _ := tracing.StartSpan(ctx, "CreateAccountToken", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CreateAccountToken", time.Now())
+
+	return translateError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", token.UserId, token.Purpose).
+			Delete(&models.AccountToken{}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	}))
+}
+
+func (r *accountTokenRepository) UseAccountToken(ctx context.Context, purpose, hash string, now time.Time) (models.AccountToken, error) {
+
+	span, _ := tracing.StartSpan(ctx, "UseAccountToken", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("UseAccountToken", time.Now())
+
+	var token models.AccountToken
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Marking the token used first makes concurrent uses a
+		// compare-and-swap that only one of them wins.
+		result := tx.Model(&models.AccountToken{}).
+			Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", hash, purpose, now).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return tx.Where("token_hash = ?", hash).First(&token).Error
+	})
+	return token, translateError(err)
+}
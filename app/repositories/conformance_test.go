@@ -0,0 +1,1017 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-chat-app/app/models"
+	"slices"
+	"testing"
+	"time"
+)
+
+// The conformance suites describe the behaviour every implementation of a
+// repository interface must share. Each backend runs them from its own test.
+
+func testUserRepository(t *testing.T, newRepo func(t *testing.T) UserRepository) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		user := &models.User{Username: "alice01", Password: "hash", FullName: "Alice Liddell"}
+		if err := repo.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if user.Id == 0 {
+			t.Fatal("CreateUser did not assign an id")
+		}
+
+		got, err := repo.GetUserByUsername(ctx, "alice01")
+		if err != nil {
+			t.Fatalf("GetUserByUsername: %v", err)
+		}
+		if got.Id != user.Id || got.FullName != user.FullName || got.Password != user.Password {
+			t.Errorf("got %+v, want %+v", got, user)
+		}
+	})
+
+	t.Run("DuplicateUsername", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.CreateUser(ctx, &models.User{Username: "bob0001", Password: "x", FullName: "Bob Builder"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		err := repo.CreateUser(ctx, &models.User{Username: "bob0001", Password: "y", FullName: "Bob Again"})
+		if !errors.Is(err, ErrDuplicate) {
+			t.Errorf("expected ErrDuplicate, got %v", err)
+		}
+	})
+
+	t.Run("UnknownUser", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetUserByUsername(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+		if err := repo.SetUserDisabled(ctx, "nobody", true); !errors.Is(err, ErrNotFound) {
+			t.Errorf("SetUserDisabled: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.UpdateUserPassword(ctx, "nobody", "hash"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateUserPassword: expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("DisableAndEnable", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.CreateUser(ctx, &models.User{Username: "carol01", Password: "x", FullName: "Carol Danvers"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := repo.SetUserDisabled(ctx, "carol01", true); err != nil {
+			t.Fatalf("SetUserDisabled: %v", err)
+		}
+		if user, _ := repo.GetUserByUsername(ctx, "carol01"); !user.Disabled() {
+			t.Error("user is not disabled")
+		}
+		if err := repo.SetUserDisabled(ctx, "carol01", false); err != nil {
+			t.Fatalf("SetUserDisabled: %v", err)
+		}
+		if user, _ := repo.GetUserByUsername(ctx, "carol01"); user.Disabled() {
+			t.Error("user is still disabled")
+		}
+	})
+
+	t.Run("UpdatePassword", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.CreateUser(ctx, &models.User{Username: "dave001", Password: "old", FullName: "Dave Bowman"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := repo.UpdateUserPassword(ctx, "dave001", "new"); err != nil {
+			t.Fatalf("UpdateUserPassword: %v", err)
+		}
+		if user, _ := repo.GetUserByUsername(ctx, "dave001"); user.Password != "new" {
+			t.Errorf("password = %q, want %q", user.Password, "new")
+		}
+	})
+
+	t.Run("TwoFactor", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.CreateUser(ctx, &models.User{Username: "erin001", Password: "x", FullName: "Erin Brockovich"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := repo.UpdateTwoFactor(ctx, "erin001", "SECRET", false); err != nil {
+			t.Fatalf("UpdateTwoFactor: %v", err)
+		}
+		if user, _ := repo.GetUserByUsername(ctx, "erin001"); user.TwoFactorSecret != "SECRET" || user.TwoFactorEnabled() {
+			t.Errorf("pending enrollment: secret %q, enabled %v", user.TwoFactorSecret, user.TwoFactorEnabled())
+		}
+		if err := repo.UpdateTwoFactor(ctx, "erin001", "SECRET", true); err != nil {
+			t.Fatalf("UpdateTwoFactor: %v", err)
+		}
+		if user, _ := repo.GetUserByUsername(ctx, "erin001"); !user.TwoFactorEnabled() {
+			t.Error("two-factor authentication is not enabled")
+		}
+
+		if err := repo.UseTwoFactorStep(ctx, "erin001", 100); err != nil {
+			t.Fatalf("UseTwoFactorStep: %v", err)
+		}
+		for _, step := range []int64{100, 99} {
+			if err := repo.UseTwoFactorStep(ctx, "erin001", step); !errors.Is(err, ErrNotFound) {
+				t.Errorf("UseTwoFactorStep(%d) after 100: expected ErrNotFound, got %v", step, err)
+			}
+		}
+		if err := repo.UseTwoFactorStep(ctx, "erin001", 101); err != nil {
+			t.Errorf("UseTwoFactorStep(101): %v", err)
+		}
+
+		if err := repo.UpdateTwoFactor(ctx, "erin001", "", false); err != nil {
+			t.Fatalf("UpdateTwoFactor: %v", err)
+		}
+		if user, _ := repo.GetUserByUsername(ctx, "erin001"); user.TwoFactorSecret != "" || user.TwoFactorEnabled() {
+			t.Error("two-factor authentication is still set up")
+		}
+	})
+
+	t.Run("Email", func(t *testing.T) {
+		repo := newRepo(t)
+		address := "grace@example.com"
+		grace := &models.User{Username: "grace01", FullName: "Grace Hopper", Email: &address}
+		if err := repo.CreateUser(ctx, grace); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if err := repo.CreateUser(ctx, &models.User{Username: "grace02", FullName: "Grace Again", Email: &address}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("taken email: expected ErrDuplicate, got %v", err)
+		}
+		if err := repo.CreateUser(ctx, &models.User{Username: "henry01", FullName: "Henry Ford"}); err != nil {
+			t.Fatalf("CreateUser without email: %v", err)
+		}
+		if err := repo.CreateUser(ctx, &models.User{Username: "henry02", FullName: "Henry Again"}); err != nil {
+			t.Fatalf("second CreateUser without email: %v", err)
+		}
+
+		if got, err := repo.GetUserByEmail(ctx, address); err != nil || got.Id != grace.Id || got.EmailVerified() {
+			t.Errorf("GetUserByEmail = %+v, %v", got, err)
+		}
+		if got, err := repo.GetUserById(ctx, grace.Id); err != nil || got.Username != "grace01" {
+			t.Errorf("GetUserById = %+v, %v", got, err)
+		}
+		if err := repo.VerifyEmail(ctx, grace.Id, "other@example.com", time.Now()); !errors.Is(err, ErrNotFound) {
+			t.Errorf("VerifyEmail of another address: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.VerifyEmail(ctx, grace.Id, address, time.Now()); err != nil {
+			t.Fatalf("VerifyEmail: %v", err)
+		}
+		if got, _ := repo.GetUserByUsername(ctx, "grace01"); !got.EmailVerified() {
+			t.Error("email not verified after VerifyEmail")
+		}
+
+		if err := repo.UpdateEmail(ctx, "henry01", &address); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("UpdateEmail to a taken address: expected ErrDuplicate, got %v", err)
+		}
+		changed := "grace@example.org"
+		if err := repo.UpdateEmail(ctx, "grace01", &changed); err != nil {
+			t.Fatalf("UpdateEmail: %v", err)
+		}
+		if got, _ := repo.GetUserByUsername(ctx, "grace01"); got.Email == nil || *got.Email != changed || got.EmailVerified() {
+			t.Errorf("after UpdateEmail: email %v, verified %v", got.Email, got.EmailVerified())
+		}
+		if err := repo.UpdateEmail(ctx, "grace01", nil); err != nil {
+			t.Fatalf("UpdateEmail(nil): %v", err)
+		}
+		if got, _ := repo.GetUserByUsername(ctx, "grace01"); got.Email != nil {
+			t.Errorf("email %q kept after removing it", *got.Email)
+		}
+		if err := repo.UpdateEmail(ctx, "nobody", &changed); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateEmail of unknown user: expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("ExternalIdentities", func(t *testing.T) {
+		repo := newRepo(t)
+		user := &models.User{Username: "frank01", FullName: "Frank Poole"}
+		identity := &models.ExternalIdentity{Issuer: "https://idp.example", Subject: "42", Email: "frank@example.com"}
+		if err := repo.CreateUserWithIdentity(ctx, user, identity); err != nil {
+			t.Fatalf("CreateUserWithIdentity: %v", err)
+		}
+		if got, err := repo.GetUserByIdentity(ctx, "https://idp.example", "42"); err != nil || got.Id != user.Id {
+			t.Errorf("GetUserByIdentity = %+v, %v", got, err)
+		}
+		if _, err := repo.GetUserByIdentity(ctx, "https://other.example", "42"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("identity of another issuer: expected ErrNotFound, got %v", err)
+		}
+
+		// Neither the user nor the identity may be taken.
+		again := &models.ExternalIdentity{Issuer: "https://idp.example", Subject: "42"}
+		if err := repo.CreateUserWithIdentity(ctx, &models.User{Username: "frank02", FullName: "Frank Again"}, again); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("linked identity: expected ErrDuplicate, got %v", err)
+		}
+		if _, err := repo.GetUserByUsername(ctx, "frank02"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("user of a failed CreateUserWithIdentity was kept: %v", err)
+		}
+		taken := &models.ExternalIdentity{Issuer: "https://idp.example", Subject: "43"}
+		if err := repo.CreateUserWithIdentity(ctx, &models.User{Username: "frank01", FullName: "Frank Again"}, taken); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("taken username: expected ErrDuplicate, got %v", err)
+		}
+
+		if err := repo.LinkIdentity(ctx, &models.ExternalIdentity{UserId: user.Id, Issuer: "https://idp.example", Subject: "43"}); err != nil {
+			t.Fatalf("LinkIdentity: %v", err)
+		}
+		if got, err := repo.GetUserByIdentity(ctx, "https://idp.example", "43"); err != nil || got.Id != user.Id {
+			t.Errorf("GetUserByIdentity after linking = %+v, %v", got, err)
+		}
+		if err := repo.LinkIdentity(ctx, &models.ExternalIdentity{UserId: 99, Issuer: "https://idp.example", Subject: "43"}); !errors.Is(err, ErrDuplicate) {
+			t.Errorf("LinkIdentity twice: expected ErrDuplicate, got %v", err)
+		}
+	})
+
+	t.Run("RecoveryCodes", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.ReplaceRecoveryCodes(ctx, 1, []string{"a", "b"}); err != nil {
+			t.Fatalf("ReplaceRecoveryCodes: %v", err)
+		}
+		if err := repo.ReplaceRecoveryCodes(ctx, 2, []string{"a"}); err != nil {
+			t.Fatalf("ReplaceRecoveryCodes: %v", err)
+		}
+
+		if err := repo.UseRecoveryCode(ctx, 1, "a"); err != nil {
+			t.Fatalf("UseRecoveryCode: %v", err)
+		}
+		if err := repo.UseRecoveryCode(ctx, 1, "a"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("reused code: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.UseRecoveryCode(ctx, 2, "a"); err != nil {
+			t.Errorf("code of another user: %v", err)
+		}
+
+		if err := repo.ReplaceRecoveryCodes(ctx, 1, []string{"c"}); err != nil {
+			t.Fatalf("ReplaceRecoveryCodes: %v", err)
+		}
+		if err := repo.UseRecoveryCode(ctx, 1, "b"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("replaced code: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.UseRecoveryCode(ctx, 1, "c"); err != nil {
+			t.Errorf("UseRecoveryCode: %v", err)
+		}
+	})
+
+	t.Run("Roles", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.CreateUser(ctx, &models.User{Username: "grace01", FullName: "Grace Hopper"}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+		if got, _ := repo.GetUserByUsername(ctx, "grace01"); got.Role != models.RoleMember {
+			t.Errorf("new user has role %q, want member", got.Role)
+		}
+		if err := repo.SetUserRole(ctx, "grace01", models.RoleAdmin); err != nil {
+			t.Fatalf("SetUserRole: %v", err)
+		}
+		if got, _ := repo.GetUserByUsername(ctx, "grace01"); got.Role != models.RoleAdmin {
+			t.Errorf("role = %q, want admin", got.Role)
+		}
+		if err := repo.SetUserRole(ctx, "nobody", models.RoleAdmin); !errors.Is(err, ErrNotFound) {
+			t.Errorf("unknown user: expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("ListAndCount", func(t *testing.T) {
+		repo := newRepo(t)
+		email := "Ada@Example.com"
+		for _, user := range []*models.User{
+			{Username: "ada0001", FullName: "Ada Lovelace", Email: &email},
+			{Username: "charles", FullName: "Charles Babbage"},
+			{Username: "under_1", FullName: "Under Score"},
+		} {
+			if err := repo.CreateUser(ctx, user); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+		}
+		if err := repo.SetUserDisabled(ctx, "charles", true); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.SetUserRole(ctx, "ada0001", models.RoleAdmin); err != nil {
+			t.Fatal(err)
+		}
+
+		names := func(query UserQuery) []string {
+			t.Helper()
+			users, err := repo.ListUsers(ctx, query)
+			if err != nil {
+				t.Fatalf("ListUsers(%+v): %v", query, err)
+			}
+			var names []string
+			for _, user := range users {
+				names = append(names, user.Username)
+			}
+			return names
+		}
+		for _, tt := range []struct {
+			query UserQuery
+			want  []string
+		}{
+			{UserQuery{}, []string{"ada0001", "charles", "under_1"}},
+			{UserQuery{Limit: 1, Offset: 1}, []string{"charles"}},
+			{UserQuery{Offset: 5}, nil},
+			{UserQuery{Search: "BABBAGE"}, []string{"charles"}},
+			{UserQuery{Search: "example.com"}, []string{"ada0001"}},
+			// Wildcards in the search are literal.
+			{UserQuery{Search: "r_"}, []string{"under_1"}},
+			{UserQuery{Search: "%"}, nil},
+		} {
+			if got := names(tt.query); !slices.Equal(got, tt.want) {
+				t.Errorf("ListUsers(%+v) = %v, want %v", tt.query, got, tt.want)
+			}
+		}
+
+		stats, err := repo.CountUsers(ctx)
+		if err != nil || stats != (models.UserStats{Total: 3, Disabled: 1, Admins: 1}) {
+			t.Errorf("CountUsers = %+v, %v", stats, err)
+		}
+	})
+
+}
+
+func testAccountTokenRepository(t *testing.T, newRepo func(t *testing.T) AccountTokenRepository) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	now := time.Now()
+	token := func(hash string, expires time.Time) *models.AccountToken {
+		return &models.AccountToken{UserId: 1, Purpose: models.TokenPurposeResetPassword, TokenHash: hash, ExpiresAt: expires}
+	}
+	if err := repo.CreateAccountToken(ctx, token("first", now.Add(time.Hour))); err != nil {
+		t.Fatalf("CreateAccountToken: %v", err)
+	}
+	if err := repo.CreateAccountToken(ctx, token("second", now.Add(time.Hour))); err != nil {
+		t.Fatalf("CreateAccountToken: %v", err)
+	}
+	verify := &models.AccountToken{UserId: 1, Purpose: models.TokenPurposeVerifyEmail, TokenHash: "verify", ExpiresAt: now.Add(time.Hour)}
+	if err := repo.CreateAccountToken(ctx, verify); err != nil {
+		t.Fatalf("CreateAccountToken: %v", err)
+	}
+
+	// A newer token replaces an unused one of the same purpose only.
+	if _, err := repo.UseAccountToken(ctx, models.TokenPurposeResetPassword, "first", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("replaced token: expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.UseAccountToken(ctx, models.TokenPurposeResetPassword, "verify", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("token of another purpose: expected ErrNotFound, got %v", err)
+	}
+	got, err := repo.UseAccountToken(ctx, models.TokenPurposeResetPassword, "second", now)
+	if err != nil || got.UserId != 1 || got.UsedAt == nil {
+		t.Errorf("UseAccountToken = %+v, %v", got, err)
+	}
+	if _, err := repo.UseAccountToken(ctx, models.TokenPurposeResetPassword, "second", now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("used token: expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.UseAccountToken(ctx, models.TokenPurposeVerifyEmail, "verify", now.Add(2*time.Hour)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expired token: expected ErrNotFound, got %v", err)
+	}
+	if _, err := repo.UseAccountToken(ctx, models.TokenPurposeVerifyEmail, "verify", now); err != nil {
+		t.Errorf("UseAccountToken: %v", err)
+	}
+}
+
+// testRoomRoleRepository runs on a RoomRoleRepository together with the
+// UserRepository holding its users.
+func testRoomRoleRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, RoomRoleRepository)) {
+	ctx := context.Background()
+	users, repo := newRepos(t)
+	grace := &models.User{Username: "grace01", FullName: "Grace Hopper"}
+	alan := &models.User{Username: "alan001", FullName: "Alan Turing"}
+	for _, user := range []*models.User{grace, alan} {
+		if err := users.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+
+	if err := repo.SetRoomRole(ctx, "ops", alan.Id, models.RoleModerator); err != nil {
+		t.Fatalf("SetRoomRole: %v", err)
+	}
+	if err := repo.SetRoomRole(ctx, "ops", alan.Id, models.RoleOwner); err != nil {
+		t.Fatalf("SetRoomRole again: %v", err)
+	}
+	if err := repo.SetRoomRole(ctx, "ops", grace.Id, models.RoleModerator); err != nil {
+		t.Fatalf("SetRoomRole: %v", err)
+	}
+	if err := repo.SetRoomRole(ctx, "", alan.Id, models.RoleModerator); err != nil {
+		t.Fatalf("SetRoomRole in the default room: %v", err)
+	}
+
+	roles, err := repo.GetUserRoomRoles(ctx, alan.Id)
+	if err != nil || len(roles) != 2 || roles[0].Room != "" || roles[1].Role != models.RoleOwner {
+		t.Errorf("GetUserRoomRoles = %+v, %v", roles, err)
+	}
+	members, err := repo.GetRoomMembers(ctx, "ops")
+	want := []models.RoomMember{{Username: "alan001", Role: models.RoleOwner}, {Username: "grace01", Role: models.RoleModerator}}
+	if err != nil || !slices.Equal(members, want) {
+		t.Errorf("GetRoomMembers = %+v, %v, want %+v", members, err, want)
+	}
+
+	if err := repo.DeleteRoomRole(ctx, "ops", grace.Id); err != nil {
+		t.Fatalf("DeleteRoomRole: %v", err)
+	}
+	if err := repo.DeleteRoomRole(ctx, "ops", grace.Id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("deleted role: expected ErrNotFound, got %v", err)
+	}
+	if members, _ := repo.GetRoomMembers(ctx, "ops"); len(members) != 1 {
+		t.Errorf("GetRoomMembers after delete = %+v", members)
+	}
+	if members, err := repo.GetRoomMembers(ctx, "empty"); err != nil || members == nil || len(members) != 0 {
+		t.Errorf("GetRoomMembers of a room without roles = %#v, %v", members, err)
+	}
+}
+
+// testSanctionRepository runs on a SanctionRepository together with the
+// UserRepository holding its users.
+func testSanctionRepository(t *testing.T, newRepos func(t *testing.T) (UserRepository, SanctionRepository)) {
+	ctx := context.Background()
+	users, repo := newRepos(t)
+	mod := &models.User{Username: "modder1", FullName: "Mod Erator"}
+	troll := &models.User{Username: "troll01", FullName: "Troll Under Bridge"}
+	for _, user := range []*models.User{mod, troll} {
+		if err := users.CreateUser(ctx, user); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	now := time.Now().Truncate(time.Second)
+	at := func(d time.Duration) *time.Time {
+		at := now.Add(d)
+		return &at
+	}
+	sanction := func(kind models.SanctionKind, expires *time.Time) *models.Sanction {
+		return &models.Sanction{Room: "ops", UserId: troll.Id, Kind: kind, ModeratorId: mod.Id, Reason: "spam",
+			ExpiresAt: expires, CreatedAt: now}
+	}
+	kinds := func(sanctions []models.Sanction) []models.SanctionKind {
+		var kinds []models.SanctionKind
+		for _, sanction := range sanctions {
+			kinds = append(kinds, sanction.Kind)
+		}
+		return kinds
+	}
+
+	for _, s := range []*models.Sanction{
+		sanction(models.SanctionMute, at(time.Hour)),
+		// A second mute replaces the first.
+		sanction(models.SanctionMute, at(time.Minute)),
+		sanction(models.SanctionBan, nil),
+	} {
+		if err := repo.CreateSanction(ctx, s); err != nil || s.Id == 0 {
+			t.Fatalf("CreateSanction: %v, id %d", err, s.Id)
+		}
+	}
+	active, err := repo.GetActiveSanctions(ctx, "ops", troll.Id, now)
+	if err != nil || !slices.Equal(kinds(active), []models.SanctionKind{models.SanctionMute, models.SanctionBan}) {
+		t.Fatalf("GetActiveSanctions = %+v, %v", active, err)
+	}
+	if !active[0].ExpiresAt.Equal(*at(time.Minute)) {
+		t.Errorf("mute expires at %v, want the replacement's %v", active[0].ExpiresAt, at(time.Minute))
+	}
+	if active, _ := repo.GetActiveSanctions(ctx, "", troll.Id, now); len(active) != 0 {
+		t.Errorf("sanctions leaked into the default room: %+v", active)
+	}
+
+	listed, err := repo.GetRoomSanctions(ctx, "ops", now)
+	if err != nil || len(listed) != 2 || listed[0].Kind != models.SanctionBan ||
+		listed[0].Username != "troll01" || listed[0].Moderator != "modder1" || listed[0].Reason != "spam" {
+		t.Errorf("GetRoomSanctions = %+v, %v", listed, err)
+	}
+
+	if err := repo.LiftSanction(ctx, "ops", troll.Id, models.SanctionBan, now); err != nil {
+		t.Fatalf("LiftSanction: %v", err)
+	}
+	if err := repo.LiftSanction(ctx, "ops", troll.Id, models.SanctionBan, now); !errors.Is(err, ErrNotFound) {
+		t.Errorf("lifted ban: expected ErrNotFound, got %v", err)
+	}
+
+	lifted, err := repo.LiftExpiredSanctions(ctx, now.Add(time.Minute))
+	if err != nil || len(lifted) != 1 || lifted[0].Kind != models.SanctionMute || lifted[0].LiftedAt == nil {
+		t.Errorf("LiftExpiredSanctions = %+v, %v", lifted, err)
+	}
+	if lifted, _ := repo.LiftExpiredSanctions(ctx, now.Add(time.Hour)); len(lifted) != 0 {
+		t.Errorf("lifted sanctions expired again: %+v", lifted)
+	}
+	if active, _ := repo.GetActiveSanctions(ctx, "ops", troll.Id, now); len(active) != 0 {
+		t.Errorf("GetActiveSanctions after lifting = %+v", active)
+	}
+}
+
+func testSessionRepository(t *testing.T, newRepo func(t *testing.T) SessionRepository) {
+	ctx := context.Background()
+	now := time.Now().Truncate(time.Second)
+
+	newSession := func(token, refresh string) *models.UserSession {
+		return &models.UserSession{
+			UserId:              1,
+			Token:               token,
+			RefreshToken:        refresh,
+			TokenExpired:        now.Add(15 * time.Minute),
+			RefreshTokenExpired: now.Add(24 * time.Hour),
+		}
+	}
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		session := newSession("access-1", "refresh-1")
+		if err := repo.CreateUserSession(ctx, session); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+		if session.Id == 0 {
+			t.Fatal("CreateUserSession did not assign an id")
+		}
+
+		byToken, err := repo.GetUserSession(ctx, "access-1")
+		if err != nil {
+			t.Fatalf("GetUserSession: %v", err)
+		}
+		byRefresh, err := repo.GetUserSessionByRefreshToken(ctx, "refresh-1")
+		if err != nil {
+			t.Fatalf("GetUserSessionByRefreshToken: %v", err)
+		}
+		if byToken.Id != session.Id || byRefresh.Id != session.Id {
+			t.Errorf("lookups returned ids %d and %d, want %d", byToken.Id, byRefresh.Id, session.Id)
+		}
+		if !byToken.RefreshTokenExpired.Equal(session.RefreshTokenExpired) {
+			t.Errorf("RefreshTokenExpired = %v, want %v", byToken.RefreshTokenExpired, session.RefreshTokenExpired)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.CreateUserSession(ctx, newSession("access-2", "refresh-2")); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+		if err := repo.DeleteUserSession(ctx, "access-2"); err != nil {
+			t.Fatalf("DeleteUserSession: %v", err)
+		}
+		if _, err := repo.GetUserSession(ctx, "access-2"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound after delete, got %v", err)
+		}
+		if err := repo.DeleteUserSession(ctx, "access-2"); err != nil {
+			t.Errorf("deleting a missing session should succeed, got %v", err)
+		}
+	})
+
+	t.Run("UpdateTokens", func(t *testing.T) {
+		repo := newRepo(t)
+		if err := repo.CreateUserSession(ctx, newSession("access-3", "refresh-3")); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+
+		later := now.Add(time.Hour)
+		err := repo.UpdateUserSessionTokens(ctx, "access-4", "refresh-4", later, later.Add(24*time.Hour), "refresh-3")
+		if err != nil {
+			t.Fatalf("UpdateUserSessionTokens: %v", err)
+		}
+
+		if _, err := repo.GetUserSessionByRefreshToken(ctx, "refresh-3"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("old refresh token still resolves: %v", err)
+		}
+		session, err := repo.GetUserSession(ctx, "access-4")
+		if err != nil {
+			t.Fatalf("GetUserSession: %v", err)
+		}
+		if session.RefreshToken != "refresh-4" || !session.TokenExpired.Equal(later) {
+			t.Errorf("session not updated: %+v", session)
+		}
+	})
+
+	t.Run("RotatedRefreshToken", func(t *testing.T) {
+		repo := newRepo(t)
+		session := newSession("access-12", "refresh-12")
+		if err := repo.CreateUserSession(ctx, session); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+		if _, err := repo.GetRotatedRefreshToken(ctx, "refresh-12"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("a current refresh token is reported as rotated: %v", err)
+		}
+
+		later := now.Add(time.Hour)
+		if err := repo.UpdateUserSessionTokens(ctx, "access-13", "refresh-13", later, later, "refresh-12"); err != nil {
+			t.Fatalf("UpdateUserSessionTokens: %v", err)
+		}
+		rotated, err := repo.GetRotatedRefreshToken(ctx, "refresh-12")
+		if err != nil {
+			t.Fatalf("GetRotatedRefreshToken: %v", err)
+		}
+		if rotated.SessionId != session.Id || rotated.UserId != session.UserId {
+			t.Errorf("rotated token belongs to session %d of user %d, want %d of %d", rotated.SessionId, rotated.UserId, session.Id, session.UserId)
+		}
+		if err := repo.UpdateUserSessionTokens(ctx, "access-14", "refresh-14", later, later, "refresh-12"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("rotating a rotated token: expected ErrNotFound, got %v", err)
+		}
+
+		expired := newSession("access-15", "refresh-15")
+		expired.RefreshTokenExpired = now.Add(-time.Minute)
+		if err := repo.CreateUserSession(ctx, expired); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+		if err := repo.UpdateUserSessionTokens(ctx, "access-16", "refresh-16", later, later, "refresh-15"); err != nil {
+			t.Fatalf("UpdateUserSessionTokens: %v", err)
+		}
+		if _, err := repo.GetRotatedRefreshToken(ctx, "refresh-15"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("an expired rotated token is still reported: %v", err)
+		}
+	})
+
+	t.Run("UpdateUnknownRefreshToken", func(t *testing.T) {
+		repo := newRepo(t)
+		err := repo.UpdateUserSessionTokens(ctx, "a", "r", now, now, "missing")
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("DeleteById", func(t *testing.T) {
+		repo := newRepo(t)
+		session := newSession("access-5", "refresh-5")
+		if err := repo.CreateUserSession(ctx, session); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+		byId, err := repo.GetUserSessionById(ctx, session.Id)
+		if err != nil || byId.Token != "access-5" {
+			t.Fatalf("GetUserSessionById = %+v, %v", byId, err)
+		}
+		if err := repo.DeleteUserSessionById(ctx, session.Id); err != nil {
+			t.Fatalf("DeleteUserSessionById: %v", err)
+		}
+		if _, err := repo.GetUserSessionById(ctx, session.Id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetUserSessionById after delete: expected ErrNotFound, got %v", err)
+		}
+		if _, err := repo.GetUserSession(ctx, "access-5"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("expected ErrNotFound after delete, got %v", err)
+		}
+		if err := repo.DeleteUserSessionById(ctx, session.Id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleting a missing id: expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("DeleteAllOfUser", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, token := range []string{"access-6", "access-7"} {
+			if err := repo.CreateUserSession(ctx, newSession(token, "refresh-"+token)); err != nil {
+				t.Fatalf("CreateUserSession: %v", err)
+			}
+		}
+		other := newSession("access-8", "refresh-8")
+		other.UserId = 2
+		if err := repo.CreateUserSession(ctx, other); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+
+		deleted, err := repo.DeleteUserSessions(ctx, 1)
+		if err != nil {
+			t.Fatalf("DeleteUserSessions: %v", err)
+		}
+		if deleted != 2 {
+			t.Errorf("deleted %d sessions, want 2", deleted)
+		}
+		if _, err := repo.GetUserSession(ctx, "access-8"); err != nil {
+			t.Errorf("another user's session was deleted: %v", err)
+		}
+	})
+	t.Run("ListAndTouch", func(t *testing.T) {
+		repo := newRepo(t)
+		first := newSession("access-9", "refresh-9")
+		first.IP = "203.0.113.7"
+		first.UserAgent = "Mozilla/5.0"
+		first.LastUsedAt = now
+		second := newSession("access-10", "refresh-10")
+		other := newSession("access-11", "refresh-11")
+		other.UserId = 2
+		for _, session := range []*models.UserSession{first, second, other} {
+			if err := repo.CreateUserSession(ctx, session); err != nil {
+				t.Fatalf("CreateUserSession: %v", err)
+			}
+		}
+
+		used := now.Add(time.Hour)
+		if err := repo.TouchUserSession(ctx, first.Id, used); err != nil {
+			t.Fatalf("TouchUserSession: %v", err)
+		}
+
+		sessions, err := repo.GetUserSessions(ctx, 1)
+		if err != nil {
+			t.Fatalf("GetUserSessions: %v", err)
+		}
+		if len(sessions) != 2 || sessions[0].Id != second.Id || sessions[1].Id != first.Id {
+			t.Fatalf("GetUserSessions returned %+v, want sessions %d and %d", sessions, second.Id, first.Id)
+		}
+		got := sessions[1]
+		if got.IP != "203.0.113.7" || got.UserAgent != "Mozilla/5.0" || !got.LastUsedAt.Equal(used) {
+			t.Errorf("session client = %q %q %v, want the stored values and last use %v", got.IP, got.UserAgent, got.LastUsedAt, used)
+		}
+
+		none, err := repo.GetUserSessions(ctx, 3)
+		if err != nil || len(none) != 0 {
+			t.Errorf("GetUserSessions for a user without sessions = %v, %v", none, err)
+		}
+	})
+
+	t.Run("CountActive", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, token := range []string{"access-10", "access-11"} {
+			if err := repo.CreateUserSession(ctx, newSession(token, "refresh-"+token)); err != nil {
+				t.Fatalf("CreateUserSession: %v", err)
+			}
+		}
+		expired := newSession("access-12", "refresh-12")
+		expired.RefreshTokenExpired = now.Add(-time.Minute)
+		if err := repo.CreateUserSession(ctx, expired); err != nil {
+			t.Fatalf("CreateUserSession: %v", err)
+		}
+		if count, err := repo.CountActiveSessions(ctx, now); err != nil || count != 2 {
+			t.Errorf("CountActiveSessions = %d, %v, want 2", count, err)
+		}
+	})
+}
+
+func testRevocationRepository(t *testing.T, newRepo func(t *testing.T) RevocationRepository) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	now := time.Now()
+
+	if revoked, err := repo.IsTokenRevoked(ctx, "jti-1"); err != nil || revoked {
+		t.Fatalf("IsTokenRevoked before revocation = %v, %v", revoked, err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := repo.RevokeToken(ctx, "jti-1", now.Add(time.Hour)); err != nil {
+			t.Fatalf("RevokeToken run %d: %v", i+1, err)
+		}
+	}
+	if revoked, err := repo.IsTokenRevoked(ctx, "jti-1"); err != nil || !revoked {
+		t.Errorf("IsTokenRevoked after revocation = %v, %v", revoked, err)
+	}
+	if revoked, err := repo.IsTokenRevoked(ctx, "jti-2"); err != nil || revoked {
+		t.Errorf("another token is reported revoked: %v, %v", revoked, err)
+	}
+
+	if err := repo.RevokeToken(ctx, "jti-3", now.Add(-time.Minute)); err != nil {
+		t.Fatalf("RevokeToken: %v", err)
+	}
+	if revoked, err := repo.IsTokenRevoked(ctx, "jti-3"); err != nil || revoked {
+		t.Errorf("an expired revocation is still reported: %v, %v", revoked, err)
+	}
+}
+
+func testLoginAttemptRepository(t *testing.T, newRepo func(t *testing.T) LoginAttemptRepository) {
+	ctx := context.Background()
+	repo := newRepo(t)
+	now := time.Now().Truncate(time.Second)
+	since := now.Add(-time.Hour)
+
+	if _, err := repo.GetLoginAttempt(ctx, "user:alice01", since); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetLoginAttempt before any failure: expected ErrNotFound, got %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		attempt, err := repo.RecordLoginFailure(ctx, "user:alice01", now, since)
+		if err != nil || attempt.Failures != i {
+			t.Fatalf("RecordLoginFailure %d = %+v, %v", i, attempt, err)
+		}
+	}
+	if _, err := repo.RecordLoginFailure(ctx, "ip:192.0.2.1", now, since); err != nil {
+		t.Fatalf("RecordLoginFailure: %v", err)
+	}
+	if attempt, err := repo.GetLoginAttempt(ctx, "user:alice01", since); err != nil || attempt.Failures != 3 || !attempt.LastFailureAt.Equal(now) {
+		t.Errorf("GetLoginAttempt = %+v, %v", attempt, err)
+	}
+
+	// An hour later the failures are forgotten and counting starts over.
+	later := now.Add(2 * time.Hour)
+	if _, err := repo.GetLoginAttempt(ctx, "user:alice01", later.Add(-time.Hour)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("forgotten failures: expected ErrNotFound, got %v", err)
+	}
+	if attempt, err := repo.RecordLoginFailure(ctx, "user:alice01", later, later.Add(-time.Hour)); err != nil || attempt.Failures != 1 {
+		t.Errorf("RecordLoginFailure after forgetting = %+v, %v", attempt, err)
+	}
+
+	if err := repo.ClearLoginAttempts(ctx, "user:alice01"); err != nil {
+		t.Fatalf("ClearLoginAttempts: %v", err)
+	}
+	if _, err := repo.GetLoginAttempt(ctx, "user:alice01", since); !errors.Is(err, ErrNotFound) {
+		t.Errorf("after ClearLoginAttempts: expected ErrNotFound, got %v", err)
+	}
+}
+
+func testMessageRepository(t *testing.T, newRepo func(t *testing.T) MessageRepository) {
+	ctx := context.Background()
+
+	t.Run("Empty", func(t *testing.T) {
+		repo := newRepo(t)
+		msgs, err := repo.GetAllMessage(ctx)
+		if err != nil {
+			t.Fatalf("GetAllMessage: %v", err)
+		}
+		if len(msgs) != 0 {
+			t.Errorf("expected no messages, got %d", len(msgs))
+		}
+	})
+
+	t.Run("InsertAndList", func(t *testing.T) {
+		repo := newRepo(t)
+		base := time.Now().UTC().Truncate(time.Millisecond)
+		want := []models.MessagePayload{
+			{From: "alice01", Message: "hello", Date: base},
+			{From: "bob0001", Message: "hi alice", Date: base.Add(time.Second)},
+		}
+		for _, msg := range want {
+			if err := repo.InsertNewMessage(ctx, msg); err != nil {
+				t.Fatalf("InsertNewMessage: %v", err)
+			}
+		}
+
+		got, err := repo.GetAllMessage(ctx)
+		if err != nil {
+			t.Fatalf("GetAllMessage: %v", err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("got %d messages, want %d", len(got), len(want))
+		}
+		for i := range want {
+			if got[i].From != want[i].From || got[i].Message != want[i].Message || !got[i].Date.Equal(want[i].Date) {
+				t.Errorf("message %d = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+	})
+
+	t.Run("RoomsAndPagination", func(t *testing.T) {
+		repo := newRepo(t)
+		base := time.Now().UTC().Truncate(time.Millisecond)
+		for i := 0; i < 5; i++ {
+			msg := models.MessagePayload{Room: "ops", From: "alice01", Message: fmt.Sprintf("ops %d", i), Date: base.Add(time.Duration(i) * time.Second)}
+			if err := repo.InsertNewMessage(ctx, msg); err != nil {
+				t.Fatalf("InsertNewMessage: %v", err)
+			}
+		}
+		if err := repo.InsertNewMessage(ctx, models.MessagePayload{From: "bob0001", Message: "lobby", Date: base}); err != nil {
+			t.Fatalf("InsertNewMessage: %v", err)
+		}
+
+		page, err := repo.GetMessages(ctx, MessageQuery{Room: "ops", Limit: 2})
+		if err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+		if got := messageTexts(page); !slices.Equal(got, []string{"ops 3", "ops 4"}) {
+			t.Errorf("newest page = %v", got)
+		}
+
+		page, err = repo.GetMessages(ctx, MessageQuery{Room: "ops", Before: page[0].Date, Limit: 2})
+		if err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+		if got := messageTexts(page); !slices.Equal(got, []string{"ops 1", "ops 2"}) {
+			t.Errorf("previous page = %v", got)
+		}
+
+		page, err = repo.GetMessages(ctx, MessageQuery{})
+		if err != nil {
+			t.Fatalf("GetMessages: %v", err)
+		}
+		if got := messageTexts(page); !slices.Equal(got, []string{"lobby"}) {
+			t.Errorf("default room = %v", got)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		testDeleteMessages(t, newRepo)
+	})
+
+	t.Run("DeleteByIdAndCount", func(t *testing.T) {
+		repo := newRepo(t)
+		base := time.Now().UTC().Truncate(time.Millisecond)
+		for i, room := range []string{"ops", "ops", ""} {
+			msg := models.MessagePayload{Room: room, From: "alice01", Message: fmt.Sprintf("%s %d", room, i), Date: base.Add(time.Duration(i) * time.Second)}
+			if err := repo.InsertNewMessage(ctx, msg); err != nil {
+				t.Fatalf("InsertNewMessage: %v", err)
+			}
+		}
+		if count, err := repo.CountMessages(ctx, MessageFilter{}); err != nil || count != 3 {
+			t.Errorf("CountMessages = %d, %v, want 3", count, err)
+		}
+		if count, err := repo.CountMessages(ctx, MessageFilter{Rooms: []string{"ops"}, After: base.Add(time.Second)}); err != nil || count != 1 {
+			t.Errorf("CountMessages in a window = %d, %v, want 1", count, err)
+		}
+
+		page, err := repo.GetMessages(ctx, MessageQuery{Room: "ops"})
+		if err != nil || len(page) != 2 || page[0].Id == "" || page[0].Id == page[1].Id {
+			t.Fatalf("GetMessages = %+v, %v, want two messages with distinct ids", page, err)
+		}
+		if got, err := repo.GetMessage(ctx, page[0].Id); err != nil || got.Id != page[0].Id || got.Room != "ops" || got.Message != page[0].Message {
+			t.Errorf("GetMessage = %+v, %v, want %+v", got, err, page[0])
+		}
+		if err := repo.DeleteMessage(ctx, page[0].Id); err != nil {
+			t.Fatalf("DeleteMessage: %v", err)
+		}
+		if _, err := repo.GetMessage(ctx, page[0].Id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetMessage of a deleted message: expected ErrNotFound, got %v", err)
+		}
+		if _, err := repo.GetMessage(ctx, "not-an-id"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetMessage of a malformed id: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.DeleteMessage(ctx, page[0].Id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("deleted message: expected ErrNotFound, got %v", err)
+		}
+		if err := repo.DeleteMessage(ctx, "not-an-id"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("malformed id: expected ErrNotFound, got %v", err)
+		}
+		if rest, _ := repo.GetMessages(ctx, MessageQuery{Room: "ops"}); len(rest) != 1 || rest[0].Id != page[1].Id {
+			t.Errorf("after DeleteMessage = %+v", rest)
+		}
+	})
+}
+
+// testDeleteMessages covers the bulk operations used by purging and
+// archiving.
+func testDeleteMessages(t *testing.T, newRepo func(t *testing.T) MessageRepository) {
+	ctx := context.Background()
+	base := time.Now().UTC().Truncate(time.Millisecond)
+
+	seed := func(t *testing.T) MessageRepository {
+		repo := newRepo(t)
+		for i, room := range []string{"ops", "", "ops", "dev", "ops"} {
+			msg := models.MessagePayload{Room: room, From: "alice01", Message: fmt.Sprintf("%s %d", room, i), Date: base.Add(time.Duration(i) * time.Second)}
+			if err := repo.InsertNewMessage(ctx, msg); err != nil {
+				t.Fatalf("InsertNewMessage: %v", err)
+			}
+		}
+		return repo
+	}
+
+	t.Run("Before", func(t *testing.T) {
+		repo := seed(t)
+		deleted, err := repo.DeleteMessages(ctx, MessageFilter{Before: base.Add(2 * time.Second)}, 0)
+		if err != nil {
+			t.Fatalf("DeleteMessages: %v", err)
+		}
+		if deleted != 2 {
+			t.Errorf("deleted %d messages, want 2", deleted)
+		}
+		all, _ := repo.GetAllMessage(ctx)
+		if got := messageTexts(all); !slices.Equal(got, []string{"ops 2", "dev 3", "ops 4"}) {
+			t.Errorf("remaining = %v", got)
+		}
+	})
+
+	t.Run("RoomsInBatches", func(t *testing.T) {
+		repo := seed(t)
+		filter := MessageFilter{Rooms: []string{"ops", ""}, Before: base.Add(time.Hour)}
+		deleted, err := repo.DeleteMessages(ctx, filter, 3)
+		if err != nil {
+			t.Fatalf("DeleteMessages: %v", err)
+		}
+		if deleted != 3 {
+			t.Errorf("first batch deleted %d messages, want 3", deleted)
+		}
+		all, _ := repo.GetAllMessage(ctx)
+		if got := messageTexts(all); !slices.Equal(got, []string{"dev 3", "ops 4"}) {
+			t.Errorf("after first batch = %v", got)
+		}
+
+		deleted, err = repo.DeleteMessages(ctx, filter, 3)
+		if err != nil {
+			t.Fatalf("DeleteMessages: %v", err)
+		}
+		if deleted != 1 {
+			t.Errorf("second batch deleted %d messages, want 1", deleted)
+		}
+	})
+
+	t.Run("FindWindow", func(t *testing.T) {
+		repo := seed(t)
+		filter := MessageFilter{After: base.Add(time.Second), Before: base.Add(4 * time.Second)}
+		found, err := repo.FindMessages(ctx, filter, 0)
+		if err != nil {
+			t.Fatalf("FindMessages: %v", err)
+		}
+		if got := messageTexts(found); !slices.Equal(got, []string{" 1", "ops 2", "dev 3"}) {
+			t.Errorf("window = %v", got)
+		}
+
+		found, err = repo.FindMessages(ctx, MessageFilter{Rooms: []string{"ops"}}, 2)
+		if err != nil {
+			t.Fatalf("FindMessages: %v", err)
+		}
+		if got := messageTexts(found); !slices.Equal(got, []string{"ops 0", "ops 2"}) {
+			t.Errorf("oldest ops messages = %v", got)
+		}
+	})
+
+	t.Run("ExcludeRooms", func(t *testing.T) {
+		repo := seed(t)
+		deleted, err := repo.DeleteMessages(ctx, MessageFilter{ExcludeRooms: []string{"ops", ""}, Before: base.Add(time.Hour)}, 0)
+		if err != nil {
+			t.Fatalf("DeleteMessages: %v", err)
+		}
+		if deleted != 1 {
+			t.Errorf("deleted %d messages, want 1", deleted)
+		}
+		all, _ := repo.GetAllMessage(ctx)
+		if got := messageTexts(all); slices.Contains(got, "dev 3") || len(got) != 4 {
+			t.Errorf("remaining = %v", got)
+		}
+	})
+}
+
+func messageTexts(msgs []models.MessagePayload) []string {
+	texts := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		texts = append(texts, msg.Message)
+	}
+	return texts
+}
@@ -0,0 +1,180 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"slices"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type gormMessageRepository struct {
+	db *gorm.DB
+}
+
+// NewGormMessageRepository stores messages in the relational database, for
+// deployments without MongoDB.
+func NewGormMessageRepository(db *gorm.DB) MessageRepository {
+	return &gormMessageRepository{db: db}
+}
+
+func (r *gormMessageRepository) InsertNewMessage(ctx context.Context, data models.MessagePayload) error {
+
+	span, _ := tracing.StartSpan(ctx, "InsertNewMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("InsertNewMessage", time.Now())
+
+	message := models.NewMessage(data)
+	return r.db.WithContext(ctx).Create(&message).Error
+}
+
+func (r *gormMessageRepository) GetAllMessage(ctx context.Context) ([]models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetAllMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetAllMessage", time.Now())
+
+	var rows []models.Message
+	if err := r.db.WithContext(ctx).Order("date, id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return toPayloads(rows), nil
+}
+
+func (r *gormMessageRepository) GetMessages(ctx context.Context, query MessageQuery) ([]models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetMessages", time.Now())
+
+	query = query.Normalize()
+	tx := r.db.WithContext(ctx).Where("room = ?", query.Room)
+	if !query.Before.IsZero() {
+		tx = tx.Where("date < ?", query.Before.UTC())
+	}
+
+	var rows []models.Message
+	if err := tx.Order("date DESC, id DESC").Limit(query.Limit).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	slices.Reverse(rows)
+	return toPayloads(rows), nil
+}
+
+func (r *gormMessageRepository) FindMessages(ctx context.Context, filter MessageFilter, limit int) ([]models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "FindMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("FindMessages", time.Now())
+
+	tx := r.filter(ctx, filter).Order("date, id")
+	if limit > 0 {
+		tx = tx.Limit(limit)
+	}
+	var rows []models.Message
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return toPayloads(rows), nil
+}
+
+func (r *gormMessageRepository) DeleteMessages(ctx context.Context, filter MessageFilter, limit int) (int64, error) {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteMessages", time.Now())
+
+	tx := r.filter(ctx, filter)
+	if limit <= 0 {
+		result := tx.Delete(&models.Message{})
+		return result.RowsAffected, result.Error
+	}
+
+	// MySQL rejects LIMIT inside an IN subquery, so the ids of a batch are
+	// selected first.
+	var ids []uint
+	if err := tx.Model(&models.Message{}).Order("date, id").Limit(limit).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := r.db.WithContext(ctx).Where("id IN ?", ids).Delete(&models.Message{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *gormMessageRepository) GetMessage(ctx context.Context, id string) (models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetMessage", time.Now())
+
+	rowId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return models.MessagePayload{}, ErrNotFound
+	}
+	var row models.Message
+	if err := r.db.WithContext(ctx).Where("id = ?", rowId).First(&row).Error; err != nil {
+		return models.MessagePayload{}, translateError(err)
+	}
+	return row.Payload(), nil
+}
+
+func (r *gormMessageRepository) DeleteMessage(ctx context.Context, id string) error {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteMessage", time.Now())
+
+	rowId, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return ErrNotFound
+	}
+	result := r.db.WithContext(ctx).Where("id = ?", rowId).Delete(&models.Message{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *gormMessageRepository) CountMessages(ctx context.Context, filter MessageFilter) (int64, error) {
+
+	span, _ := tracing.StartSpan(ctx, "CountMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CountMessages", time.Now())
+
+	var count int64
+	return count, r.filter(ctx, filter).Model(&models.Message{}).Count(&count).Error
+}
+
+func (r *gormMessageRepository) filter(ctx context.Context, filter MessageFilter) *gorm.DB {
+	tx := r.db.WithContext(ctx)
+	if len(filter.Rooms) > 0 {
+		tx = tx.Where("room IN ?", filter.Rooms)
+	}
+	if len(filter.ExcludeRooms) > 0 {
+		tx = tx.Where("room NOT IN ?", filter.ExcludeRooms)
+	}
+	if !filter.After.IsZero() {
+		tx = tx.Where("date >= ?", filter.After.UTC())
+	}
+	if !filter.Before.IsZero() {
+		tx = tx.Where("date < ?", filter.Before.UTC())
+	}
+	return tx
+}
+
+func toPayloads(rows []models.Message) []models.MessagePayload {
+	msg := make([]models.MessagePayload, 0, len(rows))
+	for _, row := range rows {
+		msg = append(msg, row.Payload())
+	}
+	return msg
+}
@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/migration"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// gormBackends lists the relational stores the conformance suites run on.
+// SQLite always runs; MySQL and PostgreSQL run when TEST_MYSQL_DSN or
+// TEST_POSTGRES_DSN point at a disposable database.
+var gormBackends = []struct {
+	name string
+	open func(t *testing.T) gorm.Dialector
+}{
+	{"SQLite", func(t *testing.T) gorm.Dialector {
+		return sqlite.Open(filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)")
+	}},
+	{"MySQL", func(t *testing.T) gorm.Dialector {
+		return mysql.Open(requireEnv(t, "TEST_MYSQL_DSN"))
+	}},
+	{"PostgreSQL", func(t *testing.T) gorm.Dialector {
+		return postgres.Open(requireEnv(t, "TEST_POSTGRES_DSN"))
+	}},
+}
+
+func requireEnv(t *testing.T, key string) string {
+	t.Helper()
+	value := os.Getenv(key)
+	if value == "" {
+		t.Skipf("%s is not set", key)
+	}
+	return value
+}
+
+// openTestDB applies the migrations and empties the tables before each test.
+func openTestDB(t *testing.T, dialector gorm.Dialector) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	migrator := migration.New("test", migration.NewSQLStore(db), migration.SQLMigrations(db))
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("failed to migrate: %v", err)
+	}
+	for _, model := range []interface{}{&models.Sanction{}, &models.RoomRole{}, &models.LoginAttempt{}, &models.AccountToken{}, &models.ExternalIdentity{}, &models.RecoveryCode{}, &models.RevokedToken{}, &models.RotatedRefreshToken{}, &models.UserSession{}, &models.User{}, &models.Message{}} {
+		if err := db.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+			t.Fatalf("failed to clean %T: %v", model, err)
+		}
+	}
+	return db
+}
+
+func TestGormUserRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testUserRepository(t, func(t *testing.T) UserRepository {
+				return NewUserRepository(openTestDB(t, backend.open(t)))
+			})
+		})
+	}
+}
+
+func TestGormAccountTokenRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testAccountTokenRepository(t, func(t *testing.T) AccountTokenRepository {
+				return NewAccountTokenRepository(openTestDB(t, backend.open(t)))
+			})
+		})
+	}
+}
+
+func TestGormRoomRoleRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testRoomRoleRepository(t, func(t *testing.T) (UserRepository, RoomRoleRepository) {
+				db := openTestDB(t, backend.open(t))
+				return NewUserRepository(db), NewRoomRoleRepository(db)
+			})
+		})
+	}
+}
+
+func TestGormSanctionRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testSanctionRepository(t, func(t *testing.T) (UserRepository, SanctionRepository) {
+				db := openTestDB(t, backend.open(t))
+				return NewUserRepository(db), NewSanctionRepository(db)
+			})
+		})
+	}
+}
+
+func TestGormSessionRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testSessionRepository(t, func(t *testing.T) SessionRepository {
+				return NewSessionRepository(openTestDB(t, backend.open(t)))
+			})
+		})
+	}
+}
+
+func TestGormRevocationRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testRevocationRepository(t, func(t *testing.T) RevocationRepository {
+				return NewRevocationRepository(openTestDB(t, backend.open(t)))
+			})
+		})
+	}
+}
+
+func TestGormLoginAttemptRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testLoginAttemptRepository(t, func(t *testing.T) LoginAttemptRepository {
+				return NewLoginAttemptRepository(openTestDB(t, backend.open(t)))
+			})
+		})
+	}
+}
+
+func TestGormMessageRepository(t *testing.T) {
+	for _, backend := range gormBackends {
+		t.Run(backend.name, func(t *testing.T) {
+			testMessageRepository(t, func(t *testing.T) MessageRepository {
+				return NewGormMessageRepository(openTestDB(t, backend.open(t)))
+			})
+		})
+	}
+}
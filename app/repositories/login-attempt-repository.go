@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type loginAttemptRepository struct {
+	db *gorm.DB
+}
+
+// NewLoginAttemptRepository returns a LoginAttemptRepository on the
+// relational database, shared by every instance.
+func NewLoginAttemptRepository(db *gorm.DB) LoginAttemptRepository {
+	return &loginAttemptRepository{db: db}
+}
+
+func (r *loginAttemptRepository) GetLoginAttempt(ctx context.Context, key string, since time.Time) (models.LoginAttempt, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetLoginAttempt", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetLoginAttempt", time.Now())
+
+	var attempt models.LoginAttempt
+	return attempt, translateError(r.db.WithContext(ctx).
+		Where("id = ? AND last_failure_at >= ?", key, since).
+		First(&attempt).Error)
+}
+
+func (r *loginAttemptRepository) RecordLoginFailure(ctx context.Context, key string, at, since time.Time) (models.LoginAttempt, error) {
+
+	span, _ := tracing.StartSpan(ctx, "RecordLoginFailure", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("RecordLoginFailure", time.Now())
+
+	var attempt models.LoginAttempt
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Forgotten failures can go, and the count of key starts over.
+		if err := tx.Where("last_failure_at < ?", since).Delete(&models.LoginAttempt{}).Error; err != nil {
+			return err
+		}
+		// Incrementing in the statement keeps concurrent failures from
+		// overwriting each other's count.
+		result := tx.Model(&models.LoginAttempt{}).Where("id = ?", key).Updates(map[string]interface{}{
+			"failures":        gorm.Expr("failures + 1"),
+			"last_failure_at": at,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			if err := tx.Create(&models.LoginAttempt{Id: key, Failures: 1, LastFailureAt: at}).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Where("id = ?", key).First(&attempt).Error
+	})
+	if errors.Is(translateError(err), ErrDuplicate) {
+		// A concurrent first failure created the row; count on top of it.
+		return r.RecordLoginFailure(ctx, key, at, since)
+	}
+	return attempt, translateError(err)
+}
+
+func (r *loginAttemptRepository) ClearLoginAttempts(ctx context.Context, key string) error {
+
+	span, _ := tracing.StartSpan(ctx, "ClearLoginAttempts", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("ClearLoginAttempts", time.Now())
+
+	return r.db.WithContext(ctx).Where("id = ?", key).Delete(&models.LoginAttempt{}).Error
+}
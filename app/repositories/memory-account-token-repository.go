@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+type memoryAccountTokenRepository struct {
+	mu     sync.Mutex
+	nextId uint
+	tokens []models.AccountToken
+}
+
+// NewMemoryAccountTokenRepository returns an AccountTokenRepository local to
+// the process, for tests and local development.
+func NewMemoryAccountTokenRepository() AccountTokenRepository {
+	return &memoryAccountTokenRepository{}
+}
+
+func (r *memoryAccountTokenRepository) CreateAccountToken(ctx context.Context, token *models.AccountToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if slices.ContainsFunc(r.tokens, func(t models.AccountToken) bool { return t.TokenHash == token.TokenHash }) {
+		return ErrDuplicate
+	}
+	r.tokens = slices.DeleteFunc(r.tokens, func(t models.AccountToken) bool {
+		return t.UserId == token.UserId && t.Purpose == token.Purpose && t.UsedAt == nil
+	})
+	r.nextId++
+	token.Id = r.nextId
+	token.CreatedAt = time.Now()
+	r.tokens = append(r.tokens, *token)
+	return nil
+}
+
+func (r *memoryAccountTokenRepository) UseAccountToken(ctx context.Context, purpose, hash string, now time.Time) (models.AccountToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, token := range r.tokens {
+		if token.TokenHash == hash && token.Purpose == purpose && token.UsedAt == nil && token.ExpiresAt.After(now) {
+			r.tokens[i].UsedAt = &now
+			return r.tokens[i], nil
+		}
+	}
+	return models.AccountToken{}, ErrNotFound
+}
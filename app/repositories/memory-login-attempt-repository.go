@@ -0,0 +1,55 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"sync"
+	"time"
+)
+
+type memoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]models.LoginAttempt
+}
+
+// NewMemoryLoginAttemptRepository returns a LoginAttemptRepository local to
+// the process.
+func NewMemoryLoginAttemptRepository() LoginAttemptRepository {
+	return &memoryLoginAttemptRepository{attempts: make(map[string]models.LoginAttempt)}
+}
+
+func (r *memoryLoginAttemptRepository) GetLoginAttempt(ctx context.Context, key string, since time.Time) (models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempt, ok := r.attempts[key]
+	if !ok || attempt.LastFailureAt.Before(since) {
+		return models.LoginAttempt{}, ErrNotFound
+	}
+	return attempt, nil
+}
+
+func (r *memoryLoginAttemptRepository) RecordLoginFailure(ctx context.Context, key string, at, since time.Time) (models.LoginAttempt, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for old, attempt := range r.attempts {
+		if attempt.LastFailureAt.Before(since) {
+			delete(r.attempts, old)
+		}
+	}
+	attempt := r.attempts[key]
+	attempt.Id = key
+	attempt.Failures++
+	attempt.LastFailureAt = at
+	r.attempts[key] = attempt
+	return attempt, nil
+}
+
+func (r *memoryLoginAttemptRepository) ClearLoginAttempts(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
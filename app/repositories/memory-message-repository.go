@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+type memoryMessageRepository struct {
+	mu       sync.RWMutex
+	nextId   uint64
+	messages []models.MessagePayload
+}
+
+// NewMemoryMessageRepository returns a MessageRepository backed by a slice,
+// for tests and local development.
+func NewMemoryMessageRepository() MessageRepository {
+	return &memoryMessageRepository{}
+}
+
+func (r *memoryMessageRepository) InsertNewMessage(ctx context.Context, data models.MessagePayload) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextId++
+	data.Id = strconv.FormatUint(r.nextId, 10)
+	r.messages = append(r.messages, data)
+	return nil
+}
+
+func (r *memoryMessageRepository) GetAllMessage(ctx context.Context) ([]models.MessagePayload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	msg := make([]models.MessagePayload, len(r.messages))
+	copy(msg, r.messages)
+	sortByDate(msg)
+	return msg, nil
+}
+
+func (r *memoryMessageRepository) GetMessages(ctx context.Context, query MessageQuery) ([]models.MessagePayload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = query.Normalize()
+	var msg []models.MessagePayload
+	for _, m := range r.messages {
+		if m.Room != query.Room {
+			continue
+		}
+		if !query.Before.IsZero() && !m.Date.Before(query.Before) {
+			continue
+		}
+		msg = append(msg, m)
+	}
+
+	sortByDate(msg)
+	if len(msg) > query.Limit {
+		msg = msg[len(msg)-query.Limit:]
+	}
+	return msg, nil
+}
+
+func (r *memoryMessageRepository) FindMessages(ctx context.Context, filter MessageFilter, limit int) ([]models.MessagePayload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.find(filter, limit), nil
+}
+
+func (r *memoryMessageRepository) DeleteMessages(ctx context.Context, filter MessageFilter, limit int) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	matched := r.find(filter, limit)
+
+	// Remove exactly the selected messages, one occurrence each.
+	kept := r.messages[:0]
+	for _, m := range r.messages {
+		if i := slices.Index(matched, m); i >= 0 {
+			matched = slices.Delete(matched, i, i+1)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	deleted := int64(len(r.messages) - len(kept))
+	r.messages = kept
+	return deleted, nil
+}
+
+func (r *memoryMessageRepository) GetMessage(ctx context.Context, id string) (models.MessagePayload, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	i := slices.IndexFunc(r.messages, func(m models.MessagePayload) bool { return m.Id == id })
+	if i < 0 {
+		return models.MessagePayload{}, ErrNotFound
+	}
+	return r.messages[i], nil
+}
+
+func (r *memoryMessageRepository) DeleteMessage(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := slices.IndexFunc(r.messages, func(m models.MessagePayload) bool { return m.Id == id })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.messages = slices.Delete(r.messages, i, i+1)
+	return nil
+}
+
+func (r *memoryMessageRepository) CountMessages(ctx context.Context, filter MessageFilter) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.find(filter, 0))), nil
+}
+
+// find returns the oldest messages matching the filter; the caller holds mu.
+func (r *memoryMessageRepository) find(filter MessageFilter, limit int) []models.MessagePayload {
+	var matched []models.MessagePayload
+	for _, m := range r.messages {
+		if filter.Match(m) {
+			matched = append(matched, m)
+		}
+	}
+	sortByDate(matched)
+	if limit > 0 && len(matched) > limit {
+		matched = matched[:limit]
+	}
+	return matched
+}
+
+func sortByDate(msg []models.MessagePayload) {
+	sort.SliceStable(msg, func(i, j int) bool {
+		return msg[i].Date.Before(msg[j].Date)
+	})
+}
@@ -0,0 +1,53 @@
+package repositories
+
+import "testing"
+
+func TestMemoryUserRepository(t *testing.T) {
+	testUserRepository(t, func(t *testing.T) UserRepository {
+		return NewMemoryUserRepository()
+	})
+}
+
+func TestMemoryAccountTokenRepository(t *testing.T) {
+	testAccountTokenRepository(t, func(t *testing.T) AccountTokenRepository {
+		return NewMemoryAccountTokenRepository()
+	})
+}
+
+func TestMemoryRoomRoleRepository(t *testing.T) {
+	testRoomRoleRepository(t, func(t *testing.T) (UserRepository, RoomRoleRepository) {
+		users := NewMemoryUserRepository()
+		return users, NewMemoryRoomRoleRepository(users)
+	})
+}
+
+func TestMemorySanctionRepository(t *testing.T) {
+	testSanctionRepository(t, func(t *testing.T) (UserRepository, SanctionRepository) {
+		users := NewMemoryUserRepository()
+		return users, NewMemorySanctionRepository(users)
+	})
+}
+
+func TestMemorySessionRepository(t *testing.T) {
+	testSessionRepository(t, func(t *testing.T) SessionRepository {
+		return NewMemorySessionRepository()
+	})
+}
+
+func TestMemoryMessageRepository(t *testing.T) {
+	testMessageRepository(t, func(t *testing.T) MessageRepository {
+		return NewMemoryMessageRepository()
+	})
+}
+
+func TestMemoryRevocationRepository(t *testing.T) {
+	testRevocationRepository(t, func(t *testing.T) RevocationRepository {
+		return NewMemoryRevocationRepository()
+	})
+}
+
+func TestMemoryLoginAttemptRepository(t *testing.T) {
+	testLoginAttemptRepository(t, func(t *testing.T) LoginAttemptRepository {
+		return NewMemoryLoginAttemptRepository()
+	})
+}
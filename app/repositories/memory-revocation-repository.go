@@ -0,0 +1,42 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+type memoryRevocationRepository struct {
+	mu      sync.RWMutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryRevocationRepository returns a RevocationRepository local to the
+// process.
+func NewMemoryRevocationRepository() RevocationRepository {
+	return &memoryRevocationRepository{revoked: make(map[string]time.Time)}
+}
+
+func (r *memoryRevocationRepository) RevokeToken(ctx context.Context, id string, expires time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for revoked, until := range r.revoked {
+		if until.Before(now) {
+			delete(r.revoked, revoked)
+		}
+	}
+	if _, ok := r.revoked[id]; !ok {
+		r.revoked[id] = expires
+	}
+	return nil
+}
+
+func (r *memoryRevocationRepository) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	until, ok := r.revoked[id]
+	return ok && !until.Before(time.Now()), nil
+}
@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryRoomRoleRepository struct {
+	mu     sync.RWMutex
+	users  UserRepository
+	nextId uint
+	roles  []models.RoomRole
+}
+
+// NewMemoryRoomRoleRepository returns a RoomRoleRepository local to the
+// process, for tests and local development. Members are named by looking
+// them up in users.
+func NewMemoryRoomRoleRepository(users UserRepository) RoomRoleRepository {
+	return &memoryRoomRoleRepository{users: users}
+}
+
+func (r *memoryRoomRoleRepository) GetUserRoomRoles(ctx context.Context, userId uint) ([]models.RoomRole, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var roles []models.RoomRole
+	for _, role := range r.roles {
+		if role.UserId == userId {
+			roles = append(roles, role)
+		}
+	}
+	slices.SortFunc(roles, func(a, b models.RoomRole) int { return strings.Compare(a.Room, b.Room) })
+	return roles, nil
+}
+
+func (r *memoryRoomRoleRepository) GetRoomMembers(ctx context.Context, room string) ([]models.RoomMember, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	members := []models.RoomMember{}
+	for _, role := range r.roles {
+		if role.Room != room {
+			continue
+		}
+		user, err := r.users.GetUserById(ctx, role.UserId)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, models.RoomMember{Username: user.Username, Role: role.Role})
+	}
+	slices.SortFunc(members, func(a, b models.RoomMember) int { return strings.Compare(a.Username, b.Username) })
+	return members, nil
+}
+
+func (r *memoryRoomRoleRepository) SetRoomRole(ctx context.Context, room string, userId uint, role models.Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, held := range r.roles {
+		if held.Room == room && held.UserId == userId {
+			r.roles[i].Role = role
+			return nil
+		}
+	}
+	r.nextId++
+	r.roles = append(r.roles, models.RoomRole{Id: r.nextId, Room: room, UserId: userId, Role: role, CreatedAt: time.Now()})
+	return nil
+}
+
+func (r *memoryRoomRoleRepository) DeleteRoomRole(ctx context.Context, room string, userId uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := len(r.roles)
+	r.roles = slices.DeleteFunc(r.roles, func(held models.RoomRole) bool {
+		return held.Room == room && held.UserId == userId
+	})
+	if len(r.roles) == n {
+		return ErrNotFound
+	}
+	return nil
+}
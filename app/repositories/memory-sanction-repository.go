@@ -0,0 +1,112 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"slices"
+	"sync"
+	"time"
+)
+
+type memorySanctionRepository struct {
+	mu        sync.RWMutex
+	users     UserRepository
+	nextId    uint
+	sanctions []models.Sanction
+}
+
+// NewMemorySanctionRepository returns a SanctionRepository local to the
+// process, for tests and local development. Users and moderators are named
+// by looking them up in users.
+func NewMemorySanctionRepository(users UserRepository) SanctionRepository {
+	return &memorySanctionRepository{users: users}
+}
+
+func (r *memorySanctionRepository) CreateSanction(ctx context.Context, sanction *models.Sanction) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if sanction.CreatedAt.IsZero() {
+		sanction.CreatedAt = time.Now()
+	}
+	for i, held := range r.sanctions {
+		if held.Room == sanction.Room && held.UserId == sanction.UserId && held.Kind == sanction.Kind && held.Active(sanction.CreatedAt) {
+			r.sanctions[i].LiftedAt = &sanction.CreatedAt
+		}
+	}
+	r.nextId++
+	sanction.Id = r.nextId
+	r.sanctions = append(r.sanctions, *sanction)
+	return nil
+}
+
+func (r *memorySanctionRepository) GetActiveSanctions(ctx context.Context, room string, userId uint, now time.Time) ([]models.Sanction, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sanctions []models.Sanction
+	for _, sanction := range r.sanctions {
+		if sanction.Room == room && sanction.UserId == userId && sanction.Active(now) {
+			sanctions = append(sanctions, sanction)
+		}
+	}
+	return sanctions, nil
+}
+
+func (r *memorySanctionRepository) GetRoomSanctions(ctx context.Context, room string, now time.Time) ([]models.SanctionResponse, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sanctions []models.Sanction
+	for _, sanction := range slices.Backward(r.sanctions) {
+		if sanction.Room == room && sanction.Active(now) {
+			sanctions = append(sanctions, sanction)
+		}
+	}
+	var users []models.User
+	for _, sanction := range sanctions {
+		for _, id := range []uint{sanction.UserId, sanction.ModeratorId} {
+			user, err := r.users.GetUserById(ctx, id)
+			if errors.Is(err, ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			users = append(users, user)
+		}
+	}
+	return sanctionResponses(sanctions, users), nil
+}
+
+func (r *memorySanctionRepository) LiftSanction(ctx context.Context, room string, userId uint, kind models.SanctionKind, now time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	lifted := false
+	for i, sanction := range r.sanctions {
+		if sanction.Room == room && sanction.UserId == userId && sanction.Kind == kind && sanction.Active(now) {
+			r.sanctions[i].LiftedAt = &now
+			lifted = true
+		}
+	}
+	if !lifted {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *memorySanctionRepository) LiftExpiredSanctions(ctx context.Context, now time.Time) ([]models.Sanction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var lifted []models.Sanction
+	for i, sanction := range r.sanctions {
+		if sanction.LiftedAt == nil && sanction.ExpiresAt != nil && !sanction.ExpiresAt.After(now) {
+			r.sanctions[i].LiftedAt = &now
+			lifted = append(lifted, r.sanctions[i])
+		}
+	}
+	return lifted, nil
+}
@@ -0,0 +1,187 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memorySessionRepository struct {
+	mu       sync.RWMutex
+	nextId   uint
+	sessions map[uint]models.UserSession
+	rotated  []models.RotatedRefreshToken
+}
+
+// NewMemorySessionRepository returns a SessionRepository backed by a map, for
+// tests and local development.
+func NewMemorySessionRepository() SessionRepository {
+	return &memorySessionRepository{sessions: make(map[uint]models.UserSession)}
+}
+
+func (r *memorySessionRepository) CreateUserSession(ctx context.Context, session *models.UserSession) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextId++
+	now := time.Now()
+	session.Id = r.nextId
+	session.CreatedAt = now
+	session.UpdatedAt = now
+	r.sessions[session.Id] = *session
+	return nil
+}
+
+func (r *memorySessionRepository) DeleteUserSession(ctx context.Context, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id, session := range r.sessions {
+		if session.Token == token {
+			delete(r.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) GetUserSession(ctx context.Context, token string) (models.UserSession, error) {
+	return r.find(func(s models.UserSession) bool { return s.Token == token })
+}
+
+func (r *memorySessionRepository) GetUserSessionById(ctx context.Context, id uint) (models.UserSession, error) {
+	return r.find(func(s models.UserSession) bool { return s.Id == id })
+}
+
+func (r *memorySessionRepository) UpdateUserSessionTokens(ctx context.Context, accessToken, refreshToken string,
+	tokenExpired, refreshTokenExpired time.Time, oldRefreshToken string) error {
+	session, err := r.find(func(s models.UserSession) bool { return s.RefreshToken == oldRefreshToken })
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if current, ok := r.sessions[session.Id]; !ok || current.RefreshToken != oldRefreshToken {
+		return ErrNotFound
+	}
+	now := time.Now()
+	r.rotated = slices.DeleteFunc(r.rotated, func(t models.RotatedRefreshToken) bool { return t.ExpiresAt.Before(now) })
+	r.nextId++
+	r.rotated = append(r.rotated, models.RotatedRefreshToken{
+		Id:        r.nextId,
+		SessionId: session.Id,
+		UserId:    session.UserId,
+		TokenHash: oldRefreshToken,
+		ExpiresAt: session.RefreshTokenExpired,
+		CreatedAt: now,
+	})
+
+	session.Token = accessToken
+	session.RefreshToken = refreshToken
+	session.TokenExpired = tokenExpired
+	session.RefreshTokenExpired = refreshTokenExpired
+	session.UpdatedAt = now
+	r.sessions[session.Id] = session
+	return nil
+}
+
+func (r *memorySessionRepository) GetUserSessionByRefreshToken(ctx context.Context, refreshToken string) (models.UserSession, error) {
+	return r.find(func(s models.UserSession) bool { return s.RefreshToken == refreshToken })
+}
+
+func (r *memorySessionRepository) GetRotatedRefreshToken(ctx context.Context, refreshToken string) (models.RotatedRefreshToken, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(r.rotated) - 1; i >= 0; i-- {
+		if t := r.rotated[i]; t.TokenHash == refreshToken && !t.ExpiresAt.Before(now) {
+			return t, nil
+		}
+	}
+	return models.RotatedRefreshToken{}, ErrNotFound
+}
+
+func (r *memorySessionRepository) DeleteUserSessionById(ctx context.Context, id uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.sessions[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.sessions, id)
+	return nil
+}
+
+func (r *memorySessionRepository) DeleteUserSessions(ctx context.Context, userId uint) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for id, session := range r.sessions {
+		if session.UserId == userId {
+			delete(r.sessions, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (r *memorySessionRepository) GetUserSessions(ctx context.Context, userId uint) ([]models.UserSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var sessions []models.UserSession
+	for _, session := range r.sessions {
+		if session.UserId == userId {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Id > sessions[j].Id })
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) TouchUserSession(ctx context.Context, id uint, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if session, ok := r.sessions[id]; ok {
+		session.LastUsedAt = at
+		r.sessions[id] = session
+	}
+	return nil
+}
+
+func (r *memorySessionRepository) CountActiveSessions(ctx context.Context, now time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var count int64
+	for _, session := range r.sessions {
+		if session.RefreshTokenExpired.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// find returns the newest session matching the predicate, like Last in GORM.
+func (r *memorySessionRepository) find(match func(models.UserSession) bool) (models.UserSession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var found models.UserSession
+	for _, session := range r.sessions {
+		if match(session) && session.Id > found.Id {
+			found = session
+		}
+	}
+	if found.Id == 0 {
+		return models.UserSession{}, ErrNotFound
+	}
+	return found, nil
+}
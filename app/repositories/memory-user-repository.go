@@ -0,0 +1,313 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryUserRepository struct {
+	mu            sync.RWMutex
+	nextId        uint
+	users         map[string]models.User
+	nextCodeId    uint
+	recoveryCodes []models.RecoveryCode
+	identities    []models.ExternalIdentity
+}
+
+// NewMemoryUserRepository returns a UserRepository backed by a map, for tests
+// and local development.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{users: make(map[string]models.User)}
+}
+
+func (r *memoryUserRepository) CreateUser(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.create(user)
+}
+
+func (r *memoryUserRepository) create(user *models.User) error {
+	if _, ok := r.users[user.Username]; ok || r.emailTaken(user.Email, 0) {
+		return ErrDuplicate
+	}
+
+	r.nextId++
+	now := time.Now()
+	user.Id = r.nextId
+	if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+	user.CreatedAt = now
+	user.UpdatedAt = now
+	r.users[user.Username] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	user, ok := r.users[username]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+	return r.update(username, func(user *models.User) {
+		user.DisabledAt = nil
+		if disabled {
+			now := time.Now()
+			user.DisabledAt = &now
+		}
+	})
+}
+
+func (r *memoryUserRepository) UpdateUserPassword(ctx context.Context, username, passwordHash string) error {
+	return r.update(username, func(user *models.User) {
+		user.Password = passwordHash
+	})
+}
+
+func (r *memoryUserRepository) UpdateTwoFactor(ctx context.Context, username, secret string, enabled bool) error {
+	return r.update(username, func(user *models.User) {
+		user.TwoFactorSecret = secret
+		user.TwoFactorEnabledAt = nil
+		if enabled {
+			now := time.Now()
+			user.TwoFactorEnabledAt = &now
+		}
+	})
+}
+
+func (r *memoryUserRepository) UseTwoFactorStep(ctx context.Context, username string, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[username]
+	if !ok || user.TwoFactorLastStep >= step {
+		return ErrNotFound
+	}
+	user.TwoFactorLastStep = step
+	r.users[username] = user
+	return nil
+}
+
+func (r *memoryUserRepository) ReplaceRecoveryCodes(ctx context.Context, userId uint, hashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recoveryCodes = slices.DeleteFunc(r.recoveryCodes, func(code models.RecoveryCode) bool {
+		return code.UserId == userId
+	})
+	for _, hash := range hashes {
+		r.nextCodeId++
+		r.recoveryCodes = append(r.recoveryCodes, models.RecoveryCode{
+			Id:        r.nextCodeId,
+			UserId:    userId,
+			CodeHash:  hash,
+			CreatedAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) UseRecoveryCode(ctx context.Context, userId uint, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, code := range r.recoveryCodes {
+		if code.UserId == userId && code.CodeHash == hash && code.UsedAt == nil {
+			now := time.Now()
+			r.recoveryCodes[i].UsedAt = &now
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryUserRepository) GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, identity := range r.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			for _, user := range r.users {
+				if user.Id == identity.UserId {
+					return user, nil
+				}
+			}
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUserRepository) LinkIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.link(identity)
+}
+
+func (r *memoryUserRepository) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.ExternalIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.linked(identity) {
+		return ErrDuplicate
+	}
+	if err := r.create(user); err != nil {
+		return err
+	}
+	identity.UserId = user.Id
+	return r.link(identity)
+}
+
+func (r *memoryUserRepository) link(identity *models.ExternalIdentity) error {
+	if r.linked(identity) {
+		return ErrDuplicate
+	}
+	identity.Id = uint(len(r.identities) + 1)
+	identity.CreatedAt = time.Now()
+	r.identities = append(r.identities, *identity)
+	return nil
+}
+
+func (r *memoryUserRepository) linked(identity *models.ExternalIdentity) bool {
+	return slices.ContainsFunc(r.identities, func(linked models.ExternalIdentity) bool {
+		return linked.Issuer == identity.Issuer && linked.Subject == identity.Subject
+	})
+}
+
+func (r *memoryUserRepository) GetUserById(ctx context.Context, id uint) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Id == id {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUserRepository) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, user := range r.users {
+		if user.Email != nil && *user.Email == email {
+			return user, nil
+		}
+	}
+	return models.User{}, ErrNotFound
+}
+
+func (r *memoryUserRepository) UpdateEmail(ctx context.Context, username string, email *string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	if r.emailTaken(email, user.Id) {
+		return ErrDuplicate
+	}
+	user.Email = email
+	user.EmailVerifiedAt = nil
+	user.UpdatedAt = time.Now()
+	r.users[username] = user
+	return nil
+}
+
+func (r *memoryUserRepository) VerifyEmail(ctx context.Context, userId uint, email string, at time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for username, user := range r.users {
+		if user.Id == userId && user.Email != nil && *user.Email == email {
+			user.EmailVerifiedAt = &at
+			r.users[username] = user
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryUserRepository) SetUserRole(ctx context.Context, username string, role models.Role) error {
+	return r.update(username, func(user *models.User) {
+		user.Role = role
+	})
+}
+
+func (r *memoryUserRepository) ListUsers(ctx context.Context, query UserQuery) ([]models.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	query = query.Normalize()
+	search := strings.ToLower(query.Search)
+	var users []models.User
+	for _, user := range r.users {
+		email := ""
+		if user.Email != nil {
+			email = *user.Email
+		}
+		if search == "" || strings.Contains(strings.ToLower(user.Username), search) ||
+			strings.Contains(strings.ToLower(user.FullName), search) || strings.Contains(strings.ToLower(email), search) {
+			users = append(users, user)
+		}
+	}
+	slices.SortFunc(users, func(a, b models.User) int { return int(a.Id) - int(b.Id) })
+	users = users[min(query.Offset, len(users)):]
+	return users[:min(query.Limit, len(users))], nil
+}
+
+func (r *memoryUserRepository) CountUsers(ctx context.Context) (models.UserStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := models.UserStats{Total: int64(len(r.users))}
+	for _, user := range r.users {
+		if user.Disabled() {
+			stats.Disabled++
+		}
+		if user.Role == models.RoleAdmin {
+			stats.Admins++
+		}
+	}
+	return stats, nil
+}
+
+// emailTaken reports whether a user other than exceptId has the address.
+func (r *memoryUserRepository) emailTaken(email *string, exceptId uint) bool {
+	if email == nil {
+		return false
+	}
+	for _, user := range r.users {
+		if user.Id != exceptId && user.Email != nil && *user.Email == *email {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *memoryUserRepository) update(username string, apply func(*models.User)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[username]
+	if !ok {
+		return ErrNotFound
+	}
+	apply(&user)
+	user.UpdatedAt = time.Now()
+	r.users[username] = user
+	return nil
+}
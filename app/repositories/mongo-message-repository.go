@@ -0,0 +1,248 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type mongoMessageRepository struct {
+	coll *mongo.Collection
+}
+
+// mongoMessage is a stored message together with its document id.
+type mongoMessage struct {
+	Id                    bson.ObjectID `bson:"_id"`
+	models.MessagePayload `bson:",inline"`
+}
+
+func NewMongoMessageRepository(coll *mongo.Collection) MessageRepository {
+	return &mongoMessageRepository{coll: coll}
+}
+
+func (r *mongoMessageRepository) InsertNewMessage(ctx context.Context, data models.MessagePayload) error {
+
+	span, _ := tracing.StartSpan(ctx, "InsertNewMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("InsertNewMessage", time.Now())
+
+	_, err := r.coll.InsertOne(ctx, data)
+	return err
+}
+
+func (r *mongoMessageRepository) GetAllMessage(ctx context.Context) ([]models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetAllMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetAllMessage", time.Now())
+
+	cursor, err := r.coll.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+	if err != nil {
+		return nil, errors.New("failed to get all messages")
+	}
+	return decodeMessages(ctx, cursor)
+}
+
+func (r *mongoMessageRepository) GetMessages(ctx context.Context, query MessageQuery) ([]models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetMessages", time.Now())
+
+	query = query.Normalize()
+	filter := bson.D{{Key: "room", Value: roomFilter(query.Room)}}
+	if !query.Before.IsZero() {
+		filter = append(filter, bson.E{Key: "date", Value: bson.D{{Key: "$lt", Value: query.Before}}})
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "date", Value: -1}}).
+		SetLimit(int64(query.Limit))
+	cursor, err := r.coll.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.New("failed to get messages")
+	}
+
+	msg, err := decodeMessages(ctx, cursor)
+	slices.Reverse(msg)
+	return msg, err
+}
+
+func (r *mongoMessageRepository) FindMessages(ctx context.Context, filter MessageFilter, limit int) ([]models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "FindMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("FindMessages", time.Now())
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+	cursor, err := r.coll.Find(ctx, messageFilter(filter), opts)
+	if err != nil {
+		return nil, errors.New("failed to find messages")
+	}
+	return decodeMessages(ctx, cursor)
+}
+
+func (r *mongoMessageRepository) DeleteMessages(ctx context.Context, filter MessageFilter, limit int) (int64, error) {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteMessages", time.Now())
+
+	query := messageFilter(filter)
+
+	// DeleteMany has no limit, so a batch is selected by id first.
+	if limit > 0 {
+		opts := options.Find().
+			SetSort(bson.D{{Key: "date", Value: 1}, {Key: "_id", Value: 1}}).
+			SetLimit(int64(limit)).
+			SetProjection(bson.D{{Key: "_id", Value: 1}})
+		cursor, err := r.coll.Find(ctx, query, opts)
+		if err != nil {
+			return 0, err
+		}
+		var docs []struct {
+			Id bson.ObjectID `bson:"_id"`
+		}
+		if err := cursor.All(ctx, &docs); err != nil {
+			return 0, err
+		}
+		if len(docs) == 0 {
+			return 0, nil
+		}
+		ids := make(bson.A, 0, len(docs))
+		for _, doc := range docs {
+			ids = append(ids, doc.Id)
+		}
+		query = bson.D{{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}}
+	}
+
+	result, err := r.coll.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *mongoMessageRepository) GetMessage(ctx context.Context, id string) (models.MessagePayload, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetMessage", time.Now())
+
+	oid, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return models.MessagePayload{}, ErrNotFound
+	}
+	doc := mongoMessage{}
+	err = r.coll.FindOne(ctx, bson.D{{Key: "_id", Value: oid}}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return models.MessagePayload{}, ErrNotFound
+	}
+	if err != nil {
+		return models.MessagePayload{}, err
+	}
+	doc.MessagePayload.Id = doc.Id.Hex()
+	return doc.MessagePayload, nil
+}
+
+func (r *mongoMessageRepository) DeleteMessage(ctx context.Context, id string) error {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteMessage", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteMessage", time.Now())
+
+	oid, err := bson.ObjectIDFromHex(id)
+	if err != nil {
+		return ErrNotFound
+	}
+	result, err := r.coll.DeleteOne(ctx, bson.D{{Key: "_id", Value: oid}})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoMessageRepository) CountMessages(ctx context.Context, filter MessageFilter) (int64, error) {
+
+	span, _ := tracing.StartSpan(ctx, "CountMessages", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CountMessages", time.Now())
+
+	return r.coll.CountDocuments(ctx, messageFilter(filter))
+}
+
+func messageFilter(filter MessageFilter) bson.D {
+	query := bson.D{}
+	room := bson.D{}
+	if len(filter.Rooms) > 0 {
+		room = append(room, bson.E{Key: "$in", Value: roomList(filter.Rooms)})
+	}
+	if len(filter.ExcludeRooms) > 0 {
+		room = append(room, bson.E{Key: "$nin", Value: roomList(filter.ExcludeRooms)})
+	}
+	if len(room) > 0 {
+		query = append(query, bson.E{Key: "room", Value: room})
+	}
+	date := bson.D{}
+	if !filter.After.IsZero() {
+		date = append(date, bson.E{Key: "$gte", Value: filter.After})
+	}
+	if !filter.Before.IsZero() {
+		date = append(date, bson.E{Key: "$lt", Value: filter.Before})
+	}
+	if len(date) > 0 {
+		query = append(query, bson.E{Key: "date", Value: date})
+	}
+	return query
+}
+
+// roomFilter matches the default room also on documents written before
+// messages carried a room.
+func roomFilter(room string) interface{} {
+	if room == "" {
+		return bson.D{{Key: "$in", Value: bson.A{nil, ""}}}
+	}
+	return room
+}
+
+// roomList is the $in/$nin counterpart of roomFilter.
+func roomList(rooms []string) bson.A {
+	list := bson.A{}
+	for _, room := range rooms {
+		list = append(list, room)
+		if room == "" {
+			list = append(list, nil)
+		}
+	}
+	return list
+}
+
+func decodeMessages(ctx context.Context, cursor *mongo.Cursor) ([]models.MessagePayload, error) {
+	defer cursor.Close(ctx)
+
+	var msg []models.MessagePayload
+	for cursor.Next(ctx) {
+		doc := mongoMessage{}
+		err := cursor.Decode(&doc)
+		if err != nil {
+			return msg, errors.New("failed to decode message")
+		}
+		doc.MessagePayload.Id = doc.Id.Hex()
+		msg = append(msg, doc.MessagePayload)
+	}
+	return msg, nil
+}
@@ -0,0 +1,39 @@
+package repositories
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// openTestCollection connects to the MongoDB server named by TEST_MONGODB_URI
+// and returns an empty collection. Tests are skipped when it is unset.
+func openTestCollection(t *testing.T) *mongo.Collection {
+	t.Helper()
+
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI is not set")
+	}
+
+	client, err := mongo.Connect(options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(context.Background()) })
+
+	coll := client.Database("go-chat-app-test").Collection("chat_history")
+	if err := coll.Drop(context.Background()); err != nil {
+		t.Fatalf("failed to drop collection: %v", err)
+	}
+	return coll
+}
+
+func TestMongoMessageRepository(t *testing.T) {
+	testMessageRepository(t, func(t *testing.T) MessageRepository {
+		return NewMongoMessageRepository(openTestCollection(t))
+	})
+}
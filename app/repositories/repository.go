@@ -0,0 +1,281 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotFound  = errors.New("record not found")
+	ErrDuplicate = errors.New("record already exists")
+	// ErrReadOnly is returned for a change to a record that this process
+	// may read but not write, such as an archived message outside the
+	// archive's writer.
+	ErrReadOnly = errors.New("record is read-only in this process")
+)
+
+type UserRepository interface {
+	CreateUser(ctx context.Context, user *models.User) error
+	GetUserByUsername(ctx context.Context, username string) (models.User, error)
+	// SetUserDisabled disables or re-enables an account. It returns
+	// ErrNotFound for an unknown username.
+	SetUserDisabled(ctx context.Context, username string, disabled bool) error
+	UpdateUserPassword(ctx context.Context, username, passwordHash string) error
+	// UpdateTwoFactor stores the TOTP secret of an account and whether it is
+	// in use. An empty secret turns two-factor authentication off.
+	UpdateTwoFactor(ctx context.Context, username, secret string, enabled bool) error
+	// UseTwoFactorStep records step as the time step of the last accepted
+	// TOTP code. It returns ErrNotFound when a code of that or a later step
+	// was accepted before, so each code works once.
+	UseTwoFactorStep(ctx context.Context, username string, step int64) error
+	// ReplaceRecoveryCodes discards the recovery codes of a user and stores
+	// the given hashes instead.
+	ReplaceRecoveryCodes(ctx context.Context, userId uint, hashes []string) error
+	// UseRecoveryCode marks a recovery code as used. It returns ErrNotFound
+	// when the user has no unused code with the hash.
+	UseRecoveryCode(ctx context.Context, userId uint, hash string) error
+	// GetUserByIdentity returns the user an external identity is linked to.
+	GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error)
+	// LinkIdentity links an external identity to identity.UserId. It returns
+	// ErrDuplicate when the identity is already linked.
+	LinkIdentity(ctx context.Context, identity *models.ExternalIdentity) error
+	// CreateUserWithIdentity creates a user linked to an external identity,
+	// or neither. It returns ErrDuplicate when the username is taken or the
+	// identity is already linked.
+	CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.ExternalIdentity) error
+	GetUserById(ctx context.Context, id uint) (models.User, error)
+	GetUserByEmail(ctx context.Context, email string) (models.User, error)
+	// UpdateEmail changes or, with nil, removes the email address of an
+	// account and marks it unverified. It returns ErrDuplicate when another
+	// account has the address.
+	UpdateEmail(ctx context.Context, username string, email *string) error
+	// VerifyEmail marks the address of a user verified. It returns
+	// ErrNotFound when the user's address is no longer email.
+	VerifyEmail(ctx context.Context, userId uint, email string, at time.Time) error
+	// SetUserRole sets the global role of an account. It returns
+	// ErrNotFound for an unknown username.
+	SetUserRole(ctx context.Context, username string, role models.Role) error
+	// ListUsers returns one page of the users matching the query, by id.
+	ListUsers(ctx context.Context, query UserQuery) ([]models.User, error)
+	CountUsers(ctx context.Context) (models.UserStats, error)
+}
+
+// AccountTokenRepository stores the single-use tokens mailed to verify an
+// address or reset a password.
+type AccountTokenRepository interface {
+	// CreateAccountToken stores a verification or password reset token and
+	// discards the user's unused tokens of the same purpose, so only the
+	// latest mail works.
+	CreateAccountToken(ctx context.Context, token *models.AccountToken) error
+	// UseAccountToken marks the token with the hash used and returns it. It
+	// returns ErrNotFound when there is no such unused token of the purpose
+	// or it expired before now.
+	UseAccountToken(ctx context.Context, purpose, hash string, now time.Time) (models.AccountToken, error)
+}
+
+// RoomRoleRepository stores the roles users hold in single rooms.
+type RoomRoleRepository interface {
+	// GetUserRoomRoles returns the roles a user holds in single rooms.
+	GetUserRoomRoles(ctx context.Context, userId uint) ([]models.RoomRole, error)
+	// GetRoomMembers returns the users holding a role in room, by username.
+	GetRoomMembers(ctx context.Context, room string) ([]models.RoomMember, error)
+	// SetRoomRole grants a user a role in room, replacing the one they held
+	// there before.
+	SetRoomRole(ctx context.Context, room string, userId uint, role models.Role) error
+	// DeleteRoomRole returns ErrNotFound when the user holds no role in room.
+	DeleteRoomRole(ctx context.Context, room string, userId uint) error
+}
+
+// SanctionRepository stores the mutes and bans moderators impose in rooms.
+type SanctionRepository interface {
+	// CreateSanction stores a sanction and lifts those of the same kind in
+	// force on the user in the room, which it replaces.
+	CreateSanction(ctx context.Context, sanction *models.Sanction) error
+	// GetActiveSanctions returns the sanctions in force at now on a user in
+	// room.
+	GetActiveSanctions(ctx context.Context, room string, userId uint, now time.Time) ([]models.Sanction, error)
+	// GetRoomSanctions describes the sanctions in force at now in room,
+	// newest first.
+	GetRoomSanctions(ctx context.Context, room string, now time.Time) ([]models.SanctionResponse, error)
+	// LiftSanction lifts the sanctions of kind in force on a user in room.
+	// It returns ErrNotFound when there is none.
+	LiftSanction(ctx context.Context, room string, userId uint, kind models.SanctionKind, now time.Time) error
+	// LiftExpiredSanctions marks the sanctions that expired by now lifted and
+	// returns them.
+	LiftExpiredSanctions(ctx context.Context, now time.Time) ([]models.Sanction, error)
+}
+
+const (
+	DefaultUserLimit = 50
+	MaxUserLimit     = 500
+)
+
+// UserQuery selects one page of users. Search, when set, matches part of the
+// username, full name or email address, ignoring case.
+type UserQuery struct {
+	Search string
+	Limit  int
+	Offset int
+}
+
+// Normalize applies the default and maximum page size.
+func (q UserQuery) Normalize() UserQuery {
+	if q.Limit <= 0 {
+		q.Limit = DefaultUserLimit
+	}
+	if q.Limit > MaxUserLimit {
+		q.Limit = MaxUserLimit
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	return q
+}
+
+type SessionRepository interface {
+	CreateUserSession(ctx context.Context, session *models.UserSession) error
+	DeleteUserSession(ctx context.Context, token string) error
+	// GetUserSession looks a session up by the jti of its access token.
+	GetUserSession(ctx context.Context, token string) (models.UserSession, error)
+	GetUserSessionById(ctx context.Context, id uint) (models.UserSession, error)
+	// UpdateUserSessionTokens rotates the tokens of the session holding
+	// oldRefreshToken and remembers oldRefreshToken as rotated. It returns
+	// ErrNotFound when no session holds oldRefreshToken, including when a
+	// concurrent call rotated it first.
+	UpdateUserSessionTokens(ctx context.Context, accessToken, refreshToken string,
+		tokenExpired, refreshTokenExpired time.Time, oldRefreshToken string) error
+	GetUserSessionByRefreshToken(ctx context.Context, refreshToken string) (models.UserSession, error)
+	// GetRotatedRefreshToken returns ErrNotFound unless refreshToken was
+	// rotated and has not expired yet.
+	GetRotatedRefreshToken(ctx context.Context, refreshToken string) (models.RotatedRefreshToken, error)
+	// DeleteUserSessionById returns ErrNotFound when no session has the id.
+	DeleteUserSessionById(ctx context.Context, id uint) error
+	// DeleteUserSessions revokes every session of a user and returns how
+	// many were deleted.
+	DeleteUserSessions(ctx context.Context, userId uint) (int64, error)
+	// GetUserSessions returns every session of a user, newest first.
+	GetUserSessions(ctx context.Context, userId uint) ([]models.UserSession, error)
+	// TouchUserSession records that a session was used at the given time.
+	TouchUserSession(ctx context.Context, id uint, at time.Time) error
+	// CountActiveSessions counts the sessions whose refresh token has not
+	// expired at now.
+	CountActiveSessions(ctx context.Context, now time.Time) (int64, error)
+}
+
+// RevocationRepository records access tokens, by jti, that must be rejected
+// before they expire.
+type RevocationRepository interface {
+	RevokeToken(ctx context.Context, id string, expires time.Time) error
+	IsTokenRevoked(ctx context.Context, id string) (bool, error)
+}
+
+const (
+	DefaultMessageLimit = 50
+	MaxMessageLimit     = 500
+)
+
+// MessageQuery selects one page of a room's history: the Limit newest
+// messages sent strictly before Before. A zero Before means no upper bound.
+type MessageQuery struct {
+	Room   string
+	Before time.Time
+	Limit  int
+}
+
+// Normalize applies the default and maximum page size.
+func (q MessageQuery) Normalize() MessageQuery {
+	if q.Limit <= 0 {
+		q.Limit = DefaultMessageLimit
+	}
+	if q.Limit > MaxMessageLimit {
+		q.Limit = MaxMessageLimit
+	}
+	return q
+}
+
+// MessageFilter selects messages across rooms for bulk operations. An empty
+// Rooms matches every room except those in ExcludeRooms. Messages match from
+// After inclusive to Before exclusive; a zero bound is open.
+type MessageFilter struct {
+	Rooms        []string
+	ExcludeRooms []string
+	After        time.Time
+	Before       time.Time
+}
+
+// Match reports whether msg is selected by the filter.
+func (f MessageFilter) Match(msg models.MessagePayload) bool {
+	if len(f.Rooms) > 0 && !slices.Contains(f.Rooms, msg.Room) {
+		return false
+	}
+	if slices.Contains(f.ExcludeRooms, msg.Room) {
+		return false
+	}
+	if !f.After.IsZero() && msg.Date.Before(f.After) {
+		return false
+	}
+	return f.Before.IsZero() || msg.Date.Before(f.Before)
+}
+
+type MessageRepository interface {
+	InsertNewMessage(ctx context.Context, data models.MessagePayload) error
+	// GetAllMessage returns every message of every room, oldest first.
+	GetAllMessage(ctx context.Context) ([]models.MessagePayload, error)
+	// GetMessages returns one page of history, oldest first.
+	GetMessages(ctx context.Context, query MessageQuery) ([]models.MessagePayload, error)
+	// FindMessages returns up to limit of the oldest messages matching the
+	// filter, or all of them when limit is 0, oldest first.
+	FindMessages(ctx context.Context, filter MessageFilter, limit int) ([]models.MessagePayload, error)
+	// DeleteMessages deletes up to limit of the oldest messages matching the
+	// filter, or all of them when limit is 0, and returns how many it deleted.
+	DeleteMessages(ctx context.Context, filter MessageFilter, limit int) (int64, error)
+	// GetMessage returns the message with the id, or ErrNotFound as
+	// DeleteMessage does.
+	GetMessage(ctx context.Context, id string) (models.MessagePayload, error)
+	// DeleteMessage deletes the message with the id. It returns ErrNotFound
+	// when there is none, including for an id the store cannot have issued.
+	DeleteMessage(ctx context.Context, id string) error
+	CountMessages(ctx context.Context, filter MessageFilter) (int64, error)
+}
+
+// LoginAttemptRepository counts failed logins per key, such as a username
+// or a client IP. Failures before since are forgotten.
+type LoginAttemptRepository interface {
+	// GetLoginAttempt returns ErrNotFound when key has no failure since
+	// since.
+	GetLoginAttempt(ctx context.Context, key string, since time.Time) (models.LoginAttempt, error)
+	// RecordLoginFailure counts a failure of key at the given time and
+	// returns the updated count.
+	RecordLoginFailure(ctx context.Context, key string, at, since time.Time) (models.LoginAttempt, error)
+	ClearLoginAttempts(ctx context.Context, key string) error
+}
+
+// Repositories bundles the stores the application is wired with.
+type Repositories struct {
+	Users         UserRepository
+	AccountTokens AccountTokenRepository
+	RoomRoles     RoomRoleRepository
+	Sanctions     SanctionRepository
+	Sessions      SessionRepository
+	Messages      MessageRepository
+	Revocations   RevocationRepository
+	LoginAttempts LoginAttemptRepository
+}
+
+// translateError maps GORM errors onto the repository errors so callers do
+// not depend on the storage backend.
+func translateError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrNotFound
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrDuplicate
+	default:
+		return err
+	}
+}
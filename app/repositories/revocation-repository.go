@@ -0,0 +1,51 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type revocationRepository struct {
+	db *gorm.DB
+}
+
+// NewRevocationRepository returns a RevocationRepository on the relational
+// database, shared by every instance and the command line.
+func NewRevocationRepository(db *gorm.DB) RevocationRepository {
+	return &revocationRepository{db: db}
+}
+
+func (r *revocationRepository) RevokeToken(ctx context.Context, id string, expires time.Time) error {
+
+	span, _ := tracing.StartSpan(ctx, "RevokeToken", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("RevokeToken", time.Now())
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Expired tokens are rejected anyway, so their rows can go.
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RevokedToken{Id: id, ExpiresAt: expires}).Error
+	})
+}
+
+func (r *revocationRepository) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+
+	span, _ := tracing.StartSpan(ctx, "IsTokenRevoked", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("IsTokenRevoked", time.Now())
+
+	var count int64
+	err := r.db.WithContext(ctx).Model(&models.RevokedToken{}).
+		Where("id = ? AND expires_at >= ?", id, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type roomRoleRepository struct {
+	db *gorm.DB
+}
+
+// NewRoomRoleRepository returns a RoomRoleRepository on the relational
+// database.
+func NewRoomRoleRepository(db *gorm.DB) RoomRoleRepository {
+	return &roomRoleRepository{db: db}
+}
+
+func (r *roomRoleRepository) GetUserRoomRoles(ctx context.Context, userId uint) ([]models.RoomRole, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetUserRoomRoles", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetUserRoomRoles", time.Now())
+
+	var roles []models.RoomRole
+	return roles, translateError(r.db.WithContext(ctx).Where("user_id = ?", userId).Order("room").Find(&roles).Error)
+}
+
+func (r *roomRoleRepository) GetRoomMembers(ctx context.Context, room string) ([]models.RoomMember, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetRoomMembers", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetRoomMembers", time.Now())
+
+	members := []models.RoomMember{}
+	return members, translateError(r.db.WithContext(ctx).Model(&models.RoomRole{}).
+		Select("users.username, room_roles.role").
+		Joins("JOIN users ON users.id = room_roles.user_id").
+		Where("room_roles.room = ?", room).
+		Order("users.username").
+		Scan(&members).Error)
+}
+
+func (r *roomRoleRepository) SetRoomRole(ctx context.Context, room string, userId uint, role models.Role) error {
+
+	span, _ := tracing.StartSpan(ctx, "SetRoomRole", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("SetRoomRole", time.Now())
+
+	return translateError(r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "room"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"role"}),
+	}).Create(&models.RoomRole{Room: room, UserId: userId, Role: role}).Error)
+}
+
+func (r *roomRoleRepository) DeleteRoomRole(ctx context.Context, room string, userId uint) error {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteRoomRole", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteRoomRole", time.Now())
+
+	result := r.db.WithContext(ctx).Where("room = ? AND user_id = ?", room, userId).Delete(&models.RoomRole{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
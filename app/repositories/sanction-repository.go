@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type sanctionRepository struct {
+	db *gorm.DB
+}
+
+// NewSanctionRepository returns a SanctionRepository on the relational
+// database.
+func NewSanctionRepository(db *gorm.DB) SanctionRepository {
+	return &sanctionRepository{db: db}
+}
+
+func (r *sanctionRepository) CreateSanction(ctx context.Context, sanction *models.Sanction) error {
+
+	span, _ := tracing.StartSpan(ctx, "CreateSanction", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CreateSanction", time.Now())
+
+	if sanction.CreatedAt.IsZero() {
+		sanction.CreatedAt = time.Now()
+	}
+	return translateError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := activeSanctions(tx.Model(&models.Sanction{}), sanction.CreatedAt).
+			Where("room = ? AND user_id = ? AND kind = ?", sanction.Room, sanction.UserId, sanction.Kind).
+			Update("lifted_at", sanction.CreatedAt).Error; err != nil {
+			return err
+		}
+		return tx.Create(sanction).Error
+	}))
+}
+
+func (r *sanctionRepository) GetActiveSanctions(ctx context.Context, room string, userId uint, now time.Time) ([]models.Sanction, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetActiveSanctions", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetActiveSanctions", time.Now())
+
+	var sanctions []models.Sanction
+	return sanctions, translateError(activeSanctions(r.db.WithContext(ctx), now).
+		Where("room = ? AND user_id = ?", room, userId).
+		Order("id").
+		Find(&sanctions).Error)
+}
+
+func (r *sanctionRepository) GetRoomSanctions(ctx context.Context, room string, now time.Time) ([]models.SanctionResponse, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetRoomSanctions", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetRoomSanctions", time.Now())
+
+	var sanctions []models.Sanction
+	err := activeSanctions(r.db.WithContext(ctx), now).Where("room = ?", room).Order("id DESC").Find(&sanctions).Error
+	if err != nil {
+		return nil, translateError(err)
+	}
+
+	ids := make([]uint, 0, 2*len(sanctions))
+	for _, sanction := range sanctions {
+		ids = append(ids, sanction.UserId, sanction.ModeratorId)
+	}
+	var users []models.User
+	if err := r.db.WithContext(ctx).Select("id", "username").Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return sanctionResponses(sanctions, users), nil
+}
+
+func (r *sanctionRepository) LiftSanction(ctx context.Context, room string, userId uint, kind models.SanctionKind, now time.Time) error {
+
+	span, _ := tracing.StartSpan(ctx, "LiftSanction", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("LiftSanction", time.Now())
+
+	result := activeSanctions(r.db.WithContext(ctx).Model(&models.Sanction{}), now).
+		Where("room = ? AND user_id = ? AND kind = ?", room, userId, kind).
+		Update("lifted_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sanctionRepository) LiftExpiredSanctions(ctx context.Context, now time.Time) ([]models.Sanction, error) {
+
+	span, _ := tracing.StartSpan(ctx, "LiftExpiredSanctions", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("LiftExpiredSanctions", time.Now())
+
+	var lifted []models.Sanction
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var expired []models.Sanction
+		if err := tx.Where("lifted_at IS NULL AND expires_at <= ?", now).Order("id").Find(&expired).Error; err != nil {
+			return err
+		}
+		// Another instance may be sweeping too; only rows this update still
+		// finds unlifted count as lifted here.
+		for _, sanction := range expired {
+			result := tx.Model(&models.Sanction{}).Where("id = ? AND lifted_at IS NULL", sanction.Id).Update("lifted_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 1 {
+				sanction.LiftedAt = &now
+				lifted = append(lifted, sanction)
+			}
+		}
+		return nil
+	})
+	return lifted, translateError(err)
+}
+
+// activeSanctions restricts tx to the sanctions in force at now.
+func activeSanctions(tx *gorm.DB, now time.Time) *gorm.DB {
+	return tx.Where("lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", now)
+}
+
+// sanctionResponses describes sanctions, naming the users and moderators by
+// their usernames from users.
+func sanctionResponses(sanctions []models.Sanction, users []models.User) []models.SanctionResponse {
+	usernames := make(map[uint]string, len(users))
+	for _, user := range users {
+		usernames[user.Id] = user.Username
+	}
+	responses := make([]models.SanctionResponse, 0, len(sanctions))
+	for _, sanction := range sanctions {
+		responses = append(responses, models.SanctionResponse{
+			Id:        sanction.Id,
+			Room:      sanction.Room,
+			Username:  usernames[sanction.UserId],
+			Kind:      sanction.Kind,
+			Moderator: usernames[sanction.ModeratorId],
+			Reason:    sanction.Reason,
+			ExpiresAt: sanction.ExpiresAt,
+			CreatedAt: sanction.CreatedAt,
+		})
+	}
+	return responses
+}
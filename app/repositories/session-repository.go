@@ -0,0 +1,177 @@
+package repositories
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) CreateUserSession(ctx context.Context, session *models.UserSession) error {
+	span, _ := tracing.StartSpan(ctx, "CreateUserSession", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CreateUserSession", time.Now())
+
+	return translateError(r.db.WithContext(ctx).Create(session).Error)
+}
+
+func (r *sessionRepository) DeleteUserSession(ctx context.Context, token string) error {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteUserSession", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteUserSession", time.Now())
+
+	return r.db.WithContext(ctx).Where("token = ?", token).Delete(&models.UserSession{}).Error
+}
+
+func (r *sessionRepository) GetUserSession(ctx context.Context, token string) (models.UserSession, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetUserSession", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetUserSession", time.Now())
+
+	var session models.UserSession
+	return session, translateError(r.db.WithContext(ctx).Where("token = ?", token).Last(&session).Error)
+}
+
+func (r *sessionRepository) GetUserSessionById(ctx context.Context, id uint) (models.UserSession, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetUserSessionById", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetUserSessionById", time.Now())
+
+	var session models.UserSession
+	return session, translateError(r.db.WithContext(ctx).Where("id = ?", id).First(&session).Error)
+}
+
+func (r *sessionRepository) UpdateUserSessionTokens(ctx context.Context, accessToken, refreshToken string,
+	tokenExpired, refreshTokenExpired time.Time, oldRefreshToken string) error {
+
+	span, _ := tracing.StartSpan(ctx, "UpdateUserSessionTokens", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("UpdateUserSessionTokens", time.Now())
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var session models.UserSession
+		if err := tx.Where("refresh_token = ?", oldRefreshToken).Last(&session).Error; err != nil {
+			return translateError(err)
+		}
+
+		// Matching the old token again makes the update a compare-and-swap,
+		// so of two concurrent rotations only one succeeds.
+		result := tx.Model(&models.UserSession{}).
+			Where("id = ? AND refresh_token = ?", session.Id, oldRefreshToken).
+			Updates(map[string]interface{}{
+				"token":                 accessToken,
+				"refresh_token":         refreshToken,
+				"token_expired":         tokenExpired,
+				"refresh_token_expired": refreshTokenExpired,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		// Expired tokens are rejected anyway, so their records can go.
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RotatedRefreshToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.RotatedRefreshToken{
+			SessionId: session.Id,
+			UserId:    session.UserId,
+			TokenHash: oldRefreshToken,
+			ExpiresAt: session.RefreshTokenExpired,
+		}).Error
+	})
+}
+
+func (r *sessionRepository) GetUserSessionByRefreshToken(ctx context.Context, refreshToken string) (models.UserSession, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetUserSessionByRefreshToken", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetUserSessionByRefreshToken", time.Now())
+
+	var session models.UserSession
+	return session, translateError(r.db.WithContext(ctx).Where("refresh_token = ?", refreshToken).Last(&session).Error)
+}
+
+func (r *sessionRepository) GetRotatedRefreshToken(ctx context.Context, refreshToken string) (models.RotatedRefreshToken, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetRotatedRefreshToken", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetRotatedRefreshToken", time.Now())
+
+	var rotated models.RotatedRefreshToken
+	return rotated, translateError(r.db.WithContext(ctx).
+		Where("token_hash = ? AND expires_at >= ?", refreshToken, time.Now()).
+		Last(&rotated).Error)
+}
+
+func (r *sessionRepository) DeleteUserSessionById(ctx context.Context, id uint) error {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteUserSessionById", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteUserSessionById", time.Now())
+
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.UserSession{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *sessionRepository) DeleteUserSessions(ctx context.Context, userId uint) (int64, error) {
+
+	span, _ := tracing.StartSpan(ctx, "DeleteUserSessions", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("DeleteUserSessions", time.Now())
+
+	result := r.db.WithContext(ctx).Where("user_id = ?", userId).Delete(&models.UserSession{})
+	return result.RowsAffected, result.Error
+}
+
+func (r *sessionRepository) GetUserSessions(ctx context.Context, userId uint) ([]models.UserSession, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetUserSessions", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetUserSessions", time.Now())
+
+	var sessions []models.UserSession
+	return sessions, r.db.WithContext(ctx).Where("user_id = ?", userId).Order("id DESC").Find(&sessions).Error
+}
+
+func (r *sessionRepository) CountActiveSessions(ctx context.Context, now time.Time) (int64, error) {
+
+	span, _ := tracing.StartSpan(ctx, "CountActiveSessions", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CountActiveSessions", time.Now())
+
+	var count int64
+	return count, r.db.WithContext(ctx).Model(&models.UserSession{}).Where("refresh_token_expired > ?", now).Count(&count).Error
+}
+
+func (r *sessionRepository) TouchUserSession(ctx context.Context, id uint, at time.Time) error {
+
+	span, _ := tracing.StartSpan(ctx, "TouchUserSession", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("TouchUserSession", time.Now())
+
+	// UpdateColumn leaves updated_at alone; it tracks changes to the tokens.
+	return r.db.WithContext(ctx).Model(&models.UserSession{}).Where("id = ?", id).UpdateColumn("last_used_at", at).Error
+}
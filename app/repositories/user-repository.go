@@ -3,69 +3,270 @@ package repositories
 import (
 	"context"
 	"go-chat-app/app/models"
-	"go-chat-app/pkg/database"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"strings"
 	"time"
 
-	"go.elastic.co/apm"
+	"gorm.io/gorm"
 )
 
-func CreateUser(ctx context.Context, user *models.User) error {
-	span, _ := apm.StartSpan(ctx, "CreateUser", "repository")
+type userRepository struct {
+	db *gorm.DB
+}
+
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &userRepository{db: db}
+}
+
+func (r *userRepository) CreateUser(ctx context.Context, user *models.User) error {
+	span, _ := tracing.StartSpan(ctx, "CreateUser", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CreateUser", time.Now())
+
+	return translateError(r.db.WithContext(ctx).Create(user).Error)
+}
+
+func (r *userRepository) GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetUserByUsername", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetUserByUsername", time.Now())
+
+	var user models.User
+	return user, translateError(r.db.WithContext(ctx).Where("username = ?", username).Last(&user).Error)
+}
+
+func (r *userRepository) SetUserDisabled(ctx context.Context, username string, disabled bool) error {
+
+	span, _ := tracing.StartSpan(ctx, "SetUserDisabled", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("SetUserDisabled", time.Now())
+
+	var disabledAt *time.Time
+	if disabled {
+		now := time.Now()
+		disabledAt = &now
+	}
+	return r.update(ctx, username, map[string]interface{}{"disabled_at": disabledAt})
+}
+
+func (r *userRepository) UpdateUserPassword(ctx context.Context, username, passwordHash string) error {
+
+	span, _ := tracing.StartSpan(ctx, "UpdateUserPassword", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("UpdateUserPassword", time.Now())
+
+	return r.update(ctx, username, map[string]interface{}{"password": passwordHash})
+}
+
+func (r *userRepository) UpdateTwoFactor(ctx context.Context, username, secret string, enabled bool) error {
+
+	span, _ := tracing.StartSpan(ctx, "UpdateTwoFactor", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("UpdateTwoFactor", time.Now())
+
+	var enabledAt *time.Time
+	if enabled {
+		now := time.Now()
+		enabledAt = &now
+	}
+	return r.update(ctx, username, map[string]interface{}{"two_factor_secret": secret, "two_factor_enabled_at": enabledAt})
+}
+
+func (r *userRepository) UseTwoFactorStep(ctx context.Context, username string, step int64) error {
+
+	span, _ := tracing.StartSpan(ctx, "UseTwoFactorStep", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("UseTwoFactorStep", time.Now())
+
+	// Comparing with the stored step makes concurrent uses of one code a
+	// compare-and-swap that only one of them wins.
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("username = ? AND two_factor_last_step < ?", username, step).
+		UpdateColumn("two_factor_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) ReplaceRecoveryCodes(ctx context.Context, userId uint, hashes []string) error {
+
+	span, _ := tracing.StartSpan(ctx, "ReplaceRecoveryCodes", "repository")
 	defer span.End()
+	defer metrics.ObserveRepository("ReplaceRecoveryCodes", time.Now())
 
-	return database.DB.Create(user).Error
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if len(hashes) == 0 {
+			return nil
+		}
+		codes := make([]models.RecoveryCode, 0, len(hashes))
+		for _, hash := range hashes {
+			codes = append(codes, models.RecoveryCode{UserId: userId, CodeHash: hash})
+		}
+		return tx.Create(&codes).Error
+	})
 }
 
-func GetUserByUsername(ctx context.Context, username string) (models.User, error) {
+func (r *userRepository) UseRecoveryCode(ctx context.Context, userId uint, hash string) error {
 
-	span, _ := apm.StartSpan(ctx, "GetUserByUsername", "repository")
+	span, _ := tracing.StartSpan(ctx, "UseRecoveryCode", "repository")
 	defer span.End()
+	defer metrics.ObserveRepository("UseRecoveryCode", time.Now())
+
+	result := r.db.WithContext(ctx).Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userId, hash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) GetUserByIdentity(ctx context.Context, issuer, subject string) (models.User, error) {
+
+	span, _ := tracing.StartSpan(ctx, "GetUserByIdentity", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("GetUserByIdentity", time.Now())
 
 	var user models.User
-	return user, database.DB.Where("username = ?", username).Last(&user).Error
+	return user, translateError(r.db.WithContext(ctx).
+		Joins("JOIN external_identities ON external_identities.user_id = users.id").
+		Where("external_identities.issuer = ? AND external_identities.subject = ?", issuer, subject).
+		First(&user).Error)
 }
 
-func CreateUserSession(ctx context.Context, session *models.UserSession) error {
-	span, _ := apm.StartSpan(ctx, "CreateUserSession", "repository")
+func (r *userRepository) LinkIdentity(ctx context.Context, identity *models.ExternalIdentity) error {
+
+	span, _ := tracing.StartSpan(ctx, "LinkIdentity", "repository")
 	defer span.End()
+	defer metrics.ObserveRepository("LinkIdentity", time.Now())
 
-	return database.DB.Create(session).Error
+	return translateError(r.db.WithContext(ctx).Create(identity).Error)
 }
 
-func DeleteUserSession(ctx context.Context, token string) error {
+func (r *userRepository) CreateUserWithIdentity(ctx context.Context, user *models.User, identity *models.ExternalIdentity) error {
 
-	span, _ := apm.StartSpan(ctx, "DeleteUserSession", "repository")
+	span, _ := tracing.StartSpan(ctx, "CreateUserWithIdentity", "repository")
 	defer span.End()
+	defer metrics.ObserveRepository("CreateUserWithIdentity", time.Now())
 
-	return database.DB.Exec("DELETE FROM user_sessions WHERE token = ?", token).Error
+	return translateError(r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		identity.UserId = user.Id
+		return tx.Create(identity).Error
+	}))
 }
 
-func GetUserSession(ctx context.Context, token string) (models.UserSession, error) {
+func (r *userRepository) GetUserById(ctx context.Context, id uint) (models.User, error) {
 
-	span, _ := apm.StartSpan(ctx, "GetUserSession", "repository")
+	span, _ := tracing.StartSpan(ctx, "GetUserById", "repository")
 	defer span.End()
+	defer metrics.ObserveRepository("GetUserById", time.Now())
 
-	var session models.UserSession
-	return session, database.DB.Where("token = ?", token).Last(&session).Error
+	var user models.User
+	return user, translateError(r.db.WithContext(ctx).Where("id = ?", id).First(&user).Error)
 }
 
-func UpdateUserSessionTokens(ctx context.Context, accessToken, refreshToken string,
-	tokenExpired, refreshTokenExpired time.Time, oldRefreshToken string) error {
+func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (models.User, error) {
 
-	span, _ := apm.StartSpan(ctx, "UpdateUserSessionTokens", "repository")
+	span, _ := tracing.StartSpan(ctx, "GetUserByEmail", "repository")
 	defer span.End()
+	defer metrics.ObserveRepository("GetUserByEmail", time.Now())
 
-	return database.DB.Exec(`UPDATE user_sessions 
-        SET token = ?, refresh_token = ?, token_expired = ?, refresh_token_expired = ?, updated_at = ? 
-        WHERE refresh_token = ?`,
-		accessToken, refreshToken, tokenExpired, refreshTokenExpired, time.Now(), oldRefreshToken).Error
+	var user models.User
+	return user, translateError(r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error)
+}
+
+func (r *userRepository) UpdateEmail(ctx context.Context, username string, email *string) error {
+
+	span, _ := tracing.StartSpan(ctx, "UpdateEmail", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("UpdateEmail", time.Now())
+
+	return translateError(r.update(ctx, username, map[string]interface{}{"email": email, "email_verified_at": nil}))
 }
 
-func GetUserSessionByRefreshToken(ctx context.Context, refreshToken string) (models.UserSession, error) {
+func (r *userRepository) VerifyEmail(ctx context.Context, userId uint, email string, at time.Time) error {
 
-	span, _ := apm.StartSpan(ctx, "GetUserSessionByRefreshToken", "repository")
+	span, _ := tracing.StartSpan(ctx, "VerifyEmail", "repository")
 	defer span.End()
+	defer metrics.ObserveRepository("VerifyEmail", time.Now())
+
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND email = ?", userId, email).
+		Update("email_verified_at", at)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *userRepository) SetUserRole(ctx context.Context, username string, role models.Role) error {
+
+	span, _ := tracing.StartSpan(ctx, "SetUserRole", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("SetUserRole", time.Now())
+
+	return r.update(ctx, username, map[string]interface{}{"role": role})
+}
+
+func (r *userRepository) ListUsers(ctx context.Context, query UserQuery) ([]models.User, error) {
+
+	span, _ := tracing.StartSpan(ctx, "ListUsers", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("ListUsers", time.Now())
+
+	query = query.Normalize()
+	tx := r.db.WithContext(ctx)
+	if query.Search != "" {
+		// ! escapes the wildcards; a backslash would need quoting in MySQL.
+		pattern := "%" + strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(strings.ToLower(query.Search)) + "%"
+		tx = tx.Where("LOWER(username) LIKE ? ESCAPE '!' OR LOWER(full_name) LIKE ? ESCAPE '!' OR LOWER(email) LIKE ? ESCAPE '!'",
+			pattern, pattern, pattern)
+	}
+
+	var users []models.User
+	return users, translateError(tx.Order("id").Limit(query.Limit).Offset(query.Offset).Find(&users).Error)
+}
+
+func (r *userRepository) CountUsers(ctx context.Context) (models.UserStats, error) {
+
+	span, _ := tracing.StartSpan(ctx, "CountUsers", "repository")
+	defer span.End()
+	defer metrics.ObserveRepository("CountUsers", time.Now())
+
+	var stats models.UserStats
+	err := r.db.WithContext(ctx).Model(&models.User{}).
+		Select("COUNT(*) AS total, COUNT(disabled_at) AS disabled, COALESCE(SUM(CASE WHEN role = ? THEN 1 ELSE 0 END), 0) AS admins", models.RoleAdmin).
+		Scan(&stats).Error
+	return stats, translateError(err)
+}
 
-	var session models.UserSession
-	return session, database.DB.Where("refresh_token = ?", refreshToken).Last(&session).Error
+// update also bumps updated_at, so a matching row always counts as affected
+// even when the other values are unchanged.
+func (r *userRepository) update(ctx context.Context, username string, values map[string]interface{}) error {
+	result := r.db.WithContext(ctx).Model(&models.User{}).Where("username = ?", username).Updates(values)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
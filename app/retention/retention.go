@@ -0,0 +1,107 @@
+package retention
+
+import (
+	"context"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// DefaultPolicy is the policy name of RetentionConfig.Default in audit
+// records and metrics.
+const DefaultPolicy = "default"
+
+// Job deletes messages that have outlived their retention. Each room with its
+// own policy is purged separately; Default covers every other room. Deletion
+// is idempotent, so several replicas may run the job at the same time.
+type Job struct {
+	messages repositories.MessageRepository
+	cfg      config.RetentionConfig
+	now      func() time.Time
+}
+
+func NewJob(messages repositories.MessageRepository, cfg config.RetentionConfig) *Job {
+	return &Job{messages: messages, cfg: cfg, now: time.Now}
+}
+
+// Run applies the policies every cfg.Interval until ctx is cancelled.
+func (j *Job) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := j.RunOnce(ctx); err != nil {
+			slog.ErrorContext(ctx, "retention run failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce applies every policy once and returns the number of messages
+// deleted.
+func (j *Job) RunOnce(ctx context.Context) (int64, error) {
+	tx, ctx := tracing.StartTransaction(ctx, "Retention", "job")
+	defer tx.End()
+
+	now := j.now()
+	rooms := slices.Sorted(maps.Keys(j.cfg.Rooms))
+
+	var total int64
+	for _, room := range rooms {
+		maxAge := j.cfg.Rooms[room]
+		if maxAge == 0 {
+			continue
+		}
+		filter := repositories.MessageFilter{Rooms: []string{room}, Before: now.Add(-maxAge)}
+		deleted, err := j.apply(ctx, "room:"+room, maxAge, filter)
+		total += deleted
+		if err != nil {
+			tx.RecordError(err)
+			return total, err
+		}
+	}
+
+	if j.cfg.Default > 0 {
+		filter := repositories.MessageFilter{ExcludeRooms: rooms, Before: now.Add(-j.cfg.Default)}
+		deleted, err := j.apply(ctx, DefaultPolicy, j.cfg.Default, filter)
+		total += deleted
+		if err != nil {
+			tx.RecordError(err)
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// apply purges one policy in batches and audit-logs the outcome, including
+// partial progress when a batch fails.
+func (j *Job) apply(ctx context.Context, policy string, maxAge time.Duration, filter repositories.MessageFilter) (int64, error) {
+	var deleted int64
+	var err error
+	for {
+		var n int64
+		n, err = j.messages.DeleteMessages(ctx, filter, j.cfg.BatchSize)
+		deleted += n
+		if err != nil || n < int64(j.cfg.BatchSize) {
+			break
+		}
+	}
+	metrics.MessagesPurged.WithLabelValues(policy).Add(float64(deleted))
+
+	args := []any{"policy", policy, "max_age", maxAge.String(), "cutoff", filter.Before, "deleted", deleted}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logger.Audit(ctx, "retention applied", args...)
+	return deleted, err
+}
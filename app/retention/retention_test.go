@@ -0,0 +1,64 @@
+package retention
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/config"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRunOnce(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	messages := repositories.NewMemoryMessageRepository()
+
+	seed := []struct {
+		room string
+		age  time.Duration
+	}{
+		{"", 100 * 24 * time.Hour},
+		{"", 10 * 24 * time.Hour},
+		{"ops", 40 * 24 * time.Hour},
+		{"ops", 20 * 24 * time.Hour},
+		{"legal", 400 * 24 * time.Hour},
+		{"dev", 95 * 24 * time.Hour},
+	}
+	for _, s := range seed {
+		msg := models.MessagePayload{Room: s.room, From: "alice01", Message: s.room + " " + s.age.String(), Date: now.Add(-s.age)}
+		if err := messages.InsertNewMessage(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	job := NewJob(messages, config.RetentionConfig{
+		Default:   90 * 24 * time.Hour,
+		Rooms:     map[string]time.Duration{"ops": 30 * 24 * time.Hour, "legal": 0},
+		BatchSize: 1,
+	})
+	job.now = func() time.Time { return now }
+
+	deleted, err := job.RunOnce(ctx)
+	if err != nil {
+		t.Fatalf("RunOnce: %v", err)
+	}
+	if deleted != 3 {
+		t.Errorf("deleted %d messages, want 3", deleted)
+	}
+
+	remaining, _ := messages.GetAllMessage(ctx)
+	var rooms []string
+	for _, msg := range remaining {
+		rooms = append(rooms, msg.Room)
+	}
+	slices.Sort(rooms)
+	if !slices.Equal(rooms, []string{"", "legal", "ops"}) {
+		t.Errorf("remaining rooms = %q", rooms)
+	}
+
+	if deleted, err := job.RunOnce(ctx); err != nil || deleted != 0 {
+		t.Errorf("second run deleted %d messages, err %v", deleted, err)
+	}
+}
@@ -0,0 +1,76 @@
+package revocation
+
+import (
+	"context"
+	"go-chat-app/app/repositories"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	revoked bool
+	// expires is when the entry must be checked against the backend again.
+	expires time.Time
+}
+
+// Cache answers IsTokenRevoked from memory and asks its backend at most once
+// per ttl and token. Revocations made through the cache take effect in this
+// process at once; other processes see them once their entry expires.
+type Cache struct {
+	backend repositories.RevocationRepository
+	ttl     time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]entry
+	swept   time.Time
+}
+
+func NewCache(backend repositories.RevocationRepository, ttl time.Duration) *Cache {
+	return &Cache{backend: backend, ttl: ttl, now: time.Now, entries: make(map[string]entry)}
+}
+
+// RevokeToken records the revocation in the backend. The token is rejected
+// by this process even when the backend fails.
+func (c *Cache) RevokeToken(ctx context.Context, id string, expires time.Time) error {
+	err := c.backend.RevokeToken(ctx, id, expires)
+	c.store(id, entry{revoked: true, expires: expires})
+	return err
+}
+
+func (c *Cache) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	now := c.now()
+	c.mu.Lock()
+	e, ok := c.entries[id]
+	c.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.revoked, nil
+	}
+
+	revoked, err := c.backend.IsTokenRevoked(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	c.store(id, entry{revoked: revoked, expires: now.Add(c.ttl)})
+	return revoked, nil
+}
+
+func (c *Cache) store(id string, e entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if now.Sub(c.swept) > c.ttl {
+		for key, old := range c.entries {
+			if !now.Before(old.expires) {
+				delete(c.entries, key)
+			}
+		}
+		c.swept = now
+	}
+	// A lookup that raced with a revocation must not undo it.
+	if old, ok := c.entries[id]; ok && old.revoked && !e.revoked && now.Before(old.expires) {
+		return
+	}
+	c.entries[id] = e
+}
@@ -0,0 +1,109 @@
+package revocation
+
+import (
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"testing"
+	"time"
+)
+
+// countingBackend counts the lookups that reach the backend.
+type countingBackend struct {
+	repositories.RevocationRepository
+	lookups int
+}
+
+func (b *countingBackend) IsTokenRevoked(ctx context.Context, id string) (bool, error) {
+	b.lookups++
+	return b.RevocationRepository.IsTokenRevoked(ctx, id)
+}
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	backend := &countingBackend{RevocationRepository: repositories.NewMemoryRevocationRepository()}
+	cache := NewCache(backend, 30*time.Second)
+	cache.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if revoked, err := cache.IsTokenRevoked(ctx, "jti-1"); err != nil || revoked {
+			t.Fatalf("IsTokenRevoked = %v, %v", revoked, err)
+		}
+	}
+	if backend.lookups != 1 {
+		t.Errorf("backend was asked %d times within the TTL, want once", backend.lookups)
+	}
+
+	// Another instance revokes the token; this one notices after the TTL.
+	if err := backend.RevokeToken(ctx, "jti-1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := cache.IsTokenRevoked(ctx, "jti-1"); revoked {
+		t.Error("cached answer was not used within the TTL")
+	}
+	now = now.Add(31 * time.Second)
+	if revoked, _ := cache.IsTokenRevoked(ctx, "jti-1"); !revoked {
+		t.Error("revocation by another instance not seen after the TTL")
+	}
+
+	// Revocations through the cache apply at once.
+	if revoked, _ := cache.IsTokenRevoked(ctx, "jti-2"); revoked {
+		t.Fatal("jti-2 revoked before RevokeToken")
+	}
+	if err := cache.RevokeToken(ctx, "jti-2", now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if revoked, _ := cache.IsTokenRevoked(ctx, "jti-2"); !revoked {
+		t.Error("local revocation did not apply at once")
+	}
+}
+
+func TestSessionRepositoryRevokesTokens(t *testing.T) {
+	ctx := context.Background()
+	revocations := repositories.NewMemoryRevocationRepository()
+	sessions := NewSessionRepository(repositories.NewMemorySessionRepository(), revocations)
+	expires := time.Now().Add(15 * time.Minute)
+
+	create := func(userId uint, token string) *models.UserSession {
+		t.Helper()
+		session := &models.UserSession{UserId: userId, Token: token, RefreshToken: "refresh-" + token, TokenExpired: expires, RefreshTokenExpired: expires}
+		if err := sessions.CreateUserSession(ctx, session); err != nil {
+			t.Fatal(err)
+		}
+		return session
+	}
+	revoked := func(token string) bool {
+		t.Helper()
+		revoked, err := revocations.IsTokenRevoked(ctx, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return revoked
+	}
+
+	create(1, "logout")
+	if err := sessions.DeleteUserSession(ctx, "logout"); err != nil || !revoked("logout") {
+		t.Errorf("DeleteUserSession: err %v, revoked %v", err, revoked("logout"))
+	}
+
+	byId := create(1, "by-id")
+	if err := sessions.DeleteUserSessionById(ctx, byId.Id); err != nil || !revoked("by-id") {
+		t.Errorf("DeleteUserSessionById: err %v, revoked %v", err, revoked("by-id"))
+	}
+
+	create(2, "all-1")
+	create(2, "all-2")
+	create(3, "other")
+	if _, err := sessions.DeleteUserSessions(ctx, 2); err != nil || !revoked("all-1") || !revoked("all-2") || revoked("other") {
+		t.Errorf("DeleteUserSessions: err %v, revoked %v %v %v", err, revoked("all-1"), revoked("all-2"), revoked("other"))
+	}
+
+	create(4, "rotated")
+	if err := sessions.UpdateUserSessionTokens(ctx, "fresh", "refresh-fresh", expires, expires, "refresh-rotated"); err != nil {
+		t.Fatalf("UpdateUserSessionTokens: %v", err)
+	}
+	if !revoked("rotated") || revoked("fresh") {
+		t.Errorf("rotation: old token revoked %v, new token revoked %v", revoked("rotated"), revoked("fresh"))
+	}
+}
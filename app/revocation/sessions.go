@@ -0,0 +1,79 @@
+package revocation
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"time"
+)
+
+// sessionRepository revokes the access token of every session it deletes or
+// rotates, so the token stops working before it expires.
+type sessionRepository struct {
+	repositories.SessionRepository
+	revocations repositories.RevocationRepository
+}
+
+func NewSessionRepository(sessions repositories.SessionRepository, revocations repositories.RevocationRepository) repositories.SessionRepository {
+	return &sessionRepository{SessionRepository: sessions, revocations: revocations}
+}
+
+func (r *sessionRepository) DeleteUserSession(ctx context.Context, token string) error {
+	session, err := r.SessionRepository.GetUserSession(ctx, token)
+	if err == nil {
+		err = r.revoke(ctx, session)
+	}
+	if err != nil && !errors.Is(err, repositories.ErrNotFound) {
+		return err
+	}
+	return r.SessionRepository.DeleteUserSession(ctx, token)
+}
+
+func (r *sessionRepository) DeleteUserSessionById(ctx context.Context, id uint) error {
+	session, err := r.SessionRepository.GetUserSessionById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := r.revoke(ctx, session); err != nil {
+		return err
+	}
+	return r.SessionRepository.DeleteUserSessionById(ctx, id)
+}
+
+func (r *sessionRepository) DeleteUserSessions(ctx context.Context, userId uint) (int64, error) {
+	sessions, err := r.SessionRepository.GetUserSessions(ctx, userId)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.revoke(ctx, sessions...); err != nil {
+		return 0, err
+	}
+	return r.SessionRepository.DeleteUserSessions(ctx, userId)
+}
+
+func (r *sessionRepository) UpdateUserSessionTokens(ctx context.Context, accessToken, refreshToken string,
+	tokenExpired, refreshTokenExpired time.Time, oldRefreshToken string) error {
+	session, err := r.SessionRepository.GetUserSessionByRefreshToken(ctx, oldRefreshToken)
+	if err != nil {
+		return err
+	}
+	err = r.SessionRepository.UpdateUserSessionTokens(ctx, accessToken, refreshToken, tokenExpired, refreshTokenExpired, oldRefreshToken)
+	if err != nil {
+		return err
+	}
+	return r.revoke(ctx, session)
+}
+
+func (r *sessionRepository) revoke(ctx context.Context, sessions ...models.UserSession) error {
+	now := time.Now()
+	for _, session := range sessions {
+		if session.Token == "" || !session.TokenExpired.After(now) {
+			continue
+		}
+		if err := r.revocations.RevokeToken(ctx, session.Token, session.TokenExpired); err != nil {
+			return err
+		}
+	}
+	return nil
+}
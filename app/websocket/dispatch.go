@@ -0,0 +1,156 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/controllers"
+	"go-chat-app/app/filter"
+	"go-chat-app/app/flood"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"time"
+)
+
+// dispatch handles a frame read from cl. A frame its sender may not send is
+// answered with an error frame and dropped; only a failure of the store or of
+// a filter ends the connection.
+func (h *Hub) dispatch(ctx context.Context, cl *client, frame models.ClientFrame) error {
+	switch frame.Type {
+	case "":
+		return h.send(ctx, cl, frame.MessagePayload)
+	case models.FrameTypeJoin:
+		return h.join(ctx, cl, frame.Room)
+	case models.FrameTypeLeave:
+		h.mu.Lock()
+		delete(cl.rooms, frame.Room)
+		h.mu.Unlock()
+		return nil
+	default:
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeBadRequest, frame.Room, "Unknown frame type"))
+		return nil
+	}
+}
+
+// errFlooded ends the connection of a user who kept flooding.
+var errFlooded = errors.New("rate limit exceeded")
+
+// throttle applies the rate limits to a frame read from cl and reports
+// whether to dispatch it. A dropped frame may earn the user a warning, a mute
+// or, once they kept flooding, errFlooded.
+func (h *Hub) throttle(ctx context.Context, cl *client) (bool, error) {
+	verdict := cl.limit.Allow()
+	if verdict == flood.Allow {
+		return true, nil
+	}
+	metrics.FloodFrames.WithLabelValues(verdict.String()).Inc()
+
+	switch verdict {
+	case flood.Warn:
+		slog.WarnContext(ctx, "websocket rate limited", "username", cl.claims.Username)
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeRateLimited, "", "You are sending too fast, frames are being dropped"))
+	case flood.Mute:
+		until, _ := cl.limit.MutedUntil()
+		logger.Audit(ctx, "user muted for flooding", "username", cl.claims.Username, "until", until)
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeMuted, "", "You are muted for sending too fast"))
+	case flood.Disconnect:
+		logger.Audit(ctx, "user disconnected for flooding", "username", cl.claims.Username, "session_id", cl.sessionId)
+		return false, errFlooded
+	}
+	return false, nil
+}
+
+// send publishes msg to its room, which the sender joins by sending to it,
+// once the content filters let it through.
+func (h *Hub) send(ctx context.Context, cl *client, msg models.MessagePayload) error {
+	// The sender is whoever opened the connection, whatever the frame says.
+	msg.From = cl.claims.Username
+	// Ids are assigned by the message store.
+	msg.Id = ""
+	if !controllers.RoleIn(cl.claims, msg.Room).Can(models.PermissionSendMessage) {
+		slog.WarnContext(ctx, "message refused", "username", msg.From, "room", msg.Room)
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeForbidden, msg.Room, "You may not send messages to this room"))
+		return nil
+	}
+
+	if _, muted := cl.limit.MutedUntil(); muted {
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeMuted, msg.Room, "You are muted for sending too fast"))
+		return nil
+	}
+
+	banned, muted, err := h.sanctioned(ctx, cl, msg.Room)
+	if err != nil {
+		return err
+	}
+	switch {
+	case banned:
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeBanned, msg.Room, "You are banned from this room"))
+		return nil
+	case muted:
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeMuted, msg.Room, "You are muted in this room"))
+		return nil
+	}
+
+	msg, err = h.filters.Apply(ctx, msg)
+	var rejected *filter.RejectedError
+	if errors.As(err, &rejected) {
+		cl.queue(ctx, models.NewErrorFrame(rejected.Code, msg.Room, rejected.Reason))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	cl.rooms[msg.Room] = true
+	h.mu.Unlock()
+
+	msg.Date = time.Now()
+	return h.Publish(ctx, msg)
+}
+
+// join makes cl receive the messages of room, unless its user is banned from
+// the room.
+func (h *Hub) join(ctx context.Context, cl *client, room string) error {
+	banned, _, err := h.sanctioned(ctx, cl, room)
+	if err != nil {
+		return err
+	}
+	if banned {
+		cl.queue(ctx, models.NewErrorFrame(models.ErrorCodeBanned, room, "You are banned from this room"))
+		return nil
+	}
+
+	h.mu.Lock()
+	cl.rooms[room] = true
+	h.mu.Unlock()
+	return nil
+}
+
+// sanctioned reports whether the user of cl is banned from or muted in room.
+func (h *Hub) sanctioned(ctx context.Context, cl *client, room string) (banned, muted bool, err error) {
+	sanctions, err := h.sanctions.GetActiveSanctions(ctx, room, cl.userId, time.Now())
+	if err != nil {
+		return false, false, err
+	}
+	for _, sanction := range sanctions {
+		switch sanction.Kind {
+		case models.SanctionBan:
+			banned = true
+		case models.SanctionMute:
+			muted = true
+		}
+	}
+	return banned, muted, nil
+}
+
+// queue queues frame for cl alone.
+func (c *client) queue(ctx context.Context, frame any) {
+	select {
+	case c.send <- envelope{msg: frame, trace: tracing.Inject(ctx)}:
+	default:
+		metrics.SendQueueDrops.Inc()
+	}
+}
@@ -0,0 +1,56 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/app/flood"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/jwt"
+	"testing"
+)
+
+// failingFilter fails every message with err.
+type failingFilter struct{ err error }
+
+func (f failingFilter) Apply(ctx context.Context, msg models.MessagePayload) (models.MessagePayload, error) {
+	return msg, f.err
+}
+
+func TestSendFailsWhenAFilterFails(t *testing.T) {
+	ctx := context.Background()
+	users := repositories.NewMemoryUserRepository()
+	messages := repositories.NewMemoryMessageRepository()
+	guard := flood.NewGuard(config.FloodConfig{})
+	hub := NewHub(messages, repositories.NewMemorySanctionRepository(users), nil, guard)
+	failure := errors.New("filter unavailable")
+	hub.filters = failingFilter{err: failure}
+
+	limit, err := guard.Connect(1)
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	cl := &client{
+		ctx:    ctx,
+		userId: 1,
+		claims: &jwt.ClaimToken{Username: "alice01"},
+		send:   make(chan envelope, sendQueueSize),
+		limit:  limit,
+		rooms:  make(map[string]bool),
+	}
+
+	err = hub.dispatch(ctx, cl, models.ClientFrame{MessagePayload: models.MessagePayload{Room: "ops", Message: "hello"}})
+	if !errors.Is(err, failure) {
+		t.Fatalf("dispatch returned %v, want the filter's error", err)
+	}
+	if all, _ := messages.GetAllMessage(ctx); len(all) != 0 {
+		t.Errorf("the message was stored: %+v", all)
+	}
+	if len(hub.broadcast) != 0 || len(cl.send) != 0 {
+		t.Errorf("frames were queued: %d broadcast, %d to the sender", len(hub.broadcast), len(cl.send))
+	}
+	if cl.rooms["ops"] {
+		t.Error("the sender joined the room")
+	}
+}
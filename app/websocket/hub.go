@@ -0,0 +1,231 @@
+package websocket
+
+import (
+	"context"
+	"go-chat-app/app/filter"
+	"go-chat-app/app/flood"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofiber/contrib/websocket"
+)
+
+const (
+	broadcastQueueSize = 256
+	sendQueueSize      = 64
+	closeWriteTimeout  = time.Second
+)
+
+// envelope carries a frame, usually a models.MessagePayload, through the hub
+// together with the trace context of the transaction that produced it. A
+// broadcast frame goes to the clients that joined room.
+type envelope struct {
+	msg   any
+	room  string
+	trace tracing.Carrier
+}
+
+type client struct {
+	ctx       context.Context
+	conn      *websocket.Conn
+	sessionId uint
+	userId    uint
+	// claims are those of the access token the connection was opened with.
+	claims *jwt.ClaimToken
+	send   chan envelope
+	limit  *flood.Conn
+	// rooms are the rooms the client joined, guarded by the hub's mu.
+	rooms map[string]bool
+}
+
+// writePump delivers queued messages to the connection until the send queue
+// is closed by the hub.
+func (c *client) writePump() {
+	for env := range c.send {
+		if err := c.deliver(env); err != nil {
+			slog.WarnContext(c.ctx, "error writing to client", "error", err)
+			c.conn.Close()
+			for range c.send {
+			}
+			return
+		}
+	}
+}
+
+func (c *client) deliver(env envelope) error {
+	tx, _ := tracing.StartTransaction(tracing.Extract(c.ctx, env.trace), "Deliver Message", "websocket")
+	defer tx.End()
+	tx.SetAttribute("connection_id", logger.ConnectionID(c.ctx))
+
+	err := c.conn.WriteJSON(env.msg)
+	tx.RecordError(err)
+	return err
+}
+
+// Hub fans every received message out to the send queue of each client that
+// joined its room. A client whose queue is full misses the message instead of
+// stalling the others.
+// messageFilter checks and rewrites the messages clients send, as a
+// *filter.Chain does.
+type messageFilter interface {
+	Apply(ctx context.Context, msg models.MessagePayload) (models.MessagePayload, error)
+}
+
+type Hub struct {
+	messages  repositories.MessageRepository
+	sanctions repositories.SanctionRepository
+	filters   messageFilter
+	flood     *flood.Guard
+	mu        sync.RWMutex
+	clients   map[*client]struct{}
+	broadcast chan envelope
+}
+
+func NewHub(messages repositories.MessageRepository, sanctions repositories.SanctionRepository, filters *filter.Chain, guard *flood.Guard) *Hub {
+	return &Hub{
+		messages:  messages,
+		sanctions: sanctions,
+		filters:   filters,
+		flood:     guard,
+		clients:   make(map[*client]struct{}),
+		broadcast: make(chan envelope, broadcastQueueSize),
+	}
+}
+
+// Register adds a client that has joined no room yet. It fails with
+// flood.ErrTooManyConnections when its user has too many connections.
+func (h *Hub) Register(ctx context.Context, conn *websocket.Conn, session models.UserSession, claims *jwt.ClaimToken) (*client, error) {
+	limit, err := h.flood.Connect(session.UserId)
+	if err != nil {
+		return nil, err
+	}
+	cl := &client{
+		ctx:       ctx,
+		conn:      conn,
+		sessionId: session.Id,
+		userId:    session.UserId,
+		claims:    claims,
+		send:      make(chan envelope, sendQueueSize),
+		limit:     limit,
+		rooms:     make(map[string]bool),
+	}
+
+	h.mu.Lock()
+	h.clients[cl] = struct{}{}
+	h.mu.Unlock()
+
+	metrics.WebSocketConnections.Inc()
+	return cl, nil
+}
+
+func (h *Hub) Unregister(cl *client) {
+	h.mu.Lock()
+	if _, ok := h.clients[cl]; ok {
+		delete(h.clients, cl)
+		close(cl.send)
+		cl.limit.Close()
+		metrics.WebSocketConnections.Dec()
+	}
+	h.mu.Unlock()
+}
+
+// CloseSessions disconnects every client that authenticated with one of the
+// given sessions and returns how many were closed. Only connections to this
+// process are affected.
+func (h *Hub) CloseSessions(ids ...uint) int {
+	revoked := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		revoked[id] = true
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	closed := 0
+	for cl := range h.clients {
+		if !revoked[cl.sessionId] {
+			continue
+		}
+		closeConn(cl.conn, websocket.ClosePolicyViolation, "session revoked")
+		slog.InfoContext(cl.ctx, "websocket closed, session revoked", "session_id", cl.sessionId)
+		closed++
+	}
+	return closed
+}
+
+// closeConn sends a close frame and closes conn. Its read loop then fails and
+// unregisters the client.
+func closeConn(conn *websocket.Conn, code int, reason string) {
+	msg := websocket.FormatCloseMessage(code, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteTimeout))
+	conn.Close()
+}
+
+// Publish persists msg and then broadcasts it.
+func (h *Hub) Publish(ctx context.Context, msg models.MessagePayload) error {
+	if err := h.messages.InsertNewMessage(ctx, msg); err != nil {
+		return err
+	}
+	h.Broadcast(ctx, msg)
+	return nil
+}
+
+// Broadcast queues msg for every client in its room. The trace context found
+// in ctx is propagated to the delivery of each copy.
+func (h *Hub) Broadcast(ctx context.Context, msg models.MessagePayload) {
+	h.broadcast <- envelope{msg: msg, room: msg.Room, trace: tracing.Inject(ctx)}
+}
+
+// Moderate tells the room of event about a moderation action. A kicked or
+// banned user is told first and then leaves the room on every connection to
+// this process.
+func (h *Hub) Moderate(ctx context.Context, event models.ModerationEvent) {
+	if event.Action == models.ModerationKick || event.Action == models.ModerationBan {
+		h.mu.Lock()
+		for cl := range h.clients {
+			if cl.claims.Username == event.Username && cl.rooms[event.Room] {
+				delete(cl.rooms, event.Room)
+				cl.queue(ctx, event)
+			}
+		}
+		h.mu.Unlock()
+	}
+	h.broadcast <- envelope{msg: event, room: event.Room, trace: tracing.Inject(ctx)}
+}
+
+// Connections counts the clients connected to this process.
+func (h *Hub) Connections() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients)
+}
+
+func (h *Hub) QueueDepth() int {
+	return len(h.broadcast)
+}
+
+func (h *Hub) Run() {
+	for env := range h.broadcast {
+		metrics.MessagesBroadcast.Inc()
+
+		h.mu.RLock()
+		for cl := range h.clients {
+			if !cl.rooms[env.room] {
+				continue
+			}
+			select {
+			case cl.send <- env:
+			default:
+				metrics.SendQueueDrops.Inc()
+			}
+		}
+		h.mu.RUnlock()
+	}
+}
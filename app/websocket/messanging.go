@@ -2,62 +2,96 @@ package websocket
 
 import (
 	"context"
-	"fmt"
+	"go-chat-app/app/controllers"
 	"go-chat-app/app/models"
-	"go-chat-app/app/repositories"
-	"go-chat-app/pkg/env"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/tracing"
 	"log"
-	"time"
+	"log/slog"
 
 	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
-	"go.elastic.co/apm"
+	"github.com/google/uuid"
 )
 
-func ServeWsMessage(app *fiber.App) {
-	var clients = make(map[*websocket.Conn]bool)
-	var broadcast = make(chan models.MessagePayload)
+// ServeWsMessage serves the chat WebSocket behind auth, which must store the
+// authenticating session under controllers.SessionKey and its claims under
+// controllers.ClaimsKey.
+func ServeWsMessage(app *fiber.App, addr string, hub *Hub, auth fiber.Handler) {
+	metrics.RegisterBroadcastQueue(hub.QueueDepth)
 
-	app.Get("/message/v1/send", websocket.New(func(c *websocket.Conn) {
+	app.Get("/message/v1/send", auth, websocket.New(func(c *websocket.Conn) {
+		session := c.Locals(controllers.SessionKey).(models.UserSession)
+		claims := c.Locals(controllers.ClaimsKey).(*jwt.ClaimToken)
+		connCtx := logger.WithConnectionID(context.Background(), uuid.NewString())
+		slog.InfoContext(connCtx, "websocket connected", "ip", c.IP(), "session_id", session.Id)
+
+		c.SetReadLimit(hub.flood.MaxFrameSize())
+		cl, err := hub.Register(connCtx, c, session, claims)
+		if err != nil {
+			metrics.ConnectionsRefused.Inc()
+			slog.WarnContext(connCtx, "websocket refused, too many connections", "username", claims.Username)
+			closeConn(c, websocket.ClosePolicyViolation, "too many connections")
+			return
+		}
+		done := make(chan struct{})
+		go func() {
+			cl.writePump()
+			close(done)
+		}()
+		// A reason for closing is sent once the queued frames are delivered.
+		var reason string
 		defer func() {
-			c.Close()
-			delete(clients, c)
+			hub.Unregister(cl)
+			<-done
+			if reason != "" {
+				closeConn(c, websocket.ClosePolicyViolation, reason)
+			} else {
+				c.Close()
+			}
+			slog.InfoContext(connCtx, "websocket disconnected")
 		}()
-		clients[c] = true
+
+		// Every client starts out in the default room.
+		if err := hub.join(connCtx, cl, ""); err != nil {
+			slog.ErrorContext(connCtx, "error joining the default room", "error", err)
+			return
+		}
 
 		for {
-			var msg models.MessagePayload
-			err := c.ReadJSON(&msg)
+			var frame models.ClientFrame
+			err = c.ReadJSON(&frame)
 			if err != nil {
-				log.Printf("Error reading from client: %v", err)
+				slog.InfoContext(connCtx, "error reading from client", "error", err)
 				break
 			}
+			metrics.MessagesReceived.Inc()
+			pass, err := hub.throttle(connCtx, cl)
+			if err != nil {
+				reason = err.Error()
+				break
+			}
+			if !pass {
+				continue
+			}
 
-			tx := apm.DefaultTracer.StartTransaction("Send Message", "websocket")
-			ctx := apm.ContextWithTransaction(context.Background(), tx)
+			tx, ctx := tracing.StartTransaction(connCtx, "Send Message", "websocket")
+			tx.SetAttribute("connection_id", logger.ConnectionID(connCtx))
 
-			msg.Date = time.Now()
-			err = repositories.InsertNewMessage(ctx, msg)
+			err = hub.dispatch(ctx, cl, frame)
 			if err != nil {
-				log.Printf("Error inserting message: %v", err)
+				slog.ErrorContext(ctx, "error handling frame", "error", err)
+				tx.RecordError(err)
+				tx.End()
 				break
 			}
 			tx.End()
-			broadcast <- msg
 		}
 	}))
 
-	go func() {
-		msg := <-broadcast
-		for client := range clients {
-			err := client.WriteJSON(msg)
-			if err != nil {
-				log.Printf("Error writing to client: %v", err)
-				client.Close()
-				delete(clients, client)
-			}
-		}
-	}()
+	go hub.Run()
 
-	log.Fatal(app.Listen(fmt.Sprintf("%s:%s", env.GetEnv("APP_HOST", "localhost"), env.GetEnv("APP_PORT_SOCKET", "8080"))))
+	log.Fatal(app.Listen(addr))
 }
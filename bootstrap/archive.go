@@ -0,0 +1,31 @@
+package bootstrap
+
+import (
+	"context"
+	"go-chat-app/app/archive"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/storage"
+)
+
+// NewArchive opens the configured archive backend.
+func NewArchive(cfg config.ArchiveConfig) *archive.Archive {
+	var blob storage.Blob
+	switch cfg.Backend {
+	case config.ArchiveBackendFile:
+		blob = storage.NewFileBlob(cfg.Dir)
+	default:
+		return nil
+	}
+	return archive.New(blob)
+}
+
+// SetupArchive starts the archiver when an archive backend is configured and
+// this instance runs the job.
+func SetupArchive(cfg *config.Config, messages repositories.MessageRepository) {
+	if !cfg.Archive.Enabled() || !cfg.Archive.Job {
+		return
+	}
+	archiver := archive.NewArchiver(messages, NewArchive(cfg.Archive), cfg.Archive.After)
+	go archiver.Run(context.Background(), cfg.Archive.Interval)
+}
@@ -1,47 +1,165 @@
 package bootstrap
 
 import (
+	"context"
+	"go-chat-app/app/archive"
+	"go-chat-app/app/controllers"
+	"go-chat-app/app/filter"
+	"go-chat-app/app/flood"
+	"go-chat-app/app/lockout"
+	"go-chat-app/app/moderation"
+	"go-chat-app/app/repositories"
+	"go-chat-app/app/revocation"
 	"go-chat-app/app/websocket"
+	"go-chat-app/pkg/config"
 	"go-chat-app/pkg/database"
-	"go-chat-app/pkg/env"
+	"go-chat-app/pkg/health"
+	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/mailer"
+	"go-chat-app/pkg/metrics"
+	"go-chat-app/pkg/oidc"
 	"go-chat-app/pkg/router"
+	"go-chat-app/pkg/tracing"
 	"io"
 	"log"
 	"os"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/monitor"
 	"github.com/gofiber/fiber/v2/middleware/recover"
 	"github.com/gofiber/template/html/v2"
-	"go.elastic.co/apm"
 )
 
-func NewApplication() *fiber.App {
-	env.SetupEnvFile()
-	SetupLogFile()
+func NewApplication(cfg *config.Config) *fiber.App {
+	repos := Open(cfg, os.Stdout)
+	SetupHealthChecks(cfg)
 
-	database.SetupDatabase()
-	database.SetupMongoDb()
+	if cfg.Database.MigrateOnStart {
+		if err := RunMigrations(context.Background(), cfg); err != nil {
+			log.Fatal("Failed to migrate the Database! \n", err.Error())
+		}
+	}
+	SetupRetention(cfg, repos.Messages)
+	SetupArchive(cfg, repos.Messages)
 
-	apm.DefaultTracer.Service.Name = "go-chat-app"
+	if err := jwt.Setup(cfg.App, cfg.JWT); err != nil {
+		log.Fatal("Failed to load the JWT keys! \n", err.Error())
+	}
+	if err := tracing.Setup(cfg.Tracing.Backend, cfg.App.Name); err != nil {
+		log.Fatal("Failed to set up tracing! \n", err.Error())
+	}
 	engine := html.New("./views", ".html")
 	app := fiber.New(fiber.Config{Views: engine})
 	app.Use(recover.New())
-	app.Use(logger.New())
+	app.Use(logger.RequestIDMiddleware())
+	app.Use(logger.AccessLogMiddleware())
+	app.Use(metrics.Middleware())
 	app.Get("/dashboard", monitor.New())
+	app.Get("/metrics", metrics.Handler())
 
-	go websocket.ServeWsMessage(app)
+	filters, err := filter.New(cfg.Filter)
+	if err != nil {
+		log.Fatal("Failed to set up the content filters! \n", err.Error())
+	}
+	hub := websocket.NewHub(repos.Messages, repos.Sanctions, filters, flood.NewGuard(cfg.Flood))
+	go moderation.NewSweeper(repos.Sanctions, repos.Users, hub, cfg.Moderation.SweepInterval).Run(context.Background())
+	go websocket.ServeWsMessage(app, cfg.App.SocketAddress(), hub, router.NewMiddleware(repos.Sessions, repos.Revocations, hub).WebSocketAuth)
 
-	router.InstallRouter(app)
+	var provider *oidc.Provider
+	if cfg.OIDC.Enabled() {
+		provider = oidc.New(cfg.OIDC, cfg.App.Secret)
+	}
+	router.InstallRouter(app, router.Dependencies{
+		Repos:          repos,
+		Sockets:        hub,
+		OIDC:           provider,
+		OIDCAutoCreate: cfg.OIDC.AutoCreate,
+		Mail: controllers.AccountMail{
+			Sender:          NewMailer(cfg.Mail),
+			BaseURL:         cfg.Mail.BaseURL,
+			VerificationTTL: cfg.Mail.VerificationTTL,
+			ResetTTL:        cfg.Mail.ResetTTL,
+		},
+		Lockout: lockout.NewGuard(repos.LoginAttempts, cfg.Login),
+	})
 	return app
 }
 
-func SetupLogFile() {
-	logFile, err := os.OpenFile("./logs/chat_message.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatal(err)
+// Open sets up logging, connects to the configured stores and returns the
+// repositories wired to them. Log records are copied to console.
+func Open(cfg *config.Config, console io.Writer) repositories.Repositories {
+	SetupLogFile(cfg.Log, console)
+
+	database.SetupDatabase(cfg.Database)
+	if cfg.Messages.Store == config.MessageStoreMongo {
+		database.SetupMongoDb(cfg.Mongo)
+	}
+	return NewRepositories(cfg)
+}
+
+// NewRepositories wires the repositories to the connections opened by
+// database.SetupDatabase and database.SetupMongoDb.
+func NewRepositories(cfg *config.Config) repositories.Repositories {
+	repos := repositories.Repositories{
+		Users:         repositories.NewUserRepository(database.DB),
+		AccountTokens: repositories.NewAccountTokenRepository(database.DB),
+		RoomRoles:     repositories.NewRoomRoleRepository(database.DB),
+		Sanctions:     repositories.NewSanctionRepository(database.DB),
+		Sessions:      repositories.NewSessionRepository(database.DB),
+	}
+	if cfg.Messages.Store == config.MessageStoreSQL {
+		repos.Messages = repositories.NewGormMessageRepository(database.DB)
+	} else {
+		repos.Messages = repositories.NewMongoMessageRepository(database.MongoDB)
+	}
+	if cfg.Archive.Enabled() {
+		repos.Messages = archive.NewMessageRepository(repos.Messages, NewArchive(cfg.Archive), cfg.Archive.Job)
 	}
-	mw := io.MultiWriter(os.Stdout, logFile)
-	log.SetOutput(mw)
+
+	revocations := repositories.NewMemoryRevocationRepository()
+	if cfg.Revocation.Backend == config.RevocationBackendSQL {
+		revocations = repositories.NewRevocationRepository(database.DB)
+	}
+	repos.Revocations = revocation.NewCache(revocations, cfg.Revocation.CacheTTL)
+
+	repos.LoginAttempts = repositories.NewMemoryLoginAttemptRepository()
+	if cfg.Login.Backend == config.LoginBackendSQL {
+		repos.LoginAttempts = repositories.NewLoginAttemptRepository(database.DB)
+	}
+	repos.Sessions = revocation.NewSessionRepository(repos.Sessions, repos.Revocations)
+	return repos
+}
+
+// NewMailer returns the mail Sender of the configured backend.
+func NewMailer(cfg config.MailConfig) mailer.Sender {
+	switch cfg.Backend {
+	case config.MailBackendSMTP:
+		return mailer.NewSMTPSender(cfg)
+	case config.MailBackendFile:
+		return mailer.NewFileSender(cfg.File, cfg.From)
+	default:
+		return mailer.NewLogSender()
+	}
+}
+
+// SetupHealthChecks registers the dependencies reported by /readyz. A message
+// broker, once configured, should register its own check here as well.
+func SetupHealthChecks(cfg *config.Config) {
+	health.Register(cfg.Database.Driver, database.PingDatabase)
+	if cfg.Messages.Store == config.MessageStoreMongo {
+		health.Register("mongodb", database.PingMongoDb)
+	}
+}
+
+func SetupLogFile(cfg config.LogConfig, console io.Writer) {
+	logger.Setup(logger.Options{
+		Console:    console,
+		Level:      cfg.Level,
+		File:       cfg.File,
+		MaxSizeMB:  cfg.MaxSizeMB,
+		MaxBackups: cfg.MaxBackups,
+		MaxAgeDays: cfg.MaxAgeDays,
+		Compress:   cfg.Compress,
+	})
 }
@@ -0,0 +1,32 @@
+package bootstrap
+
+import (
+	"context"
+	"fmt"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/database"
+	"go-chat-app/pkg/migration"
+)
+
+// NewMigrators returns one migrator per configured store. The connections
+// must already be open.
+func NewMigrators(cfg *config.Config) []*migration.Migrator {
+	migrators := []*migration.Migrator{
+		migration.New(cfg.Database.Driver, migration.NewSQLStore(database.DB), migration.SQLMigrations(database.DB)),
+	}
+	if cfg.Messages.Store == config.MessageStoreMongo {
+		migrators = append(migrators, migration.New("mongodb",
+			migration.NewMongoStore(database.MongoDB.Database()), migration.MongoMigrations(database.MongoDB)))
+	}
+	return migrators
+}
+
+// RunMigrations applies every pending migration of every store.
+func RunMigrations(ctx context.Context, cfg *config.Config) error {
+	for _, m := range NewMigrators(cfg) {
+		if _, err := m.Up(ctx); err != nil {
+			return fmt.Errorf("%s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package bootstrap
+
+import (
+	"context"
+	"go-chat-app/app/repositories"
+	"go-chat-app/app/retention"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/database"
+	"go-chat-app/pkg/logger"
+	"go-chat-app/pkg/migration"
+	"log"
+	"time"
+)
+
+// SetupRetention configures the MongoDB TTL index and starts the purge job
+// when a retention policy is set. The TTL index is also reset when
+// RETENTION_MONGO_TTL is turned off.
+func SetupRetention(cfg *config.Config, messages repositories.MessageRepository) {
+	if cfg.Messages.Store == config.MessageStoreMongo {
+		var ttl time.Duration
+		if cfg.Retention.MongoTTL {
+			ttl = cfg.Retention.Default
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		changed, err := migration.SetMongoTTL(ctx, database.MongoDB, ttl)
+		cancel()
+		if err != nil {
+			log.Fatal("Failed to configure the MongoDB TTL index! \n", err.Error())
+		}
+		if changed {
+			logger.Audit(context.Background(), "retention ttl changed", "index", migration.DateIndex, "ttl", ttl.String())
+		}
+	}
+
+	if cfg.Retention.Enabled() {
+		go retention.NewJob(messages, cfg.Retention).Run(context.Background())
+	}
+}
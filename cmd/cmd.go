@@ -0,0 +1,167 @@
+// Package cmd implements the command line of the chat server. Every
+// subcommand loads the same configuration and reuses the bootstrap wiring of
+// the server, so operators no longer need SQL or Mongo shell sessions for
+// routine tasks.
+package cmd
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"go-chat-app/app/repositories"
+	"go-chat-app/bootstrap"
+	"go-chat-app/pkg/config"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+const program = "go-chat-app"
+
+type command struct {
+	name    string
+	summary string
+	run     func(c *CLI, args []string) error
+}
+
+// commands is filled in init because usage refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"serve", "start the HTTP and WebSocket servers (default)", serve},
+		{"migrate up", "apply every pending migration", migrateUp},
+		{"migrate down", "revert the latest migrations", migrateDown},
+		{"migrate status", "list applied and pending migrations", migrateStatus},
+		{"user create", "create an account", userCreate},
+		{"user disable", "disable an account and revoke its sessions (see note)", userDisable},
+		{"user enable", "re-enable a disabled account", userEnable},
+		{"user reset-password", "set a new password and revoke all sessions (see note)", userResetPassword},
+		{"user reset-2fa", "turn off two-factor authentication of an account", userReset2FA},
+		{"user set-role", "make an account an admin or a member", userSetRole},
+		{"session revoke", "revoke one session or every session of a user (see note)", sessionRevoke},
+		{"messages export", "write chat history as JSON lines", messagesExport},
+		{"messages import", "read chat history from JSON lines", messagesImport},
+		{"messages purge", "delete messages older than a cutoff", messagesPurge},
+		{"messages archive", "move messages past ARCHIVE_AFTER to the archive", messagesArchive},
+		{"config check", "validate the configuration and print a summary", configCheck},
+		{"jwt generate-key", "create a key pair for signing tokens", jwtGenerateKey},
+	}
+}
+
+// CLI holds what the subcommands share.
+type CLI struct {
+	Config *config.Config
+	In     io.Reader
+	Out    io.Writer
+	// Err receives diagnostics and the application log, keeping Out clean
+	// for data such as exports.
+	Err   io.Writer
+	repos *repositories.Repositories
+}
+
+// Open connects to the configured stores on first use, so commands such as
+// `config check` never touch a database.
+func (c *CLI) Open() repositories.Repositories {
+	if c.repos == nil {
+		repos := bootstrap.Open(c.Config, c.Err)
+		c.repos = &repos
+	}
+	return *c.repos
+}
+
+// Run parses the global flags and dispatches to a subcommand. Without a
+// subcommand the server is started, as it was before the CLI existed.
+func Run(args []string, in io.Reader, out, errOut io.Writer) error {
+	flags := flag.NewFlagSet(program, flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	configFile := flags.String("config", "", "YAML or TOML config `file` (default $CONFIG_FILE)")
+	envFile := flags.String("env-file", config.DefaultEnvFile, "`file` loaded into the environment")
+	flags.Usage = func() { usage(flags) }
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cmd, args, err := lookup(flags.Args())
+	if err != nil {
+		flags.Usage()
+		return err
+	}
+
+	cfg, err := config.Load(config.Options{EnvFile: *envFile, File: *configFile})
+	if err != nil {
+		return err
+	}
+	return cmd.run(&CLI{Config: cfg, In: in, Out: out, Err: errOut}, args)
+}
+
+// lookup matches the longest command name at the start of args.
+func lookup(args []string) (command, []string, error) {
+	if len(args) == 0 {
+		return commands[0], nil, nil
+	}
+	if len(args) > 1 {
+		for _, cmd := range commands {
+			if cmd.name == args[0]+" "+args[1] {
+				return cmd, args[2:], nil
+			}
+		}
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd, args[1:], nil
+		}
+	}
+	return command{}, nil, fmt.Errorf("unknown command %q", strings.Join(args[:min(len(args), 2)], " "))
+}
+
+func usage(flags *flag.FlagSet) {
+	w := flags.Output()
+	fmt.Fprintf(w, "Usage: %s [flags] <command> [command flags]\n\nFlags:\n", program)
+	flags.PrintDefaults()
+	fmt.Fprintln(w, "\nCommands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nNote: %s\n", revocationNote)
+	fmt.Fprintf(w, "\nRun \"%s <command> -h\" for the flags of a command.\n", program)
+}
+
+func (c *CLI) flagSet(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(program+" "+name, flag.ContinueOnError)
+	flags.SetOutput(c.Err)
+	return flags
+}
+
+// readLine reads a single line from In, for secrets that should not appear
+// in the shell history.
+func (c *CLI) readLine() (string, error) {
+	scanner := bufio.NewScanner(c.In)
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.ErrUnexpectedEOF
+	}
+	return strings.TrimRight(scanner.Text(), "\r"), nil
+}
+
+func required(flag, value string) error {
+	if value == "" {
+		return fmt.Errorf("-%s is required", flag)
+	}
+	return nil
+}
+
+// parse parses the command flags and rejects leftover arguments.
+func parse(flags *flag.FlagSet, args []string) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/app/revocation"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newTestCLI returns a CLI wired to in-memory repositories, so no command
+// under test opens a database.
+func newTestCLI(stdin string) (*CLI, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	revocations := repositories.NewMemoryRevocationRepository()
+	return &CLI{
+		In:  strings.NewReader(stdin),
+		Out: out,
+		Err: &bytes.Buffer{},
+		repos: &repositories.Repositories{
+			Users:       repositories.NewMemoryUserRepository(),
+			Sessions:    revocation.NewSessionRepository(repositories.NewMemorySessionRepository(), revocations),
+			Messages:    repositories.NewMemoryMessageRepository(),
+			Revocations: revocations,
+		},
+	}, out
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		args []string
+		name string
+		rest int
+	}{
+		{nil, "serve", 0},
+		{[]string{"migrate", "down", "-steps", "2"}, "migrate down", 2},
+		{[]string{"user", "reset-password", "-username", "x"}, "user reset-password", 2},
+		{[]string{"serve"}, "serve", 0},
+	}
+	for _, tt := range tests {
+		cmd, rest, err := lookup(tt.args)
+		if err != nil {
+			t.Errorf("lookup(%q): %v", tt.args, err)
+			continue
+		}
+		if cmd.name != tt.name || len(rest) != tt.rest {
+			t.Errorf("lookup(%q) = %q with %d args, want %q with %d", tt.args, cmd.name, len(rest), tt.name, tt.rest)
+		}
+	}
+
+	if _, _, err := lookup([]string{"user", "delete"}); err == nil {
+		t.Error("lookup accepted an unknown command")
+	}
+}
+
+func TestUserLifecycle(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCLI("secret1\n")
+	repos := c.Open()
+
+	if err := userCreate(c, []string{"-username", "alice01", "-full-name", "Alice Liddell"}); err != nil {
+		t.Fatalf("user create: %v", err)
+	}
+	user, err := repos.Users.GetUserByUsername(ctx, "alice01")
+	if err != nil {
+		t.Fatalf("GetUserByUsername: %v", err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("secret1")) != nil {
+		t.Error("password from stdin was not stored hashed")
+	}
+	if err := repos.Sessions.CreateUserSession(ctx, &models.UserSession{UserId: user.Id, Token: "t", RefreshToken: "r"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := userDisable(c, []string{"-username", "alice01"}); err != nil {
+		t.Fatalf("user disable: %v", err)
+	}
+	if user, _ := repos.Users.GetUserByUsername(ctx, "alice01"); !user.Disabled() {
+		t.Error("user was not disabled")
+	}
+	if _, err := repos.Sessions.GetUserSession(ctx, "t"); err == nil {
+		t.Error("disabling did not revoke the session")
+	}
+	if !strings.Contains(c.Err.(*bytes.Buffer).String(), "REVOCATION_BACKEND is not sql") {
+		t.Error("disabling without the sql revocation backend did not warn")
+	}
+
+	if err := userEnable(c, []string{"-username", "alice01"}); err != nil {
+		t.Fatalf("user enable: %v", err)
+	}
+	if err := userResetPassword(c, []string{"-username", "alice01", "-password", "short"}); err == nil {
+		t.Error("reset-password accepted a short password")
+	}
+	if err := userResetPassword(c, []string{"-username", "alice01", "-password", "secret2"}); err != nil {
+		t.Fatalf("user reset-password: %v", err)
+	}
+	user, _ = repos.Users.GetUserByUsername(ctx, "alice01")
+	if user.Disabled() || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("secret2")) != nil {
+		t.Errorf("user not enabled with the new password: %+v", user)
+	}
+
+	if err := repos.Users.UpdateTwoFactor(ctx, "alice01", "SECRET", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := userReset2FA(c, []string{"-username", "alice01"}); err != nil {
+		t.Fatalf("user reset-2fa: %v", err)
+	}
+	if user, _ := repos.Users.GetUserByUsername(ctx, "alice01"); user.TwoFactorEnabled() || user.TwoFactorSecret != "" {
+		t.Error("two-factor authentication is still set up")
+	}
+
+	if err := userSetRole(c, []string{"-username", "alice01", "-role", "owner"}); err == nil {
+		t.Error("set-role accepted a room role")
+	}
+	if err := userSetRole(c, []string{"-username", "alice01", "-role", "admin"}); err != nil {
+		t.Fatalf("user set-role: %v", err)
+	}
+	if user, _ := repos.Users.GetUserByUsername(ctx, "alice01"); user.Role != models.RoleAdmin {
+		t.Errorf("role = %q, want admin", user.Role)
+	}
+
+	if err := userDisable(c, []string{"-username", "nobody"}); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("disabling an unknown user returned %v", err)
+	}
+}
+
+func TestSessionRevoke(t *testing.T) {
+	ctx := context.Background()
+	c, _ := newTestCLI("")
+	sessions := c.Open().Sessions
+
+	session := &models.UserSession{UserId: 1, Token: "t", RefreshToken: "r", TokenExpired: time.Now().Add(time.Minute)}
+	if err := sessions.CreateUserSession(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+	if err := sessionRevoke(c, nil); err == nil {
+		t.Error("revoke without -id or -user succeeded")
+	}
+	if err := sessionRevoke(c, []string{"-id", "1"}); err != nil {
+		t.Fatalf("session revoke: %v", err)
+	}
+	if revoked, _ := c.Open().Revocations.IsTokenRevoked(ctx, "t"); !revoked {
+		t.Error("the access token of the revoked session is still valid")
+	}
+	if err := sessionRevoke(c, []string{"-id", "1"}); err == nil {
+		t.Error("revoking a missing session succeeded")
+	}
+}
+
+func TestMessagesImportExportPurge(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour).UTC().Format(time.RFC3339)
+	input := `{"room":"ops","from":"alice01","message":"old","date":"` + old + `"}
+{"from":"bob0001","message":"new"}
+`
+	c, out := newTestCLI(input)
+
+	if err := messagesImport(c, nil); err != nil {
+		t.Fatalf("messages import: %v", err)
+	}
+	if !strings.Contains(out.String(), "imported 2 messages") {
+		t.Errorf("import output = %q", out.String())
+	}
+
+	out.Reset()
+	if err := messagesExport(c, []string{"-room", "ops"}); err != nil {
+		t.Fatalf("messages export: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"old"`) {
+		t.Errorf("export of room ops = %q", out.String())
+	}
+
+	if err := messagesPurge(c, nil); err == nil {
+		t.Error("purge without a cutoff succeeded")
+	}
+	out.Reset()
+	if err := messagesPurge(c, []string{"-older-than", "24h", "-batch", "1"}); err != nil {
+		t.Fatalf("messages purge: %v", err)
+	}
+	if !strings.Contains(out.String(), "purged 1 messages") {
+		t.Errorf("purge output = %q", out.String())
+	}
+
+	remaining, _ := c.Open().Messages.GetAllMessage(context.Background())
+	if len(remaining) != 1 || remaining[0].Message != "new" {
+		t.Errorf("remaining messages = %+v", remaining)
+	}
+}
+
+func TestJWTGenerateKey(t *testing.T) {
+	c, out := newTestCLI("")
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+
+	if err := jwtGenerateKey(c, []string{"-alg", "EdDSA", "-out", path}); err != nil {
+		t.Fatalf("jwt generate-key: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0o600 {
+		t.Errorf("private key mode = %v, want 0600", info.Mode().Perm())
+	}
+	if !strings.HasPrefix(out.String(), "-----BEGIN PUBLIC KEY-----") {
+		t.Errorf("output = %q, want the public key", out.String())
+	}
+
+	if err := jwtGenerateKey(c, []string{"-out", path}); err == nil {
+		t.Error("jwt generate-key overwrote an existing key")
+	}
+}
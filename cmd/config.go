@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-chat-app/bootstrap"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/health"
+	"go-chat-app/pkg/jwt"
+	"maps"
+	"slices"
+	"text/tabwriter"
+	"time"
+)
+
+const connectTimeout = 5 * time.Second
+
+// configCheck only runs once config.Load has succeeded, so reaching it means
+// the configuration is valid. Secrets are never printed.
+func configCheck(c *CLI, args []string) error {
+	flags := c.flagSet("config check")
+	connect := flags.Bool("connect", false, "also connect to the configured stores")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	cfg := c.Config
+	if err := jwt.Setup(cfg.App, cfg.JWT); err != nil {
+		return err
+	}
+	alg, kid := jwt.Algorithm()
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "http\t%s\n", cfg.App.Address())
+	fmt.Fprintf(w, "websocket\t%s\n", cfg.App.SocketAddress())
+	fmt.Fprintf(w, "database\t%s %s\n", cfg.Database.Driver, cfg.Database.Name)
+	fmt.Fprintf(w, "message store\t%s\n", cfg.Messages.Store)
+	if cfg.Messages.Store == config.MessageStoreMongo {
+		fmt.Fprintf(w, "mongodb\t%s.%s\n", cfg.Mongo.Database, cfg.Mongo.Collection)
+	}
+	if kid != "" {
+		fmt.Fprintf(w, "jwt\t%s kid %s, %d verification keys\n", alg, kid, len(cfg.JWT.VerificationKeys))
+	} else {
+		fmt.Fprintf(w, "jwt\t%s\n", alg)
+	}
+	if cfg.OIDC.Enabled() {
+		fmt.Fprintf(w, "oidc\t%s\n", cfg.OIDC.Issuer)
+	}
+	fmt.Fprintf(w, "tracing\t%s\n", cfg.Tracing.Backend)
+	fmt.Fprintf(w, "log\t%s %s\n", cfg.Log.Level, cfg.Log.File)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if *connect {
+		c.Open()
+		bootstrap.SetupHealthChecks(cfg)
+		report := health.Check(context.Background(), connectTimeout)
+		for _, name := range slices.Sorted(maps.Keys(report.Checks)) {
+			result := report.Checks[name]
+			fmt.Fprintf(c.Out, "%s: %s %s\n", name, result.Status, result.Error)
+		}
+		if report.Status != health.StatusUp {
+			return errors.New("configuration is valid but a store is unreachable")
+		}
+	}
+
+	fmt.Fprintln(c.Out, "configuration OK")
+	return nil
+}
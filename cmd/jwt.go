@@ -0,0 +1,43 @@
+package cmd
+
+import (
+	"fmt"
+	"go-chat-app/pkg/jwt"
+	"os"
+)
+
+// jwtGenerateKey writes the private key to -out, readable by the owner only,
+// and prints the public key, which is what JWT_VERIFICATION_KEYS takes once
+// the key has been rotated out.
+func jwtGenerateKey(c *CLI, args []string) error {
+	flags := c.flagSet("jwt generate-key")
+	alg := flags.String("alg", "EdDSA", "signing algorithm, RS256 or EdDSA")
+	out := flags.String("out", "", "`file` the private key is written to")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if err := required("out", *out); err != nil {
+		return err
+	}
+
+	private, public, kid, err := jwt.GenerateKey(*alg)
+	if err != nil {
+		return err
+	}
+	// O_EXCL keeps an existing signing key from being overwritten.
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(private); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.Err, "wrote %s key %s to %s\n", *alg, kid, *out)
+	_, err = c.Out.Write(public)
+	return err
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chat-app/app/archive"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/app/retention"
+	"go-chat-app/bootstrap"
+	"go-chat-app/pkg/logger"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultPurgeBatch = 1000
+
+// rooms collects a repeatable -room flag. `-room ""` selects the default
+// room.
+type rooms []string
+
+func (r *rooms) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *rooms) Set(room string) error {
+	*r = append(*r, room)
+	return nil
+}
+
+func messagesExport(c *CLI, args []string) error {
+	flags := c.flagSet("messages export")
+	var only rooms
+	flags.Var(&only, "room", "only export this room; repeatable")
+	file := flags.String("out", "", "write to this `file` instead of stdout")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	msgs, err := c.Open().Messages.GetAllMessage(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := c.Out
+	if *file != "" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	enc := json.NewEncoder(w)
+	exported := 0
+	for _, msg := range msgs {
+		if len(only) > 0 && !slices.Contains(only, msg.Room) {
+			continue
+		}
+		if err := enc.Encode(msg); err != nil {
+			return err
+		}
+		exported++
+	}
+	fmt.Fprintf(c.Err, "exported %d messages\n", exported)
+	return nil
+}
+
+func messagesImport(c *CLI, args []string) error {
+	flags := c.flagSet("messages import")
+	file := flags.String("in", "", "read from this `file` instead of stdin")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+
+	r := c.In
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	ctx := context.Background()
+	messages := c.Open().Messages
+	dec := json.NewDecoder(r)
+	imported := 0
+	for {
+		var msg models.MessagePayload
+		err := dec.Decode(&msg)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("message %d: %w", imported+1, err)
+		}
+		if msg.Date.IsZero() {
+			msg.Date = time.Now()
+		}
+		if err := messages.InsertNewMessage(ctx, msg); err != nil {
+			return fmt.Errorf("message %d: %w", imported+1, err)
+		}
+		imported++
+	}
+	fmt.Fprintf(c.Out, "imported %d messages\n", imported)
+	return nil
+}
+
+func messagesPurge(c *CLI, args []string) error {
+	flags := c.flagSet("messages purge")
+	var only rooms
+	flags.Var(&only, "room", "only purge this room; repeatable")
+	before := flags.String("before", "", "delete messages sent before this RFC 3339 `time`")
+	olderThan := flags.Duration("older-than", 0, "delete messages older than this `duration`, e.g. 2160h")
+	policy := flags.Bool("policy", false, "apply the configured retention policies once")
+	batch := flags.Int("batch", defaultPurgeBatch, "messages deleted per round trip")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if *policy {
+		if *before != "" || *olderThan != 0 || len(only) > 0 {
+			return errors.New("-policy cannot be combined with -before, -older-than or -room")
+		}
+		return purgePolicy(c)
+	}
+	if (*before == "") == (*olderThan == 0) {
+		return errors.New("exactly one of -before, -older-than and -policy is required")
+	}
+	if *batch <= 0 {
+		return errors.New("-batch must be positive")
+	}
+
+	filter := repositories.MessageFilter{Rooms: only, Before: time.Now().Add(-*olderThan)}
+	if *before != "" {
+		cutoff, err := time.Parse(time.RFC3339Nano, *before)
+		if err != nil {
+			return fmt.Errorf("invalid -before: %w", err)
+		}
+		filter.Before = cutoff
+	}
+
+	ctx := context.Background()
+	messages := c.Open().Messages
+	var purged int64
+	var err error
+	for {
+		var deleted int64
+		deleted, err = messages.DeleteMessages(ctx, filter, *batch)
+		purged += deleted
+		if err != nil || deleted < int64(*batch) {
+			break
+		}
+	}
+	audit := []any{"policy", "manual", "rooms", []string(only), "cutoff", filter.Before, "deleted", purged}
+	if err != nil {
+		logger.Audit(ctx, "messages purged", append(audit, "error", err)...)
+		return fmt.Errorf("purged %d messages before failing: %w", purged, err)
+	}
+	logger.Audit(ctx, "messages purged", audit...)
+	fmt.Fprintf(c.Out, "purged %d messages sent before %s\n", purged, filter.Before.UTC().Format(time.RFC3339))
+	return nil
+}
+
+func purgePolicy(c *CLI) error {
+	if !c.Config.Retention.Enabled() {
+		return errors.New("no retention policy is configured, set RETENTION_DEFAULT or RETENTION_ROOMS")
+	}
+	purged, err := retention.NewJob(c.Open().Messages, c.Config.Retention).RunOnce(context.Background())
+	if err != nil {
+		return fmt.Errorf("purged %d messages before failing: %w", purged, err)
+	}
+	fmt.Fprintf(c.Out, "purged %d messages\n", purged)
+	return nil
+}
+
+func messagesArchive(c *CLI, args []string) error {
+	if err := parse(c.flagSet("messages archive"), args); err != nil {
+		return err
+	}
+	if !c.Config.Archive.Enabled() {
+		return errors.New("no archive is configured, set ARCHIVE_BACKEND")
+	}
+
+	archiver := archive.NewArchiver(c.Open().Messages, bootstrap.NewArchive(c.Config.Archive), c.Config.Archive.After)
+	moved, err := archiver.RunOnce(context.Background())
+	if err != nil {
+		return fmt.Errorf("archived %d messages before failing: %w", moved, err)
+	}
+	fmt.Fprintf(c.Out, "archived %d messages\n", moved)
+	return nil
+}
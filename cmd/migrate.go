@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"go-chat-app/bootstrap"
+	"text/tabwriter"
+	"time"
+)
+
+func migrateUp(c *CLI, args []string) error {
+	if err := parse(c.flagSet("migrate up"), args); err != nil {
+		return err
+	}
+	c.Open()
+
+	ctx := context.Background()
+
+	for _, m := range bootstrap.NewMigrators(c.Config) {
+		applied, err := m.Up(ctx)
+		for _, migration := range applied {
+			fmt.Fprintf(c.Out, "%s: applied %d %s\n", m.Name(), migration.Version, migration.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+func migrateDown(c *CLI, args []string) error {
+	flags := c.flagSet("migrate down")
+	steps := flags.Int("steps", 1, "number of migrations to revert per store")
+	store := flags.String("store", "", "only revert this store, e.g. mysql or mongodb")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	c.Open()
+
+	ctx := context.Background()
+
+	for _, m := range bootstrap.NewMigrators(c.Config) {
+		if *store != "" && *store != m.Name() {
+			continue
+		}
+		reverted, err := m.Down(ctx, *steps)
+		for _, migration := range reverted {
+			fmt.Fprintf(c.Out, "%s: reverted %d %s\n", m.Name(), migration.Version, migration.Name)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+func migrateStatus(c *CLI, args []string) error {
+	if err := parse(c.flagSet("migrate status"), args); err != nil {
+		return err
+	}
+	c.Open()
+
+	ctx := context.Background()
+
+	w := tabwriter.NewWriter(c.Out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STORE\tVERSION\tNAME\tAPPLIED AT")
+	for _, m := range bootstrap.NewMigrators(c.Config) {
+		status, err := m.Status(ctx)
+		if err != nil {
+			return fmt.Errorf("%s: %w", m.Name(), err)
+		}
+		for _, s := range status {
+			appliedAt := "pending"
+			if s.AppliedAt != nil {
+				appliedAt = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", m.Name(), s.Version, s.Name, appliedAt)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,11 @@
+package cmd
+
+import "go-chat-app/bootstrap"
+
+func serve(c *CLI, args []string) error {
+	if err := parse(c.flagSet("serve"), args); err != nil {
+		return err
+	}
+	app := bootstrap.NewApplication(c.Config)
+	return app.Listen(c.Config.App.Address())
+}
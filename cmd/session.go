@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-chat-app/app/repositories"
+)
+
+func sessionRevoke(c *CLI, args []string) error {
+	flags := c.flagSet("session revoke")
+	noteRevocation(flags)
+	id := flags.Uint("id", 0, "revoke the session with this id")
+	username := flags.String("user", "", "revoke every session of this user")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if (*id == 0) == (*username == "") {
+		return errors.New("exactly one of -id and -user is required")
+	}
+
+	ctx := context.Background()
+	if *username != "" {
+		revoked, err := c.revokeSessions(ctx, *username)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.Out, "revoked %d sessions of %s\n", revoked, *username)
+		return nil
+	}
+
+	c.warnLocalRevocation()
+	err := c.Open().Sessions.DeleteUserSessionById(ctx, *id)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("session %d does not exist", *id)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "revoked session %d\n", *id)
+	return nil
+}
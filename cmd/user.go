@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"go-chat-app/app/models"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/logger"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// minPasswordLength mirrors the validate tag of models.User.Password.
+const minPasswordLength = 6
+
+func userCreate(c *CLI, args []string) error {
+	flags := c.flagSet("user create")
+	username := flags.String("username", "", "login name, 6 to 20 characters")
+	fullName := flags.String("full-name", "", "display name")
+	password := flags.String("password", "", "password; read from stdin when omitted")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if err := required("username", *username); err != nil {
+		return err
+	}
+	if err := c.password(password); err != nil {
+		return err
+	}
+
+	user := &models.User{Username: *username, Password: *password, FullName: *fullName}
+	if err := user.Validate(); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.Password = string(hash)
+
+	err = c.Open().Users.CreateUser(context.Background(), user)
+	if errors.Is(err, repositories.ErrDuplicate) {
+		return fmt.Errorf("user %s already exists", user.Username)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "created user %s\n", user.Username)
+	return nil
+}
+
+func userDisable(c *CLI, args []string) error {
+	flags := c.flagSet("user disable")
+	noteRevocation(flags)
+	username := flags.String("username", "", "account to disable")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if err := required("username", *username); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err := c.Open().Users.SetUserDisabled(ctx, *username, true); err != nil {
+		return userError(*username, err)
+	}
+	revoked, err := c.revokeSessions(ctx, *username)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "disabled user %s, revoked %d sessions\n", *username, revoked)
+	return nil
+}
+
+func userEnable(c *CLI, args []string) error {
+	flags := c.flagSet("user enable")
+	username := flags.String("username", "", "account to re-enable")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if err := required("username", *username); err != nil {
+		return err
+	}
+
+	if err := c.Open().Users.SetUserDisabled(context.Background(), *username, false); err != nil {
+		return userError(*username, err)
+	}
+	fmt.Fprintf(c.Out, "enabled user %s\n", *username)
+	return nil
+}
+
+func userResetPassword(c *CLI, args []string) error {
+	flags := c.flagSet("user reset-password")
+	noteRevocation(flags)
+	username := flags.String("username", "", "account whose password is reset")
+	password := flags.String("password", "", "new password; read from stdin when omitted")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if err := required("username", *username); err != nil {
+		return err
+	}
+	if err := c.password(password); err != nil {
+		return err
+	}
+	if len(*password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(*password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := c.Open().Users.UpdateUserPassword(ctx, *username, string(hash)); err != nil {
+		return userError(*username, err)
+	}
+	revoked, err := c.revokeSessions(ctx, *username)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.Out, "reset password of %s, revoked %d sessions\n", *username, revoked)
+	return nil
+}
+
+// userReset2FA is for users who lost both their authenticator and their
+// recovery codes. They log in with the password alone and can enroll again.
+func userReset2FA(c *CLI, args []string) error {
+	flags := c.flagSet("user reset-2fa")
+	username := flags.String("username", "", "account whose two-factor authentication is turned off")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if err := required("username", *username); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	users := c.Open().Users
+	user, err := users.GetUserByUsername(ctx, *username)
+	if err != nil {
+		return userError(*username, err)
+	}
+	if err := users.UpdateTwoFactor(ctx, *username, "", false); err != nil {
+		return userError(*username, err)
+	}
+	if err := users.ReplaceRecoveryCodes(ctx, user.Id, nil); err != nil {
+		return err
+	}
+	logger.Audit(ctx, "two-factor authentication reset", "username", *username)
+	fmt.Fprintf(c.Out, "turned off two-factor authentication of %s\n", *username)
+	return nil
+}
+
+// userSetRole sets the global role. It takes effect in new access tokens, at
+// the latest when the user's current one is refreshed.
+func userSetRole(c *CLI, args []string) error {
+	flags := c.flagSet("user set-role")
+	username := flags.String("username", "", "account whose role is set")
+	role := flags.String("role", "", "admin or member")
+	if err := parse(flags, args); err != nil {
+		return err
+	}
+	if err := required("username", *username); err != nil {
+		return err
+	}
+	if !models.Role(*role).Global() {
+		return fmt.Errorf("-role must be admin or member, not %q", *role)
+	}
+
+	ctx := context.Background()
+	if err := c.Open().Users.SetUserRole(ctx, *username, models.Role(*role)); err != nil {
+		return userError(*username, err)
+	}
+	logger.Audit(ctx, "role changed", "username", *username, "role", *role)
+	fmt.Fprintf(c.Out, "%s is now %s\n", *username, *role)
+	return nil
+}
+
+// password reads the password from In unless it was given as a flag.
+func (c *CLI) password(password *string) error {
+	if *password != "" {
+		return nil
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return fmt.Errorf("failed to read password from stdin: %w", err)
+	}
+	*password = line
+	return nil
+}
+
+// revokeSessions logs a user out everywhere.
+func (c *CLI) revokeSessions(ctx context.Context, username string) (int64, error) {
+	repos := c.Open()
+	user, err := repos.Users.GetUserByUsername(ctx, username)
+	if err != nil {
+		return 0, userError(username, err)
+	}
+	c.warnLocalRevocation()
+	return repos.Sessions.DeleteUserSessions(ctx, user.Id)
+}
+
+// revocationNote is printed in the help of the commands that revoke sessions.
+const revocationNote = `Revoked sessions can no longer refresh their tokens. Running servers only reject
+their access tokens when REVOCATION_BACKEND=sql; with the memory backend they stay
+valid until they expire, and the command warns about it.`
+
+// noteRevocation adds revocationNote to the help of flags.
+func noteRevocation(flags *flag.FlagSet) {
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage of %s:\n", flags.Name())
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\n%s\n", revocationNote)
+	}
+}
+
+// warnLocalRevocation warns that access tokens revoked by this process are
+// only rejected by running servers that share the sql revocation backend.
+// The memory backend revokes them in the CLI process alone.
+func (c *CLI) warnLocalRevocation() {
+	if c.Config != nil && c.Config.Revocation.Backend == config.RevocationBackendSQL {
+		return
+	}
+	fmt.Fprintln(c.Err, "WARNING: REVOCATION_BACKEND is not sql. Refresh tokens of the revoked sessions stop working,")
+	fmt.Fprintln(c.Err, "but running servers keep accepting their access tokens until they expire.")
+}
+
+func userError(username string, err error) error {
+	if errors.Is(err, repositories.ErrNotFound) {
+		return fmt.Errorf("user %s does not exist", username)
+	}
+	return err
+}
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
-	"go-chat-app/bootstrap"
-	"go-chat-app/pkg/env"
-	"log"
+	"go-chat-app/cmd"
+	"os"
 )
 
 func main() {
 
-	app := bootstrap.NewApplication()
-	log.Fatal(app.Listen(fmt.Sprintf("%s:%s", env.GetEnv("APP_HOST", "localhost"), env.GetEnv("APP_PORT", "4000"))))
+	if err := cmd.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 
 }
@@ -0,0 +1,341 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Config is the complete application configuration. Values are resolved in
+// the order defaults, config file, environment (including .env), with later
+// sources taking precedence.
+type Config struct {
+	App      AppConfig      `yaml:"app" toml:"app"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	Messages MessagesConfig `yaml:"messages" toml:"messages"`
+	Mongo    MongoConfig    `yaml:"mongo" toml:"mongo"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+
+	// Retention applies to whichever message store is configured.
+	Retention RetentionConfig `yaml:"retention" toml:"retention"`
+	Archive   ArchiveConfig   `yaml:"archive" toml:"archive"`
+
+	JWT        JWTConfig        `yaml:"jwt" toml:"jwt"`
+	Revocation RevocationConfig `yaml:"revocation" toml:"revocation"`
+	OIDC       OIDCConfig       `yaml:"oidc" toml:"oidc"`
+	Mail       MailConfig       `yaml:"mail" toml:"mail"`
+	Login      LoginConfig      `yaml:"login" toml:"login"`
+	Moderation ModerationConfig `yaml:"moderation" toml:"moderation"`
+	Filter     FilterConfig     `yaml:"filter" toml:"filter"`
+	Flood      FloodConfig      `yaml:"flood" toml:"flood"`
+}
+
+type AppConfig struct {
+	Name       string `yaml:"name" toml:"name" env:"APP_NAME" default:"go-chat-app" validate:"required"`
+	Host       string `yaml:"host" toml:"host" env:"APP_HOST" default:"localhost"`
+	Port       int    `yaml:"port" toml:"port" env:"APP_PORT" default:"4000" validate:"min=1,max=65535"`
+	SocketPort int    `yaml:"socket_port" toml:"socket_port" env:"APP_PORT_SOCKET" default:"8080" validate:"min=1,max=65535"`
+	Secret     string `yaml:"secret" toml:"secret" env:"APP_SECRET" validate:"required,min=16"`
+}
+
+func (a AppConfig) Address() string {
+	return fmt.Sprintf("%s:%d", a.Host, a.Port)
+}
+
+func (a AppConfig) SocketAddress() string {
+	return fmt.Sprintf("%s:%d", a.Host, a.SocketPort)
+}
+
+const (
+	DriverMySQL    = "mysql"
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// DatabaseConfig selects the relational store for users and sessions. For
+// SQLite, Name is the path of the database file and the network settings are
+// ignored.
+type DatabaseConfig struct {
+	Driver   string `yaml:"driver" toml:"driver" env:"DB_DRIVER" default:"mysql" validate:"oneof=mysql postgres sqlite"`
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST" default:"127.0.0.1" validate:"required_unless=Driver sqlite"`
+	Port     int    `yaml:"port" toml:"port" env:"DB_PORT" validate:"min=0,max=65535"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER" validate:"required_unless=Driver sqlite"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME" validate:"required"`
+	SSLMode  string `yaml:"ssl_mode" toml:"ssl_mode" env:"DB_SSLMODE" default:"disable"`
+	// LogLevel is the GORM log level; info logs every SQL statement.
+	LogLevel string `yaml:"log_level" toml:"log_level" env:"DB_LOG_LEVEL" default:"warn" validate:"oneof=silent error warn info"`
+	// MigrateOnStart applies pending migrations when the server boots. The
+	// migration lock makes this safe with several replicas.
+	MigrateOnStart bool `yaml:"migrate_on_start" toml:"migrate_on_start" env:"DB_MIGRATE_ON_START" default:"true"`
+}
+
+// DSN builds the connection string for the configured driver. A zero Port
+// means the driver's default port.
+func (d DatabaseConfig) DSN() string {
+	switch d.Driver {
+	case DriverPostgres:
+		port := d.Port
+		if port == 0 {
+			port = 5432
+		}
+		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s TimeZone=UTC",
+			d.Host, port, d.User, d.Password, d.Name, d.SSLMode)
+	case DriverSQLite:
+		return d.Name + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	default:
+		port := d.Port
+		if port == 0 {
+			port = 3306
+		}
+		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=Local", d.User, d.Password, d.Host, port, d.Name)
+	}
+}
+
+const (
+	MessageStoreMongo = "mongo"
+	MessageStoreSQL   = "sql"
+)
+
+// MessagesConfig selects where chat history is stored. The sql store uses
+// the database configured in DatabaseConfig.
+type MessagesConfig struct {
+	Store string `yaml:"store" toml:"store" env:"MESSAGE_STORE" default:"mongo" validate:"oneof=mongo sql"`
+}
+
+// RetentionConfig limits how long chat history is kept. A zero duration keeps
+// messages forever. A room listed in Rooms follows its own duration instead of
+// Default, so `ops=0` exempts that room.
+type RetentionConfig struct {
+	Default time.Duration `yaml:"default" toml:"default" env:"RETENTION_DEFAULT" default:"0s"`
+	// Rooms is written as room=duration pairs in the environment, e.g.
+	// RETENTION_ROOMS=ops=720h,support=2160h.
+	Rooms     map[string]time.Duration `yaml:"rooms" toml:"rooms" env:"RETENTION_ROOMS"`
+	Interval  time.Duration            `yaml:"interval" toml:"interval" env:"RETENTION_INTERVAL" default:"1h"`
+	BatchSize int                      `yaml:"batch_size" toml:"batch_size" env:"RETENTION_BATCH_SIZE" default:"1000" validate:"min=1"`
+	// MongoTTL lets MongoDB expire messages older than Default itself,
+	// through a TTL index on the date field.
+	MongoTTL bool `yaml:"mongo_ttl" toml:"mongo_ttl" env:"RETENTION_MONGO_TTL" default:"false"`
+}
+
+// Enabled reports whether any retention policy is configured.
+func (r RetentionConfig) Enabled() bool {
+	if r.Default > 0 {
+		return true
+	}
+	for _, maxAge := range r.Rooms {
+		if maxAge > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	ArchiveBackendNone = "none"
+	ArchiveBackendFile = "file"
+)
+
+// ArchiveConfig moves messages older than After out of the message store into
+// compressed chunks on a blob backend. Every instance with a backend reads
+// history past the hot window from the archive; Job should be enabled on a
+// single instance only, because the manifest has one writer.
+type ArchiveConfig struct {
+	Backend  string        `yaml:"backend" toml:"backend" env:"ARCHIVE_BACKEND" default:"none" validate:"oneof=none file"`
+	Dir      string        `yaml:"dir" toml:"dir" env:"ARCHIVE_DIR" default:"./archive"`
+	After    time.Duration `yaml:"after" toml:"after" env:"ARCHIVE_AFTER" default:"720h"`
+	Interval time.Duration `yaml:"interval" toml:"interval" env:"ARCHIVE_INTERVAL" default:"24h"`
+	Job      bool          `yaml:"job" toml:"job" env:"ARCHIVE_JOB" default:"true"`
+}
+
+func (a ArchiveConfig) Enabled() bool {
+	return a.Backend != ArchiveBackendNone
+}
+
+// JWTConfig selects the keys tokens are signed with. Without SigningKey tokens
+// are signed with HS256 and APP_SECRET. SigningKey is the path of a PEM RSA or
+// Ed25519 private key, which signs with RS256 or EdDSA respectively, and
+// VerificationKeys lists PEM public keys that tokens are still accepted from,
+// so that tokens signed before a key rotation stay valid until they expire.
+// With SigningKey set, AcceptHS256 keeps accepting tokens signed with
+// APP_SECRET before HS256RetiredAt, the time of the switch, for one refresh
+// token lifetime after it, so that moving off HS256 does not log everyone
+// out.
+type JWTConfig struct {
+	SigningKey string `yaml:"signing_key" toml:"signing_key" env:"JWT_SIGNING_KEY"`
+	// VerificationKeys is written comma-separated in the environment.
+	VerificationKeys []string  `yaml:"verification_keys" toml:"verification_keys" env:"JWT_VERIFICATION_KEYS"`
+	AcceptHS256      bool      `yaml:"accept_hs256" toml:"accept_hs256" env:"JWT_ACCEPT_HS256"`
+	HS256RetiredAt   time.Time `yaml:"hs256_retired_at" toml:"hs256_retired_at" env:"JWT_HS256_RETIRED_AT"`
+}
+
+const (
+	RevocationBackendMemory = "memory"
+	RevocationBackendSQL    = "sql"
+)
+
+// RevocationConfig selects where revoked access tokens are recorded. The
+// memory backend is local to one process; the sql backend is shared by every
+// instance and the command line. Each instance caches lookups for CacheTTL,
+// so a revocation made elsewhere takes up to CacheTTL to apply.
+type RevocationConfig struct {
+	Backend  string        `yaml:"backend" toml:"backend" env:"REVOCATION_BACKEND" default:"memory" validate:"oneof=memory sql"`
+	CacheTTL time.Duration `yaml:"cache_ttl" toml:"cache_ttl" env:"REVOCATION_CACHE_TTL" default:"30s"`
+}
+
+const (
+	LoginBackendMemory = "memory"
+	LoginBackendSQL    = "sql"
+)
+
+// LoginConfig throttles password and two-factor guessing. Failed logins are
+// counted per username and per client IP. Past the free attempts of a key,
+// each failure makes it wait Backoff, doubling with every further failure;
+// at LockoutAfter failures the key is locked for LockoutDuration. Failures
+// are forgotten LockoutDuration after the last one. The memory backend
+// counts per process; the sql backend is shared by every instance.
+type LoginConfig struct {
+	Backend          string        `yaml:"backend" toml:"backend" env:"LOGIN_ATTEMPTS_BACKEND" default:"memory" validate:"oneof=memory sql"`
+	UserFreeAttempts int           `yaml:"user_free_attempts" toml:"user_free_attempts" env:"LOGIN_USER_FREE_ATTEMPTS" default:"3" validate:"min=0"`
+	UserLockoutAfter int           `yaml:"user_lockout_after" toml:"user_lockout_after" env:"LOGIN_USER_LOCKOUT_AFTER" default:"10" validate:"min=1"`
+	IPFreeAttempts   int           `yaml:"ip_free_attempts" toml:"ip_free_attempts" env:"LOGIN_IP_FREE_ATTEMPTS" default:"10" validate:"min=0"`
+	IPLockoutAfter   int           `yaml:"ip_lockout_after" toml:"ip_lockout_after" env:"LOGIN_IP_LOCKOUT_AFTER" default:"50" validate:"min=1"`
+	Backoff          time.Duration `yaml:"backoff" toml:"backoff" env:"LOGIN_BACKOFF" default:"1s"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" toml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" default:"15m"`
+}
+
+// ModerationConfig sets how often expired mutes and bans are lifted. They
+// stop being enforced when they expire; the sweep only records them lifted
+// and tells the room.
+type ModerationConfig struct {
+	SweepInterval time.Duration `yaml:"sweep_interval" toml:"sweep_interval" env:"MODERATION_SWEEP_INTERVAL" default:"30s"`
+}
+
+// FloodConfig limits what a WebSocket client may send. Every frame takes a
+// token from the bucket of its connection and from that of its user, shared
+// by all of the user's connections; each refills at its rate per second up
+// to its burst. A frame without tokens is dropped and earns the user a
+// strike. The first strike is answered with a warning, MuteAfter strikes
+// mute the user for MuteDuration and DisconnectAfter strikes close the
+// connection. Strikes are forgotten StrikeWindow after the last one. Limits
+// and mutes apply per process.
+type FloodConfig struct {
+	UserRate  int `yaml:"user_rate" toml:"user_rate" env:"FLOOD_USER_RATE" default:"5" validate:"min=1"`
+	UserBurst int `yaml:"user_burst" toml:"user_burst" env:"FLOOD_USER_BURST" default:"20" validate:"min=1"`
+	ConnRate  int `yaml:"conn_rate" toml:"conn_rate" env:"FLOOD_CONN_RATE" default:"3" validate:"min=1"`
+	ConnBurst int `yaml:"conn_burst" toml:"conn_burst" env:"FLOOD_CONN_BURST" default:"10" validate:"min=1"`
+	// MaxFrameSize is the size in bytes of the largest frame read from a
+	// client. A larger one closes the connection.
+	MaxFrameSize int `yaml:"max_frame_size" toml:"max_frame_size" env:"FLOOD_MAX_FRAME_SIZE" default:"16384" validate:"min=1"`
+	// MaxConnections caps the connections of a user; 0 lifts the cap.
+	MaxConnections  int           `yaml:"max_connections" toml:"max_connections" env:"FLOOD_MAX_CONNECTIONS" default:"5" validate:"min=0"`
+	MuteAfter       int           `yaml:"mute_after" toml:"mute_after" env:"FLOOD_MUTE_AFTER" default:"3" validate:"min=1"`
+	MuteDuration    time.Duration `yaml:"mute_duration" toml:"mute_duration" env:"FLOOD_MUTE_DURATION" default:"1m"`
+	DisconnectAfter int           `yaml:"disconnect_after" toml:"disconnect_after" env:"FLOOD_DISCONNECT_AFTER" default:"10" validate:"min=1"`
+	StrikeWindow    time.Duration `yaml:"strike_window" toml:"strike_window" env:"FLOOD_STRIKE_WINDOW" default:"1m"`
+}
+
+// What a content filter does with a message it matches.
+const (
+	FilterActionOff    = "off"
+	FilterActionFlag   = "flag"
+	FilterActionMask   = "mask"
+	FilterActionReject = "reject"
+)
+
+// FilterConfig screens chat messages before they are stored. MaxLength
+// counts characters; 0 turns the limit off. SanitizeHTML strips markup.
+// Secrets, such as API keys and card numbers, and blocked words are each
+// flagged to the audit log, masked or rejected, or let through with off.
+type FilterConfig struct {
+	MaxLength     int    `yaml:"max_length" toml:"max_length" env:"FILTER_MAX_LENGTH" default:"4000" validate:"min=0"`
+	SanitizeHTML  bool   `yaml:"sanitize_html" toml:"sanitize_html" env:"FILTER_SANITIZE_HTML" default:"true"`
+	SecretsAction string `yaml:"secrets_action" toml:"secrets_action" env:"FILTER_SECRETS_ACTION" default:"mask" validate:"oneof=off flag mask reject"`
+	// SecretPatterns are regular expressions matched in addition to the
+	// built-in ones.
+	SecretPatterns []string `yaml:"secret_patterns" toml:"secret_patterns" env:"FILTER_SECRET_PATTERNS"`
+	// Profanity adds a built-in list of English profanity to Words.
+	Profanity   bool     `yaml:"profanity" toml:"profanity" env:"FILTER_PROFANITY" default:"false"`
+	Words       []string `yaml:"words" toml:"words" env:"FILTER_WORDS"`
+	WordsAction string   `yaml:"words_action" toml:"words_action" env:"FILTER_WORDS_ACTION" default:"mask" validate:"oneof=off flag mask reject"`
+	// Rooms configures the word filter of single rooms. They can only be
+	// set in the config file.
+	Rooms map[string]RoomFilterConfig `yaml:"rooms" toml:"rooms"`
+}
+
+// RoomFilterConfig configures the word filter of one room. Words and
+// Profanity add to those of FilterConfig; Action, when set, replaces
+// FilterConfig.WordsAction.
+type RoomFilterConfig struct {
+	Words     []string `yaml:"words" toml:"words"`
+	Profanity bool     `yaml:"profanity" toml:"profanity"`
+	Action    string   `yaml:"action" toml:"action"`
+}
+
+// OIDCConfig enables login through an OpenID Connect provider when Issuer is
+// set. RedirectURL must be registered with the provider and lead back to
+// the login page, which completes the login at /api/user/v1/oidc/callback.
+// ClientSecret may be empty for a public client, which relies on PKCE alone.
+type OIDCConfig struct {
+	Issuer       string   `yaml:"issuer" toml:"issuer" env:"OIDC_ISSUER" validate:"omitempty,url"`
+	ClientID     string   `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL" validate:"omitempty,url"`
+	Scopes       []string `yaml:"scopes" toml:"scopes" env:"OIDC_SCOPES" default:"openid,profile,email"`
+	// Name labels the sign-in button, as in "Sign in with Name".
+	Name string `yaml:"name" toml:"name" env:"OIDC_NAME" default:"SSO"`
+	// AutoCreate creates an account on the first login of an unknown
+	// identity. Without it, identities must be linked to an existing
+	// account first.
+	AutoCreate bool `yaml:"auto_create" toml:"auto_create" env:"OIDC_AUTO_CREATE" default:"true"`
+}
+
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != ""
+}
+
+const (
+	MailBackendLog  = "log"
+	MailBackendFile = "file"
+	MailBackendSMTP = "smtp"
+)
+
+// MailConfig selects how account mail, such as email verification and
+// password reset links, is delivered. The log backend writes messages to the
+// application log and the file backend appends them to File, both meant for
+// local development. BaseURL is the address of the web UI the links in the
+// mails lead to.
+type MailConfig struct {
+	Backend      string `yaml:"backend" toml:"backend" env:"MAIL_BACKEND" default:"log" validate:"oneof=log file smtp"`
+	From         string `yaml:"from" toml:"from" env:"MAIL_FROM" default:"go-chat-app <no-reply@localhost>" validate:"required"`
+	File         string `yaml:"file" toml:"file" env:"MAIL_FILE" default:"./logs/mail.log"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"MAIL_SMTP_HOST"`
+	SMTPPort     int    `yaml:"smtp_port" toml:"smtp_port" env:"MAIL_SMTP_PORT" default:"587" validate:"min=1,max=65535"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"MAIL_SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"MAIL_SMTP_PASSWORD"`
+	BaseURL      string `yaml:"base_url" toml:"base_url" env:"MAIL_BASE_URL" default:"http://localhost:4000" validate:"url"`
+	// VerificationTTL and ResetTTL bound how long the links in verification
+	// and password reset mails work.
+	VerificationTTL time.Duration `yaml:"verification_ttl" toml:"verification_ttl" env:"MAIL_VERIFICATION_TTL" default:"24h"`
+	ResetTTL        time.Duration `yaml:"reset_ttl" toml:"reset_ttl" env:"MAIL_RESET_TTL" default:"1h"`
+}
+
+// MongoConfig is only required when MESSAGE_STORE is mongo.
+type MongoConfig struct {
+	URI        string `yaml:"uri" toml:"uri" env:"MONGODB_URI"`
+	Database   string `yaml:"database" toml:"database" env:"MONGODB_DATABASE" default:"go-chat-app" validate:"required"`
+	Collection string `yaml:"collection" toml:"collection" env:"MONGODB_COLLECTION" default:"chat_history" validate:"required"`
+}
+
+type LogConfig struct {
+	Level      string `yaml:"level" toml:"level" env:"LOG_LEVEL" default:"info" validate:"oneof=debug info warn error"`
+	File       string `yaml:"file" toml:"file" env:"LOG_FILE" default:"./logs/chat_message.log"`
+	MaxSizeMB  int    `yaml:"max_size_mb" toml:"max_size_mb" env:"LOG_MAX_SIZE_MB" default:"100" validate:"min=1"`
+	MaxBackups int    `yaml:"max_backups" toml:"max_backups" env:"LOG_MAX_BACKUPS" default:"5" validate:"min=0"`
+	MaxAgeDays int    `yaml:"max_age_days" toml:"max_age_days" env:"LOG_MAX_AGE_DAYS" default:"28" validate:"min=0"`
+	Compress   bool   `yaml:"compress" toml:"compress" env:"LOG_COMPRESS" default:"false"`
+}
+
+type TracingConfig struct {
+	Backend string `yaml:"backend" toml:"backend" env:"TRACING_BACKEND" default:"apm" validate:"oneof=apm otel"`
+}
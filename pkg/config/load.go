@@ -0,0 +1,369 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-playground/validator/v10"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultEnvFile = ".env"
+	FileEnv        = "CONFIG_FILE"
+)
+
+type Options struct {
+	// EnvFile is loaded into the process environment without overriding
+	// variables that are already set. A missing file is not an error.
+	EnvFile string
+	// File is an optional YAML or TOML file. When empty, CONFIG_FILE is used.
+	File string
+}
+
+// Load resolves and validates the configuration.
+func Load(opts Options) (*Config, error) {
+	if opts.EnvFile == "" {
+		opts.EnvFile = DefaultEnvFile
+	}
+	if err := godotenv.Load(opts.EnvFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("config: failed to load %s: %w", opts.EnvFile, err)
+	}
+
+	cfg := &Config{}
+	if err := walk(reflect.ValueOf(cfg).Elem(), applyDefault); err != nil {
+		return nil, err
+	}
+
+	file := opts.File
+	if file == "" {
+		file = os.Getenv(FileEnv)
+	}
+	if file != "" {
+		if err := loadFile(file, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := walk(reflect.ValueOf(cfg).Elem(), applyEnv); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: failed to read %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("config: unsupported file type %q, expected .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config: failed to parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate reports every invalid field at once, named by its environment
+// variable so the message points at what to fix.
+func (c *Config) Validate() error {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		if name := field.Tag.Get("env"); name != "" {
+			return name
+		}
+		return field.Name
+	})
+
+	var msgs []string
+	if err := v.Struct(c); err != nil {
+		var fieldErrs validator.ValidationErrors
+		if !errors.As(err, &fieldErrs) {
+			return err
+		}
+		for _, fe := range fieldErrs {
+			msgs = append(msgs, describe(fe))
+		}
+	}
+	msgs = append(msgs, c.crossFieldErrors()...)
+
+	if len(msgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("config: invalid configuration:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+// crossFieldErrors covers rules that span sections, which struct tags cannot
+// express.
+func (c *Config) crossFieldErrors() []string {
+	var msgs []string
+	if c.Messages.Store == MessageStoreMongo && c.Mongo.URI == "" {
+		msgs = append(msgs, "MONGODB_URI is required when MESSAGE_STORE is mongo")
+	}
+
+	retention := c.Retention
+	if retention.Default < 0 {
+		msgs = append(msgs, "RETENTION_DEFAULT must not be negative")
+	}
+	rooms := slices.Sorted(maps.Keys(retention.Rooms))
+	for _, room := range rooms {
+		if retention.Rooms[room] < 0 {
+			msgs = append(msgs, fmt.Sprintf("RETENTION_ROOMS: retention of room %q must not be negative", room))
+		}
+	}
+	if retention.Enabled() && retention.Interval <= 0 {
+		msgs = append(msgs, "RETENTION_INTERVAL must be positive when retention is enabled")
+	}
+	if retention.MongoTTL {
+		// The TTL index expires every room after Default, so it can only
+		// be combined with room policies that are shorter.
+		if c.Messages.Store != MessageStoreMongo {
+			msgs = append(msgs, "RETENTION_MONGO_TTL requires MESSAGE_STORE mongo")
+		}
+		if retention.Default <= 0 {
+			msgs = append(msgs, "RETENTION_MONGO_TTL requires RETENTION_DEFAULT")
+		}
+		for _, room := range rooms {
+			if maxAge := retention.Rooms[room]; maxAge == 0 || maxAge > retention.Default {
+				msgs = append(msgs, fmt.Sprintf("RETENTION_ROOMS: room %q keeps messages longer than RETENTION_DEFAULT, which RETENTION_MONGO_TTL cannot honour", room))
+			}
+		}
+	}
+
+	if c.Archive.Enabled() {
+		if c.Archive.After <= 0 {
+			msgs = append(msgs, "ARCHIVE_AFTER must be positive when ARCHIVE_BACKEND is set")
+		}
+		if c.Archive.Job && c.Archive.Interval <= 0 {
+			msgs = append(msgs, "ARCHIVE_INTERVAL must be positive when ARCHIVE_JOB is enabled")
+		}
+		if c.Archive.Backend == ArchiveBackendFile && c.Archive.Dir == "" {
+			msgs = append(msgs, "ARCHIVE_DIR is required when ARCHIVE_BACKEND is file")
+		}
+	}
+
+	if c.JWT.AcceptHS256 {
+		if c.JWT.SigningKey == "" {
+			msgs = append(msgs, "JWT_ACCEPT_HS256 requires JWT_SIGNING_KEY")
+		}
+		if c.JWT.HS256RetiredAt.IsZero() {
+			msgs = append(msgs, "JWT_HS256_RETIRED_AT is required when JWT_ACCEPT_HS256 is enabled")
+		}
+	}
+
+	if c.Revocation.CacheTTL < 0 {
+		msgs = append(msgs, "REVOCATION_CACHE_TTL must not be negative")
+	}
+
+	if c.OIDC.Enabled() {
+		if c.OIDC.ClientID == "" {
+			msgs = append(msgs, "OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+		}
+		if c.OIDC.RedirectURL == "" {
+			msgs = append(msgs, "OIDC_REDIRECT_URL is required when OIDC_ISSUER is set")
+		}
+		if !slices.Contains(c.OIDC.Scopes, "openid") {
+			msgs = append(msgs, "OIDC_SCOPES must include openid")
+		}
+	}
+
+	if c.Login.Backoff <= 0 || c.Login.LockoutDuration <= 0 {
+		msgs = append(msgs, "LOGIN_BACKOFF and LOGIN_LOCKOUT_DURATION must be positive")
+	}
+	if c.Login.UserFreeAttempts >= c.Login.UserLockoutAfter {
+		msgs = append(msgs, "LOGIN_USER_LOCKOUT_AFTER must be greater than LOGIN_USER_FREE_ATTEMPTS")
+	}
+	if c.Login.IPFreeAttempts >= c.Login.IPLockoutAfter {
+		msgs = append(msgs, "LOGIN_IP_LOCKOUT_AFTER must be greater than LOGIN_IP_FREE_ATTEMPTS")
+	}
+
+	for _, pattern := range c.Filter.SecretPatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			msgs = append(msgs, fmt.Sprintf("FILTER_SECRET_PATTERNS has an invalid pattern %q: %v", pattern, err))
+		}
+	}
+	for _, room := range slices.Sorted(maps.Keys(c.Filter.Rooms)) {
+		switch c.Filter.Rooms[room].Action {
+		case "", FilterActionOff, FilterActionFlag, FilterActionMask, FilterActionReject:
+		default:
+			msgs = append(msgs, fmt.Sprintf("filter.rooms.%s.action must be one of off, flag, mask or reject", room))
+		}
+	}
+
+	if c.Moderation.SweepInterval <= 0 {
+		msgs = append(msgs, "MODERATION_SWEEP_INTERVAL must be positive")
+	}
+
+	if c.Flood.MuteDuration <= 0 || c.Flood.StrikeWindow <= 0 {
+		msgs = append(msgs, "FLOOD_MUTE_DURATION and FLOOD_STRIKE_WINDOW must be positive")
+	}
+	if c.Flood.MuteAfter >= c.Flood.DisconnectAfter {
+		msgs = append(msgs, "FLOOD_DISCONNECT_AFTER must be greater than FLOOD_MUTE_AFTER")
+	}
+
+	if c.Mail.Backend == MailBackendSMTP && c.Mail.SMTPHost == "" {
+		msgs = append(msgs, "MAIL_SMTP_HOST is required when MAIL_BACKEND is smtp")
+	}
+	if c.Mail.Backend == MailBackendFile && c.Mail.File == "" {
+		msgs = append(msgs, "MAIL_FILE is required when MAIL_BACKEND is file")
+	}
+	if c.Mail.VerificationTTL <= 0 || c.Mail.ResetTTL <= 0 {
+		msgs = append(msgs, "MAIL_VERIFICATION_TTL and MAIL_RESET_TTL must be positive")
+	}
+	return msgs
+}
+
+func describe(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "required_unless":
+		return fmt.Sprintf("%s is required unless %s", fe.Field(), strings.Replace(fe.Param(), " ", " is ", 1))
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
+		}
+		return fmt.Sprintf("%s must be at least %s", fe.Field(), fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s", fe.Field(), fe.Param())
+	case "url":
+		return fmt.Sprintf("%s must be an absolute URL, got %q", fe.Field(), fmt.Sprint(fe.Value()))
+	case "oneof":
+		return fmt.Sprintf("%s must be one of [%s], got %q", fe.Field(), fe.Param(), fmt.Sprint(fe.Value()))
+	default:
+		return fmt.Sprintf("%s failed the %q check", fe.Field(), fe.Tag())
+	}
+}
+
+func applyDefault(field reflect.StructField, value reflect.Value) error {
+	def, ok := field.Tag.Lookup("default")
+	if !ok {
+		return nil
+	}
+	return set(value, def, field.Name)
+}
+
+func applyEnv(field reflect.StructField, value reflect.Value) error {
+	name := field.Tag.Get("env")
+	if name == "" {
+		return nil
+	}
+	raw, ok := os.LookupEnv(name)
+	if !ok {
+		return nil
+	}
+	return set(value, raw, name)
+}
+
+func walk(v reflect.Value, fn func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field, value := t.Field(i), v.Field(i)
+		if field.Type.Kind() == reflect.Struct && field.Type != reflect.TypeOf(time.Time{}) {
+			if err := walk(value, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func set(value reflect.Value, raw, name string) error {
+	switch {
+	case value.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("config: %s must be a duration such as 15m, got %q", name, raw)
+		}
+		value.SetInt(int64(d))
+	case value.Type() == reflect.TypeOf(time.Time{}):
+		at, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return fmt.Errorf("config: %s must be a time such as 2025-06-01T12:00:00Z, got %q", name, raw)
+		}
+		value.Set(reflect.ValueOf(at))
+	case value.Type() == reflect.TypeOf(map[string]time.Duration(nil)):
+		m, err := parseDurationMap(raw)
+		if err != nil {
+			return fmt.Errorf("config: %s must be a list such as ops=720h,support=2160h: %w", name, err)
+		}
+		value.Set(reflect.ValueOf(m))
+	case value.Type() == reflect.TypeOf([]string(nil)):
+		value.Set(reflect.ValueOf(parseList(raw)))
+	case value.Kind() == reflect.String:
+		value.SetString(raw)
+	case value.Kind() == reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("config: %s must be an integer, got %q", name, raw)
+		}
+		value.SetInt(int64(i))
+	case value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("config: %s must be true or false, got %q", name, raw)
+		}
+		value.SetBool(b)
+	default:
+		return fmt.Errorf("config: unsupported type %s for %s", value.Type(), name)
+	}
+	return nil
+}
+
+// parseList splits a comma-separated list, dropping empty items.
+func parseList(raw string) []string {
+	var list []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// parseDurationMap parses comma-separated key=duration pairs.
+func parseDurationMap(raw string) (map[string]time.Duration, error) {
+	m := make(map[string]time.Duration)
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("missing = in %q", pair)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return nil, err
+		}
+		m[strings.TrimSpace(key)] = d
+	}
+	return m, nil
+}
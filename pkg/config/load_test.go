@@ -0,0 +1,282 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func setRequired(t *testing.T) {
+	t.Helper()
+	t.Setenv("APP_SECRET", "0123456789abcdef0123")
+	t.Setenv("DB_USER", "chat")
+	t.Setenv("DB_NAME", "go_chat_app")
+	t.Setenv("MONGODB_URI", "mongodb://localhost:27017")
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setRequired(t)
+
+	cfg, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.App.Address() != "localhost:4000" {
+		t.Errorf("Address() = %q", cfg.App.Address())
+	}
+	if !strings.Contains(cfg.Database.DSN(), "@tcp(127.0.0.1:3306)/") || cfg.Mongo.Collection != "chat_history" || cfg.Tracing.Backend != "apm" {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadSQLiteNeedsNoServer(t *testing.T) {
+	setRequired(t)
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_USER", "")
+	t.Setenv("DB_NAME", "chat.db")
+
+	cfg, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !strings.HasPrefix(cfg.Database.DSN(), "chat.db?") {
+		t.Errorf("DSN() = %q", cfg.Database.DSN())
+	}
+
+	t.Setenv("DB_DRIVER", "postgres")
+	if _, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")}); err == nil || !strings.Contains(err.Error(), "DB_USER is required") {
+		t.Errorf("expected DB_USER error for postgres, got %v", err)
+	}
+}
+
+func TestLoadSQLMessageStoreNeedsNoMongo(t *testing.T) {
+	setRequired(t)
+	t.Setenv("MONGODB_URI", "")
+
+	if _, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")}); err == nil || !strings.Contains(err.Error(), "MONGODB_URI is required") {
+		t.Fatalf("expected MONGODB_URI error, got %v", err)
+	}
+
+	t.Setenv("MESSAGE_STORE", "sql")
+	if _, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")}); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+}
+
+func TestLoadMissingSecretFails(t *testing.T) {
+	setRequired(t)
+	t.Setenv("APP_SECRET", "")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil || !strings.Contains(err.Error(), "APP_SECRET is required") {
+		t.Fatalf("expected APP_SECRET error, got %v", err)
+	}
+}
+
+func TestLoadReportsEveryInvalidField(t *testing.T) {
+	setRequired(t)
+	t.Setenv("LOG_LEVEL", "verbose")
+	t.Setenv("TRACING_BACKEND", "zipkin")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"LOG_LEVEL must be one of", "TRACING_BACKEND must be one of"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLoadRejectsMalformedNumber(t *testing.T) {
+	setRequired(t)
+	t.Setenv("APP_PORT", "http")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil || !strings.Contains(err.Error(), "APP_PORT must be an integer") {
+		t.Fatalf("expected APP_PORT error, got %v", err)
+	}
+}
+
+func TestLoadFilePrecedence(t *testing.T) {
+	setRequired(t)
+	t.Setenv("APP_PORT", "9000")
+
+	yamlFile := writeFile(t, "config.yaml", "app:\n  host: 0.0.0.0\n  port: 5000\nlog:\n  level: debug\n")
+	cfg, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env"), File: yamlFile})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.App.Host != "0.0.0.0" || cfg.Log.Level != "debug" {
+		t.Errorf("file values not applied: %+v", cfg.App)
+	}
+	if cfg.App.Port != 9000 {
+		t.Errorf("environment should override the file, got port %d", cfg.App.Port)
+	}
+
+	tomlFile := writeFile(t, "config.toml", "[mongo]\ndatabase = \"chat\"\n")
+	cfg, err = Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env"), File: tomlFile})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Mongo.Database != "chat" {
+		t.Errorf("toml value not applied: %+v", cfg.Mongo)
+	}
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	setRequired(t)
+	t.Setenv("APP_NAME", "from-environment")
+	os.Unsetenv("APP_HOST")
+	t.Cleanup(func() { os.Unsetenv("APP_HOST") })
+
+	envFile := writeFile(t, ".env", "APP_HOST=chat.internal\nAPP_NAME=from-dotenv\n")
+	cfg, err := Load(Options{EnvFile: envFile})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.App.Host != "chat.internal" {
+		t.Errorf("expected APP_HOST from .env, got %q", cfg.App.Host)
+	}
+	if cfg.App.Name != "from-environment" {
+		t.Errorf(".env must not override the environment, got %q", cfg.App.Name)
+	}
+}
+
+func TestLoadRetention(t *testing.T) {
+	setRequired(t)
+	t.Setenv("RETENTION_DEFAULT", "2160h")
+	t.Setenv("RETENTION_ROOMS", "ops=720h, legal=0s")
+
+	cfg, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	rooms := cfg.Retention.Rooms
+	if cfg.Retention.Default != 2160*time.Hour || len(rooms) != 2 || rooms["ops"] != 720*time.Hour || rooms["legal"] != 0 {
+		t.Errorf("unexpected retention: %+v", cfg.Retention)
+	}
+
+	t.Setenv("RETENTION_MONGO_TTL", "true")
+	_, err = Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil || !strings.Contains(err.Error(), `room "legal" keeps messages longer`) {
+		t.Errorf("expected TTL conflict for room legal, got %v", err)
+	}
+
+	t.Setenv("RETENTION_ROOMS", "ops")
+	_, err = Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil || !strings.Contains(err.Error(), "RETENTION_ROOMS must be a list") {
+		t.Errorf("expected RETENTION_ROOMS parse error, got %v", err)
+	}
+}
+
+func TestLoadJWTVerificationKeys(t *testing.T) {
+	setRequired(t)
+	t.Setenv("JWT_SIGNING_KEY", "/etc/chat/jwt-2025-06.pem")
+	t.Setenv("JWT_VERIFICATION_KEYS", "/etc/chat/jwt-2025-03.pub, /etc/chat/jwt-2024-12.pub,")
+
+	cfg, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	keys := cfg.JWT.VerificationKeys
+	if cfg.JWT.SigningKey != "/etc/chat/jwt-2025-06.pem" || len(keys) != 2 || keys[0] != "/etc/chat/jwt-2025-03.pub" || keys[1] != "/etc/chat/jwt-2024-12.pub" {
+		t.Errorf("unexpected jwt config: %+v", cfg.JWT)
+	}
+}
+
+func TestLoadHS256Retirement(t *testing.T) {
+	setRequired(t)
+	t.Setenv("JWT_ACCEPT_HS256", "true")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	for _, name := range []string{"JWT_SIGNING_KEY", "JWT_HS256_RETIRED_AT"} {
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not mention %s:\n%v", name, err)
+		}
+	}
+
+	t.Setenv("JWT_SIGNING_KEY", "/etc/chat/jwt-2025-06.pem")
+	t.Setenv("JWT_HS256_RETIRED_AT", "2025-06-01T12:00:00Z")
+	cfg, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC); !cfg.JWT.HS256RetiredAt.Equal(want) {
+		t.Errorf("HS256RetiredAt = %v, want %v", cfg.JWT.HS256RetiredAt, want)
+	}
+}
+
+func TestLoadOIDCRequiresClient(t *testing.T) {
+	setRequired(t)
+	t.Setenv("OIDC_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_SCOPES", "profile,email")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil {
+		t.Fatal("expected an error for an incomplete OIDC configuration")
+	}
+	for _, name := range []string{"OIDC_CLIENT_ID", "OIDC_REDIRECT_URL", "OIDC_SCOPES"} {
+		if !strings.Contains(err.Error(), name) {
+			t.Errorf("error does not mention %s:\n%v", name, err)
+		}
+	}
+}
+
+func TestLoadSMTPNeedsHost(t *testing.T) {
+	setRequired(t)
+	t.Setenv("MAIL_BACKEND", "smtp")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil || !strings.Contains(err.Error(), "MAIL_SMTP_HOST is required") {
+		t.Errorf("expected MAIL_SMTP_HOST to be required, got %v", err)
+	}
+}
+
+func TestLoadLoginLockoutAfterFreeAttempts(t *testing.T) {
+	setRequired(t)
+	t.Setenv("LOGIN_USER_FREE_ATTEMPTS", "10")
+	t.Setenv("LOGIN_USER_LOCKOUT_AFTER", "5")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil || !strings.Contains(err.Error(), "LOGIN_USER_LOCKOUT_AFTER") {
+		t.Errorf("expected LOGIN_USER_LOCKOUT_AFTER to be rejected, got %v", err)
+	}
+}
+
+func TestLoadFilterRooms(t *testing.T) {
+	setRequired(t)
+	t.Setenv("FILTER_SECRET_PATTERNS", "(unclosed")
+
+	yamlFile := writeFile(t, "config.yaml", "filter:\n  rooms:\n    kids:\n      profanity: true\n      action: reject\n    ops:\n      action: shout\n")
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env"), File: yamlFile})
+	if err == nil || !strings.Contains(err.Error(), "FILTER_SECRET_PATTERNS") || !strings.Contains(err.Error(), "filter.rooms.ops.action") {
+		t.Fatalf("expected the pattern and the ops action to be rejected, got %v", err)
+	}
+	if strings.Contains(err.Error(), "kids") {
+		t.Errorf("valid room rejected: %v", err)
+	}
+}
+
+func TestLoadFloodDisconnectAfterMute(t *testing.T) {
+	setRequired(t)
+	t.Setenv("FLOOD_MUTE_AFTER", "5")
+	t.Setenv("FLOOD_DISCONNECT_AFTER", "5")
+
+	_, err := Load(Options{EnvFile: filepath.Join(t.TempDir(), ".env")})
+	if err == nil || !strings.Contains(err.Error(), "FLOOD_DISCONNECT_AFTER") {
+		t.Errorf("expected FLOOD_DISCONNECT_AFTER to be rejected, got %v", err)
+	}
+}
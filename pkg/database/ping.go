@@ -0,0 +1,26 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/v2/mongo/readpref"
+)
+
+func PingDatabase(ctx context.Context) error {
+	if DB == nil {
+		return errors.New("database is not initialized")
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+func PingMongoDb(ctx context.Context) error {
+	if MongoDB == nil {
+		return errors.New("mongoDB is not initialized")
+	}
+	return MongoDB.Database().Client().Ping(ctx, readpref.Primary())
+}
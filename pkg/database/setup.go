@@ -1,48 +1,79 @@
 package database
 
 import (
-	"fmt"
-	"go-chat-app/app/models"
-	"go-chat-app/pkg/env"
+	"context"
+	"go-chat-app/pkg/config"
 	"log"
 	"os"
+	"time"
 
+	"github.com/glebarez/sqlite"
 	"go.mongodb.org/mongo-driver/v2/mongo"
 	"go.mongodb.org/mongo-driver/v2/mongo/options"
 	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-func SetupDatabase() {
+func SetupDatabase(cfg config.DatabaseConfig) {
 	var err error
 
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local", env.GetEnv("DB_USER", ""), env.GetEnv("DB_PASSWORD", ""), env.GetEnv("DB_HOST", "127.0.0.1"), env.GetEnv("DB_PORT", "3306"), env.GetEnv("DB_NAME", ""))
-
-	DB, err = gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	DB, err = gorm.Open(Dialector(cfg), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatal("Failed to connect to the Database! \n", err.Error())
 		os.Exit(1)
 	}
 
-	err = DB.AutoMigrate(&models.User{}, &models.UserSession{})
-	if err != nil {
-		log.Fatal("Failed to migrate the Database! \n", err.Error())
+	// The std logger is routed through slog, so SQL logs end up in the same
+	// JSON stream as the rest of the application.
+	DB.Logger = logger.New(log.Default(), logger.Config{
+		SlowThreshold:             200 * time.Millisecond,
+		LogLevel:                  gormLogLevel(cfg.LogLevel),
+		IgnoreRecordNotFoundError: true,
+	})
+}
+
+func gormLogLevel(level string) logger.LogLevel {
+	switch level {
+	case "silent":
+		return logger.Silent
+	case "error":
+		return logger.Error
+	case "info":
+		return logger.Info
+	default:
+		return logger.Warn
 	}
+}
 
-	DB.Logger = logger.Default.LogMode(logger.Info)
+// Dialector returns the GORM dialector for the configured driver.
+func Dialector(cfg config.DatabaseConfig) gorm.Dialector {
+	switch cfg.Driver {
+	case config.DriverPostgres:
+		return postgres.Open(cfg.DSN())
+	case config.DriverSQLite:
+		return sqlite.Open(cfg.DSN())
+	default:
+		return mysql.Open(cfg.DSN())
+	}
 }
 
-func SetupMongoDb() {
-	uri := env.GetEnv("MONGODB_URI", "")
+func SetupMongoDb(cfg config.MongoConfig) {
 	client, err := mongo.Connect(options.Client().
-		ApplyURI(uri))
+		ApplyURI(cfg.URI))
 	if err != nil {
 		panic(err)
 	}
 
-	coll := client.Database("go-chat-app").Collection("chat_history")
+	coll := client.Database(cfg.Database).Collection(cfg.Collection)
 	MongoDB = coll
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := PingMongoDb(ctx); err != nil {
+		log.Fatal("Failed to connect to mongoDB! \n", err.Error())
+	}
+
 	log.Println("successfully connected to mongoDB")
 }
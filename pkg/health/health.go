@@ -0,0 +1,87 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+type CheckFunc func(ctx context.Context) error
+
+type Result struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+var (
+	mu     sync.RWMutex
+	checks = make(map[string]CheckFunc)
+)
+
+// Register adds a dependency check to the readiness report. Registering the
+// same name twice replaces the previous check.
+func Register(name string, check CheckFunc) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = check
+}
+
+// Check runs every registered check concurrently, each bounded by timeout.
+func Check(ctx context.Context, timeout time.Duration) Report {
+	mu.RLock()
+	current := make(map[string]CheckFunc, len(checks))
+	for name, check := range checks {
+		current[name] = check
+	}
+	mu.RUnlock()
+
+	report := Report{Status: StatusUp, Checks: make(map[string]Result, len(current))}
+
+	var wg sync.WaitGroup
+	var resultMu sync.Mutex
+	for name, check := range current {
+		wg.Add(1)
+		go func(name string, check CheckFunc) {
+			defer wg.Done()
+			result := run(ctx, check, timeout)
+
+			resultMu.Lock()
+			defer resultMu.Unlock()
+			report.Checks[name] = result
+			if result.Status != StatusUp {
+				report.Status = StatusDown
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return report
+}
+
+func run(ctx context.Context, check CheckFunc, timeout time.Duration) Result {
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check(checkCtx)
+	result := Result{
+		Status:    StatusUp,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
@@ -2,64 +2,187 @@ package jwt
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"go-chat-app/pkg/env"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/tracing"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"go.elastic.co/apm"
+	"github.com/google/uuid"
 )
 
 type ClaimToken struct {
-	Username string `json:"username"`
-	FullName string `json:"full_name"`
+	Username  string `json:"username"`
+	FullName  string `json:"full_name"`
+	TokenType string `json:"token_type"`
+	Roles
 	jwt.RegisteredClaims
 }
 
+// Roles are the roles of the user a token was issued to, as of issuance:
+// Role globally, and Rooms by room for the rooms where they hold more than
+// the member role. The default room has the empty name.
+type Roles struct {
+	Role  string            `json:"role,omitempty"`
+	Rooms map[string]string `json:"rooms,omitempty"`
+}
+
+var (
+	// signing signs new tokens; verification holds every key that tokens
+	// are accepted from, by kid. The HS256 key has no kid.
+	signing      *key
+	verification map[string]*key
+	issuer       string
+)
+
+var errNotConfigured = errors.New("jwt signing key is not configured")
+
+// Setup loads the signing and verification keys and sets the issuer. It must
+// be called before any token is generated or validated. Without a signing key
+// file tokens are signed with HS256 and the application secret; with one, the
+// application secret may remain a verification key retired at
+// cfg.HS256RetiredAt, which must lie within the last refresh token lifetime.
+func Setup(app config.AppConfig, cfg config.JWTConfig) error {
+	signing, verification, issuer = nil, map[string]*key{}, app.Name
+
+	if cfg.SigningKey == "" {
+		signing = &key{method: jwt.SigningMethodHS256, private: []byte(app.Secret), public: []byte(app.Secret)}
+	} else {
+		k, err := loadKeyFile(cfg.SigningKey)
+		if err != nil {
+			return fmt.Errorf("jwt: signing key: %w", err)
+		}
+		if k.private == nil {
+			return fmt.Errorf("jwt: signing key %s is a public key", cfg.SigningKey)
+		}
+		signing = k
+		if cfg.AcceptHS256 {
+			retired := cfg.HS256RetiredAt
+			if retired.IsZero() || retired.After(time.Now()) || time.Since(retired) >= MapTokenTypes["refresh"] {
+				return fmt.Errorf("jwt: HS256 retirement time %s is not within the last %s", retired.Format(time.RFC3339), MapTokenTypes["refresh"])
+			}
+			verification[""] = &key{method: jwt.SigningMethodHS256, public: []byte(app.Secret), retired: retired}
+		}
+	}
+	verification[signing.id] = signing
+
+	for _, path := range cfg.VerificationKeys {
+		k, err := loadKeyFile(path)
+		if err != nil {
+			return fmt.Errorf("jwt: verification key: %w", err)
+		}
+		// Only the public half is needed to verify.
+		k.private = nil
+		verification[k.id] = k
+	}
+	return nil
+}
+
+// Issuer returns the name tokens are issued under, the application name.
+func Issuer() string {
+	return issuer
+}
+
+// Algorithm returns the algorithm and kid that new tokens are signed with.
+func Algorithm() (alg, kid string) {
+	if signing == nil {
+		return "", ""
+	}
+	return signing.method.Alg(), signing.id
+}
+
+// JWKS returns the public keys tokens are accepted from, for services that
+// verify chat tokens themselves. It is empty with HS256.
+func JWKS() JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	if signing != nil && signing.id != "" {
+		set.Keys = append(set.Keys, signing.jwk())
+	}
+	for _, k := range verification {
+		if k.id != "" && k != signing {
+			set.Keys = append(set.Keys, k.jwk())
+		}
+	}
+	// The signing key first, the rest in a stable order.
+	slices.SortFunc(set.Keys[min(1, len(set.Keys)):], func(a, b JSONWebKey) int {
+		return strings.Compare(a.Kid, b.Kid)
+	})
+	return set
+}
+
 var MapTokenTypes = map[string]time.Duration{
 	"access":  time.Minute * 15,
 	"refresh": time.Hour * 24,
+	// 2fa is the intermediate token of a login that still needs a second
+	// factor.
+	"2fa": time.Minute * 5,
 }
 
-func GenerateToken(ctx context.Context, username, fullName, tokenType string, now time.Time) (string, error) {
+// GenerateToken signs a token of the given type and returns it together
+// with its unique id, the jti claim.
+func GenerateToken(ctx context.Context, username, fullName, tokenType string, roles Roles, now time.Time) (string, string, error) {
 
-	span, _ := apm.StartSpan(ctx, "GenerateToken", "jwt")
+	span, _ := tracing.StartSpan(ctx, "GenerateToken", "jwt")
 	defer span.End()
 
-	secret := []byte(env.GetEnv("APP_SECRET", ""))
+	if signing == nil {
+		return "", "", errNotConfigured
+	}
 
 	claims := ClaimToken{
-		Username: username,
-		FullName: fullName,
+		Username:  username,
+		FullName:  fullName,
+		TokenType: tokenType,
+		Roles:     roles,
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer:    env.GetEnv("APP_NAME", ""),
+			ID:        uuid.NewString(),
+			Issuer:    issuer,
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MapTokenTypes[tokenType])),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token := jwt.NewWithClaims(signing.method, claims)
+	if signing.id != "" {
+		token.Header["kid"] = signing.id
+	}
 
-	tokenString, err := token.SignedString(secret)
+	tokenString, err := token.SignedString(signing.private)
 	if err != nil {
-		return tokenString, errors.New("failed to generate token")
+		return tokenString, "", errors.New("failed to generate token")
 	}
-	return tokenString, nil
+	return tokenString, claims.ID, nil
 }
 
 func ValidateToken(ctx context.Context, token string) (*ClaimToken, error) {
 
-	span, _ := apm.StartSpan(ctx, "ValidateToken", "jwt")
+	span, _ := tracing.StartSpan(ctx, "ValidateToken", "jwt")
 	defer span.End()
 
-	secret := []byte(env.GetEnv("APP_SECRET", ""))
+	if signing == nil {
+		return nil, errNotConfigured
+	}
 
 	parsedToken, err := jwt.ParseWithClaims(token, &ClaimToken{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+		k, ok := verification[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+		// The algorithm must be the key's own, or a public key could be
+		// abused as an HMAC secret.
+		if token.Method.Alg() != k.method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return secret, nil
+		if !k.retired.IsZero() && !acceptRetired(k, token.Claims.(*ClaimToken)) {
+			return nil, errors.New("token of a retired signing key")
+		}
+		return k.public, nil
 	})
 
 	if err != nil {
@@ -72,3 +195,20 @@ func ValidateToken(ctx context.Context, token string) (*ClaimToken, error) {
 
 	return nil, errors.New("invalid token claims")
 }
+
+// acceptRetired reports whether a retired key still verifies claims: they
+// must have been issued before the key was retired, less than a refresh token
+// lifetime ago.
+func acceptRetired(k *key, claims *ClaimToken) bool {
+	if claims.IssuedAt == nil || !claims.IssuedAt.Before(k.retired) {
+		return false
+	}
+	return time.Since(k.retired) < MapTokenTypes["refresh"]
+}
+
+// HashToken returns the hex SHA-256 of a token, the form in which tokens are
+// stored and looked up so that a database leak exposes no usable token.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
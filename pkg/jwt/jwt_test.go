@@ -0,0 +1,210 @@
+package jwt
+
+import (
+	"context"
+	"go-chat-app/pkg/config"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var app = config.AppConfig{Name: "go-chat-app", Secret: "0123456789abcdef0123"}
+
+// writeKey generates a key for alg and returns the paths of its private and
+// public PEM files together with its kid.
+func writeKey(t *testing.T, alg string) (private, public, kid string) {
+	t.Helper()
+	privatePEM, publicPEM, kid, err := GenerateKey(alg)
+	if err != nil {
+		t.Fatalf("GenerateKey(%s): %v", alg, err)
+	}
+	dir := t.TempDir()
+	private, public = filepath.Join(dir, "key.pem"), filepath.Join(dir, "key.pub")
+	if err := os.WriteFile(private, privatePEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(public, publicPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return private, public, kid
+}
+
+func setup(t *testing.T, cfg config.JWTConfig) {
+	t.Helper()
+	if err := Setup(app, cfg); err != nil {
+		t.Fatalf("Setup: %v", err)
+	}
+}
+
+func generate(t *testing.T) string {
+	t.Helper()
+	token, _, err := GenerateToken(context.Background(), "alice01", "Alice Liddell", "access",
+		Roles{Role: "admin", Rooms: map[string]string{"": "moderator", "ops": "owner"}}, time.Now())
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+func header(t *testing.T, token string) map[string]interface{} {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &ClaimToken{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.Header
+}
+
+func TestHS256(t *testing.T) {
+	setup(t, config.JWTConfig{})
+
+	token := generate(t)
+	if h := header(t, token); h["alg"] != "HS256" || h["kid"] != nil {
+		t.Errorf("header = %v", h)
+	}
+	claims, err := ValidateToken(context.Background(), token)
+	if err != nil || claims.Username != "alice01" {
+		t.Errorf("ValidateToken = %+v, %v", claims, err)
+	}
+	if claims != nil && (claims.Role != "admin" || claims.Rooms[""] != "moderator" || claims.Rooms["ops"] != "owner") {
+		t.Errorf("roles = %+v", claims.Roles)
+	}
+	if keys := JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS publishes %d keys for HS256", len(keys))
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	oldPrivate, oldPublic, oldKid := writeKey(t, "EdDSA")
+	newPrivate, _, newKid := writeKey(t, "RS256")
+
+	setup(t, config.JWTConfig{SigningKey: oldPrivate})
+	oldToken := generate(t)
+	if h := header(t, oldToken); h["alg"] != "EdDSA" || h["kid"] != oldKid {
+		t.Errorf("header = %v, want EdDSA with kid %s", h, oldKid)
+	}
+
+	setup(t, config.JWTConfig{SigningKey: newPrivate, VerificationKeys: []string{oldPublic}})
+	newToken := generate(t)
+	if h := header(t, newToken); h["alg"] != "RS256" || h["kid"] != newKid {
+		t.Errorf("header = %v, want RS256 with kid %s", h, newKid)
+	}
+	for _, token := range []string{oldToken, newToken} {
+		if _, err := ValidateToken(ctx, token); err != nil {
+			t.Errorf("ValidateToken during rotation: %v", err)
+		}
+	}
+	keys := JWKS().Keys
+	if len(keys) != 2 || keys[0].Kid != newKid || keys[0].Kty != "RSA" || keys[1].Kid != oldKid || keys[1].Crv != "Ed25519" {
+		t.Errorf("JWKS = %+v", keys)
+	}
+
+	setup(t, config.JWTConfig{SigningKey: newPrivate})
+	if _, err := ValidateToken(ctx, oldToken); err == nil {
+		t.Error("token of a retired key was accepted")
+	}
+}
+
+func TestLeavingHS256(t *testing.T) {
+	ctx := context.Background()
+	private, _, _ := writeKey(t, "EdDSA")
+	retired := time.Now().Add(-time.Hour)
+	// Tokens signed with the application secret before and after the switch,
+	// the latter by whoever still holds the secret.
+	forge := func(issued time.Time) string {
+		claims := ClaimToken{Username: "alice01", TokenType: "access", Roles: Roles{Role: "admin"}, RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "forged",
+			IssuedAt:  jwt.NewNumericDate(issued),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(app.Secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	before, after := forge(retired.Add(-time.Minute)), forge(retired.Add(time.Minute))
+
+	cfg := config.JWTConfig{SigningKey: private, AcceptHS256: true, HS256RetiredAt: retired}
+	// A restart must not move the retirement.
+	for range 2 {
+		setup(t, cfg)
+		if _, err := ValidateToken(ctx, before); err != nil {
+			t.Errorf("HS256 token from before the switch: %v", err)
+		}
+		if _, err := ValidateToken(ctx, after); err == nil {
+			t.Error("HS256 token issued after the switch was accepted")
+		}
+	}
+	if keys := JWKS().Keys; len(keys) != 1 {
+		t.Errorf("JWKS publishes %d keys, want the signing key only", len(keys))
+	}
+
+	setup(t, config.JWTConfig{SigningKey: private})
+	if _, err := ValidateToken(ctx, before); err == nil {
+		t.Error("HS256 token accepted with AcceptHS256 off")
+	}
+
+	for name, at := range map[string]time.Time{
+		"unset":                  {},
+		"in the future":          time.Now().Add(time.Hour),
+		"a refresh lifetime ago": time.Now().Add(-MapTokenTypes["refresh"]),
+	} {
+		if err := Setup(app, config.JWTConfig{SigningKey: private, AcceptHS256: true, HS256RetiredAt: at}); err == nil {
+			t.Errorf("Setup accepted a retirement time %s", name)
+		}
+	}
+}
+
+func TestRejectsForeignAlgorithms(t *testing.T) {
+	_, public, kid := writeKey(t, "RS256")
+	private, _, _ := writeKey(t, "EdDSA")
+	setup(t, config.JWTConfig{SigningKey: private, VerificationKeys: []string{public}})
+	publicPEM, err := os.ReadFile(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := ClaimToken{Username: "mallory", TokenType: "access", RegisteredClaims: jwt.RegisteredClaims{
+		ID:        "forged",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	forge := func(kid string, secret []byte) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(secret)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	// The public key used as an HMAC secret, and the application secret once
+	// tokens are no longer signed with it.
+	for name, token := range map[string]string{
+		"public key as secret": forge(kid, publicPEM),
+		"application secret":   forge("", []byte(app.Secret)),
+	} {
+		if _, err := ValidateToken(context.Background(), token); err == nil {
+			t.Errorf("%s: forged token accepted", name)
+		}
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// The example of RFC 7638, section 3.1.
+	jwk := JSONWebKey{
+		Kty: "RSA",
+		E:   "AQAB",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+	}
+	if got := thumbprint(jwk); got != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("thumbprint = %s", got)
+	}
+}
@@ -0,0 +1,13 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Audit records a security or compliance event. Audit records are regular
+// JSON log lines marked with "audit": true, so they can be routed to their
+// own index and kept longer than the application log.
+func Audit(ctx context.Context, event string, args ...any) {
+	slog.Default().With("audit", true).InfoContext(ctx, event, args...)
+}
@@ -0,0 +1,49 @@
+package logger
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// RequestIDMiddleware reuses the caller's X-Request-ID or generates one, echoes it in
+// the response and stores it in the request's user context.
+func RequestIDMiddleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		id := ctx.Get(fiber.HeaderXRequestID)
+		if id == "" {
+			id = uuid.NewString()
+		}
+		ctx.Set(fiber.HeaderXRequestID, id)
+		ctx.SetUserContext(WithRequestID(ctx.UserContext(), id))
+		return ctx.Next()
+	}
+}
+
+// AccessLogMiddleware writes one structured line per request.
+func AccessLogMiddleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+		err := ctx.Next()
+
+		status := ctx.Response().StatusCode()
+		if e, ok := err.(*fiber.Error); ok {
+			status = e.Code
+		}
+
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(ctx.UserContext(), level, "request",
+			"method", ctx.Method(),
+			"path", ctx.Path(),
+			"status", status,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"ip", ctx.IP(),
+		)
+		return err
+	}
+}
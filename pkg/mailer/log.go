@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// LogSender writes messages to the application log instead of sending them,
+// so that links can be copied from the log during development.
+type LogSender struct{}
+
+func NewLogSender() *LogSender {
+	return &LogSender{}
+}
+
+func (LogSender) Send(ctx context.Context, msg Message) error {
+	slog.InfoContext(ctx, "mail not sent, MAIL_BACKEND is log", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileSender appends every message, in the form it would be sent in, to a
+// file. Messages are separated by a line holding only "--".
+type FileSender struct {
+	path string
+	from string
+
+	mu sync.Mutex
+}
+
+func NewFileSender(path, from string) *FileSender {
+	return &FileSender{path: path, from: from}
+}
+
+func (f *FileSender) Send(ctx context.Context, msg Message) error {
+	data, err := format(f.from, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.path), 0o755); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	// Mails carry secrets such as reset links.
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	if _, err := file.Write(append(data, "--\r\n"...)); err != nil {
+		file.Close()
+		return fmt.Errorf("mailer: %w", err)
+	}
+	return file.Close()
+}
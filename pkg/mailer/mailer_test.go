@@ -0,0 +1,141 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"go-chat-app/pkg/config"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+var msg = Message{To: "Alice <alice@example.com>", Subject: "Réinitialiser", Body: "Open\nhttps://chat.example.com/auth?reset_token=" + strings.Repeat("x", 80)}
+
+// readBody parses a formatted message and returns its decoded body.
+func readBody(t *testing.T, r io.Reader) (*mail.Message, string) {
+	t.Helper()
+	parsed, err := mail.ReadMessage(r)
+	if err != nil {
+		t.Fatalf("ReadMessage: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed, string(body)
+}
+
+func TestFormatRejectsHeaderInjection(t *testing.T) {
+	for _, m := range []Message{
+		{To: "alice@example.com\r\nBcc: mallory@example.com", Subject: "Hi"},
+		{To: "alice@example.com", Subject: "Hi\r\nBcc: mallory@example.com"},
+	} {
+		if _, err := format("noreply@example.com", m, time.Now()); err == nil {
+			t.Errorf("format(%q) succeeded", m)
+		}
+	}
+}
+
+func TestFileSender(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail", "mail.log")
+	sender := NewFileSender(path, "go-chat-app <noreply@example.com>")
+	if err := sender.Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, body := readBody(t, strings.NewReader(strings.TrimSuffix(string(data), "--\r\n")))
+	subject, _ := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if parsed.Header.Get("To") != "\"Alice\" <alice@example.com>" || subject != msg.Subject {
+		t.Errorf("headers = %v", parsed.Header)
+	}
+	if body != strings.ReplaceAll(msg.Body, "\n", "\r\n")+"\r\n" {
+		t.Errorf("body = %q", body)
+	}
+}
+
+func TestSMTPSender(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string, 1)
+	go serveSMTP(listener, received)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	cfg := config.MailConfig{From: "noreply@example.com", SMTPHost: host}
+	cfg.SMTPPort, _ = strconv.Atoi(port)
+	if err := NewSMTPSender(cfg).Send(context.Background(), msg); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	lines := <-received
+	if lines[0] != "MAIL FROM:<noreply@example.com>" || lines[1] != "RCPT TO:<alice@example.com>" {
+		t.Errorf("envelope = %q", lines[:2])
+	}
+	_, body := readBody(t, strings.NewReader(strings.Join(lines[2:], "\r\n")))
+	if !strings.Contains(body, "reset_token="+strings.Repeat("x", 80)) {
+		t.Errorf("body = %q", body)
+	}
+}
+
+// serveSMTP accepts a single message and sends its envelope commands and
+// data lines to received.
+func serveSMTP(listener net.Listener, received chan<- []string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	var lines []string
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		switch {
+		case strings.HasPrefix(line, "EHLO"):
+			reply("250 localhost")
+		case strings.HasPrefix(line, "MAIL FROM"), strings.HasPrefix(line, "RCPT TO"):
+			lines = append(lines, line)
+			reply("250 OK")
+		case line == "DATA":
+			reply("354 go ahead")
+			for {
+				data, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				data = strings.TrimRight(data, "\r\n")
+				if data == "." {
+					break
+				}
+				lines = append(lines, strings.TrimPrefix(data, "."))
+			}
+			reply("250 OK")
+		case line == "QUIT":
+			reply("221 bye")
+			received <- lines
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package metrics
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "go_chat_app"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests by method, route and status code.",
+	}, []string{"method", "route", "status"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latencies by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+
+	WebSocketConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Number of open WebSocket connections.",
+	})
+
+	MessagesReceived = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_received_total",
+		Help:      "Number of chat messages read from WebSocket clients.",
+	})
+
+	MessagesBroadcast = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_messages_broadcast_total",
+		Help:      "Number of chat messages queued for delivery to WebSocket clients.",
+	})
+
+	SendQueueDrops = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_send_queue_drops_total",
+		Help:      "Number of messages dropped because a client's send queue was full.",
+	})
+
+	FloodFrames = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_flood_frames_total",
+		Help:      "Number of WebSocket frames dropped for exceeding the rate limits, by the escalation they caused.",
+	}, []string{"verdict"})
+
+	ConnectionsRefused = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections_refused_total",
+		Help:      "Number of WebSocket connections closed because their user had too many open.",
+	})
+
+	MessagesPurged = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "retention_messages_purged_total",
+		Help:      "Number of messages deleted by retention policies, by policy.",
+	}, []string{"policy"})
+
+	MessagesFiltered = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "filter_messages_total",
+		Help:      "Number of chat messages a content filter modified, flagged or rejected, by filter and action.",
+	}, []string{"filter", "action"})
+
+	RepositoryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "repository_call_duration_seconds",
+		Help:      "Repository call latencies by function.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"function"})
+)
+
+// RegisterBroadcastQueue exposes the depth of the WebSocket broadcast queue.
+// It is read lazily on every scrape.
+func RegisterBroadcastQueue(depth func() int) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_broadcast_queue_depth",
+		Help:      "Number of messages waiting in the broadcast queue.",
+	}, func() float64 {
+		return float64(depth())
+	})
+}
+
+// ObserveRepository records the latency of a repository call. Use it as
+// `defer metrics.ObserveRepository("CreateUser", time.Now())`.
+func ObserveRepository(function string, start time.Time) {
+	RepositoryDuration.WithLabelValues(function).Observe(time.Since(start).Seconds())
+}
+
+func Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		start := time.Now()
+		err := ctx.Next()
+
+		status := ctx.Response().StatusCode()
+		if err != nil {
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			} else {
+				status = fiber.StatusInternalServerError
+			}
+		}
+
+		route := ctx.Route().Path
+		method := ctx.Method()
+		HTTPRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+		HTTPDuration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
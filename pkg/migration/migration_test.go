@@ -0,0 +1,204 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{TranslateError: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	m := New("sqlite", NewSQLStore(db), SQLMigrations(db))
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+	if len(applied) != len(SQLMigrations(db)) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(SQLMigrations(db)))
+	}
+	for _, table := range []string{"users", "user_sessions", "messages"} {
+		if !db.Migrator().HasTable(table) {
+			t.Errorf("table %s was not created", table)
+		}
+	}
+
+	if again, err := m.Up(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("second Up applied %d migrations, err %v", len(again), err)
+	}
+
+	reverted, err := m.Down(ctx, 1)
+	if err != nil {
+		t.Fatalf("Down: %v", err)
+	}
+	last := applied[len(applied)-1]
+	if len(reverted) != 1 || reverted[0].Version != last.Version {
+		t.Fatalf("Down reverted %+v, want version %d", reverted, last.Version)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	for _, s := range status {
+		pending := s.AppliedAt == nil
+		if pending != (s.Version == last.Version) {
+			t.Errorf("version %d pending = %v", s.Version, pending)
+		}
+	}
+}
+
+func TestUpAdoptsExistingTables(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&userV1{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := New("sqlite", NewSQLStore(db), SQLMigrations(db)).Up(ctx); err != nil {
+		t.Fatalf("Up on a database created by AutoMigrate: %v", err)
+	}
+}
+
+func TestHashTokens(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	if err := db.AutoMigrate(&userSessionV1{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&userSessionV1{UserId: 1, Token: "t", RefreshToken: "header.claims.signature"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	up := hashTokens(db, 7, "hash", "refresh_token").Up
+	for i := 0; i < 2; i++ {
+		if err := up(ctx); err != nil {
+			t.Fatalf("Up run %d: %v", i+1, err)
+		}
+	}
+
+	var session userSessionV1
+	if err := db.First(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("header.claims.signature"))
+	if want := hex.EncodeToString(sum[:]); session.RefreshToken != want {
+		t.Errorf("refresh_token = %q, want %q", session.RefreshToken, want)
+	}
+}
+
+func TestLockIsExclusive(t *testing.T) {
+	ctx := context.Background()
+	store := NewSQLStore(openTestDB(t))
+
+	unlock, err := store.Lock(ctx)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 2*lockPollInterval)
+	defer cancel()
+	if _, err := store.Lock(waitCtx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock returned %v, want ErrLocked", err)
+	}
+
+	unlock()
+	unlockAgain, err := store.Lock(ctx)
+	if err != nil {
+		t.Fatalf("Lock after unlock: %v", err)
+	}
+	unlockAgain()
+}
+
+func TestHeldLockIsRefreshed(t *testing.T) {
+	refresh, stale := lockRefreshInterval, staleLockAfter
+	lockRefreshInterval, staleLockAfter = 20*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { lockRefreshInterval, staleLockAfter = refresh, stale })
+
+	ctx := context.Background()
+	store := NewSQLStore(openTestDB(t))
+	unlock, err := store.Lock(ctx)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer unlock()
+
+	// The lock is older than staleLockAfter by now, but still held.
+	waitCtx, cancel := context.WithTimeout(ctx, 2*lockPollInterval)
+	defer cancel()
+	if _, err := store.Lock(waitCtx); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Lock returned %v, want ErrLocked", err)
+	}
+}
+
+func TestLockTimeoutBoundsOnlyTheWait(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	slow := func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(4 * lockPollInterval):
+			return nil
+		}
+	}
+	m := New("sqlite", NewSQLStore(db), []Migration{{Version: 1, Name: "slow", Up: slow}})
+	m.lockTimeout = lockPollInterval
+
+	applied, err := m.Up(ctx)
+	if err != nil || len(applied) != 1 {
+		t.Fatalf("Up = %v, %v, want the slow migration applied", applied, err)
+	}
+
+	unlock, err := NewSQLStore(db).Lock(ctx)
+	if err != nil {
+		t.Fatalf("Lock: %v", err)
+	}
+	defer unlock()
+	if _, err := m.Down(ctx, 1); !errors.Is(err, ErrLocked) {
+		t.Errorf("Down while locked returned %v, want ErrLocked", err)
+	}
+}
+
+func TestFailedMigrationStopsTheRun(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	boom := errors.New("boom")
+	ran := false
+
+	m := New("sqlite", NewSQLStore(db), []Migration{
+		{Version: 2, Name: "second", Up: func(context.Context) error { ran = true; return nil }},
+		{Version: 1, Name: "first", Up: func(context.Context) error { return boom }},
+	})
+
+	if _, err := m.Up(ctx); !errors.Is(err, boom) {
+		t.Fatalf("Up returned %v, want %v", err, boom)
+	}
+	if ran {
+		t.Error("a later migration ran after an earlier one failed")
+	}
+	status, _ := m.Status(ctx)
+	for _, s := range status {
+		if s.AppliedAt != nil {
+			t.Errorf("version %d recorded as applied at %v", s.Version, s.AppliedAt.Format(time.RFC3339))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+// DateIndex is the index on chat_history.date. It doubles as the TTL index
+// when retention is delegated to MongoDB.
+const DateIndex = "chat_history_date"
+
+// MongoMigrations returns the index history of the chat_history collection.
+func MongoMigrations(coll *mongo.Collection) []Migration {
+	return []Migration{
+		createIndex(coll, 1, "chat_history_room_date",
+			bson.D{{Key: "room", Value: 1}, {Key: "date", Value: -1}}),
+		createIndex(coll, 2, DateIndex,
+			bson.D{{Key: "date", Value: 1}}),
+	}
+}
+
+func createIndex(coll *mongo.Collection, version int64, name string, keys bson.D) Migration {
+	return Migration{
+		Version: version,
+		Name:    "create_index_" + name,
+		Up: func(ctx context.Context) error {
+			_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+				Keys:    keys,
+				Options: options.Index().SetName(name),
+			})
+			return err
+		},
+		Down: func(ctx context.Context) error {
+			return coll.Indexes().DropOne(ctx, name)
+		},
+	}
+}
+
+// SetMongoTTL makes DateIndex expire documents older than ttl, or turns
+// expiry off again when ttl is zero. It reports whether the index changed.
+// Converting a plain index into a TTL index needs MongoDB 5.1 or later.
+func SetMongoTTL(ctx context.Context, coll *mongo.Collection, ttl time.Duration) (bool, error) {
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return false, err
+	}
+	i := slices.IndexFunc(specs, func(spec mongo.IndexSpecification) bool { return spec.Name == DateIndex })
+	if i < 0 {
+		if ttl == 0 {
+			return false, nil
+		}
+		return false, fmt.Errorf("index %s does not exist, run the migrations first", DateIndex)
+	}
+
+	var current time.Duration
+	if specs[i].ExpireAfterSeconds != nil {
+		current = time.Duration(*specs[i].ExpireAfterSeconds) * time.Second
+	}
+	if current == ttl.Truncate(time.Second) {
+		return false, nil
+	}
+
+	if ttl > 0 {
+		err = coll.Database().RunCommand(ctx, bson.D{
+			{Key: "collMod", Value: coll.Name()},
+			{Key: "index", Value: bson.D{
+				{Key: "name", Value: DateIndex},
+				{Key: "expireAfterSeconds", Value: int64(ttl.Seconds())},
+			}},
+		}).Err()
+		return err == nil, err
+	}
+
+	// collMod cannot remove expireAfterSeconds, so the plain index is
+	// rebuilt instead.
+	if err := coll.Indexes().DropOne(ctx, DateIndex); err != nil {
+		return false, err
+	}
+	_, err = coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "date", Value: 1}},
+		Options: options.Index().SetName(DateIndex),
+	})
+	return err == nil, err
+}
@@ -0,0 +1,86 @@
+package migration
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+const mongoLockId = "lock"
+
+type mongoRecord struct {
+	Version   int64     `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+type mongoStore struct {
+	history *mongo.Collection
+	lock    *mongo.Collection
+}
+
+// NewMongoStore keeps migration history in the schema_migrations collection
+// of db, next to the collections it migrates.
+func NewMongoStore(db *mongo.Database) Store {
+	return &mongoStore{
+		history: db.Collection("schema_migrations"),
+		lock:    db.Collection("schema_migration_lock"),
+	}
+}
+
+func (s *mongoStore) Lock(ctx context.Context) (func(), error) {
+	for {
+		_, err := s.lock.InsertOne(ctx, bson.M{"_id": mongoLockId, "locked_at": time.Now()})
+		if err == nil {
+			stop := keepAlive(func(now time.Time) {
+				_, _ = s.lock.UpdateOne(context.Background(), bson.M{"_id": mongoLockId}, bson.M{"$set": bson.M{"locked_at": now}})
+			})
+			return func() {
+				stop()
+				_, _ = s.lock.DeleteOne(context.Background(), bson.M{"_id": mongoLockId})
+			}, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		_, _ = s.lock.DeleteOne(ctx, bson.M{"_id": mongoLockId, "locked_at": bson.M{"$lt": time.Now().Add(-staleLockAfter)}})
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrLocked
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+func (s *mongoStore) Applied(ctx context.Context) ([]Record, error) {
+	cursor, err := s.history.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []Record
+	for cursor.Next(ctx) {
+		var row mongoRecord
+		if err := cursor.Decode(&row); err != nil {
+			return nil, err
+		}
+		records = append(records, Record{Version: row.Version, Name: row.Name, AppliedAt: row.AppliedAt})
+	}
+	return records, cursor.Err()
+}
+
+func (s *mongoStore) Insert(ctx context.Context, record Record) error {
+	_, err := s.history.InsertOne(ctx, mongoRecord{Version: record.Version, Name: record.Name, AppliedAt: record.AppliedAt})
+	return err
+}
+
+func (s *mongoStore) Delete(ctx context.Context, version int64) error {
+	_, err := s.history.DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
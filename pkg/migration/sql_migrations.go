@@ -0,0 +1,289 @@
+package migration
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The structs below are frozen snapshots of the schema at the version that
+// introduced them. Never edit one after it has shipped; add a new migration
+// instead, so every database converges on the same schema.
+
+type userV1 struct {
+	Id        uint   `gorm:"primaryKey"`
+	Username  string `gorm:"unique;type:varchar(20)"`
+	Password  string `gorm:"type:varchar(255);"`
+	FullName  string `gorm:"type:varchar(100);"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (userV1) TableName() string { return "users" }
+
+type userSessionV1 struct {
+	Id                  uint `gorm:"primaryKey"`
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
+	UserId              uint   `gorm:"type:int"`
+	Token               string `gorm:"type:varchar(255)"`
+	RefreshToken        string `gorm:"type:varchar(255)"`
+	TokenExpired        time.Time
+	RefreshTokenExpired time.Time
+}
+
+func (userSessionV1) TableName() string { return "user_sessions" }
+
+type messageV1 struct {
+	Id      uint      `gorm:"primaryKey"`
+	Room    string    `gorm:"type:varchar(100);not null;default:'';index:idx_messages_room_date,priority:1"`
+	From    string    `gorm:"column:sender;type:varchar(20);not null"`
+	Message string    `gorm:"type:text;not null"`
+	Date    time.Time `gorm:"not null;index:idx_messages_room_date,priority:2;index:idx_messages_date"`
+}
+
+func (messageV1) TableName() string { return "messages" }
+
+type userV4 struct {
+	DisabledAt *time.Time
+}
+
+func (userV4) TableName() string { return "users" }
+
+type userSessionV5 struct {
+	IP         string `gorm:"type:varchar(45)"`
+	UserAgent  string `gorm:"type:varchar(255)"`
+	LastUsedAt time.Time
+}
+
+func (userSessionV5) TableName() string { return "user_sessions" }
+
+type rotatedRefreshTokenV6 struct {
+	Id        uint      `gorm:"primaryKey"`
+	SessionId uint      `gorm:"type:int;index"`
+	UserId    uint      `gorm:"type:int"`
+	TokenHash string    `gorm:"type:varchar(64);index"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+func (rotatedRefreshTokenV6) TableName() string { return "rotated_refresh_tokens" }
+
+type revokedTokenV8 struct {
+	Id        string    `gorm:"primaryKey;type:varchar(64)"`
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (revokedTokenV8) TableName() string { return "revoked_tokens" }
+
+type userV10 struct {
+	TwoFactorSecret    string `gorm:"type:varchar(64)"`
+	TwoFactorEnabledAt *time.Time
+	TwoFactorLastStep  int64 `gorm:"not null;default:0"`
+}
+
+func (userV10) TableName() string { return "users" }
+
+type recoveryCodeV11 struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"type:int;index"`
+	CodeHash  string `gorm:"type:varchar(64)"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (recoveryCodeV11) TableName() string { return "recovery_codes" }
+
+type externalIdentityV12 struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"type:int;index"`
+	Issuer    string `gorm:"type:varchar(255);uniqueIndex:idx_external_identities_subject"`
+	Subject   string `gorm:"type:varchar(255);uniqueIndex:idx_external_identities_subject"`
+	Email     string `gorm:"type:varchar(255)"`
+	CreatedAt time.Time
+}
+
+func (externalIdentityV12) TableName() string { return "external_identities" }
+
+type userV13 struct {
+	Email           *string `gorm:"type:varchar(255);uniqueIndex"`
+	EmailVerifiedAt *time.Time
+}
+
+func (userV13) TableName() string { return "users" }
+
+type accountTokenV15 struct {
+	Id        uint   `gorm:"primaryKey"`
+	UserId    uint   `gorm:"type:int;index"`
+	Purpose   string `gorm:"type:varchar(20)"`
+	TokenHash string `gorm:"type:varchar(64);uniqueIndex"`
+	Email     string `gorm:"type:varchar(255)"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+func (accountTokenV15) TableName() string { return "account_tokens" }
+
+type loginAttemptV16 struct {
+	Id            string    `gorm:"primaryKey;type:varchar(128)"`
+	Failures      int       `gorm:"not null;default:0"`
+	LastFailureAt time.Time `gorm:"index"`
+}
+
+func (loginAttemptV16) TableName() string { return "login_attempts" }
+
+type userV17 struct {
+	Role string `gorm:"type:varchar(20);not null;default:member"`
+}
+
+func (userV17) TableName() string { return "users" }
+
+type roomRoleV18 struct {
+	Id        uint   `gorm:"primaryKey"`
+	Room      string `gorm:"type:varchar(100);not null;default:'';uniqueIndex:idx_room_roles_user,priority:1"`
+	UserId    uint   `gorm:"type:int;uniqueIndex:idx_room_roles_user,priority:2;index"`
+	Role      string `gorm:"type:varchar(20)"`
+	CreatedAt time.Time
+}
+
+func (roomRoleV18) TableName() string { return "room_roles" }
+
+type sanctionV19 struct {
+	Id          uint       `gorm:"primaryKey"`
+	Room        string     `gorm:"type:varchar(100);not null;default:'';index:idx_sanctions_room_user,priority:1"`
+	UserId      uint       `gorm:"type:int;index:idx_sanctions_room_user,priority:2"`
+	Kind        string     `gorm:"type:varchar(10)"`
+	ModeratorId uint       `gorm:"type:int"`
+	Reason      string     `gorm:"type:varchar(255)"`
+	ExpiresAt   *time.Time `gorm:"index"`
+	LiftedAt    *time.Time
+	CreatedAt   time.Time
+}
+
+func (sanctionV19) TableName() string { return "sanctions" }
+
+// SQLMigrations returns the relational schema history. The first migrations
+// are no-ops on databases that were created by the former AutoMigrate.
+func SQLMigrations(db *gorm.DB) []Migration {
+	return []Migration{
+		createTable(db, 1, "create_users", &userV1{}),
+		createTable(db, 2, "create_user_sessions", &userSessionV1{}),
+		createTable(db, 3, "create_messages", &messageV1{}),
+		addColumn(db, 4, "add_users_disabled_at", &userV4{}, "DisabledAt"),
+		addColumn(db, 5, "add_user_sessions_client", &userSessionV5{}, "IP", "UserAgent", "LastUsedAt"),
+		createTable(db, 6, "create_rotated_refresh_tokens", &rotatedRefreshTokenV6{}),
+		hashTokens(db, 7, "hash_user_sessions_refresh_token", "refresh_token"),
+		createTable(db, 8, "create_revoked_tokens", &revokedTokenV8{}),
+		hashTokens(db, 9, "hash_user_sessions_token", "token"),
+		addColumn(db, 10, "add_users_two_factor", &userV10{}, "TwoFactorSecret", "TwoFactorEnabledAt", "TwoFactorLastStep"),
+		createTable(db, 11, "create_recovery_codes", &recoveryCodeV11{}),
+		createTable(db, 12, "create_external_identities", &externalIdentityV12{}),
+		addColumn(db, 13, "add_users_email", &userV13{}, "Email", "EmailVerifiedAt"),
+		addIndex(db, 14, "add_users_email_index", &userV13{}, "idx_users_email"),
+		createTable(db, 15, "create_account_tokens", &accountTokenV15{}),
+		createTable(db, 16, "create_login_attempts", &loginAttemptV16{}),
+		addColumn(db, 17, "add_users_role", &userV17{}, "Role"),
+		createTable(db, 18, "create_room_roles", &roomRoleV18{}),
+		createTable(db, 19, "create_sanctions", &sanctionV19{}),
+	}
+}
+
+func createTable(db *gorm.DB, version int64, name string, model interface{}) Migration {
+	return Migration{
+		Version: version,
+		Name:    name,
+		Up: func(ctx context.Context) error {
+			migrator := db.WithContext(ctx).Migrator()
+			if migrator.HasTable(model) {
+				return nil
+			}
+			return migrator.CreateTable(model)
+		},
+		Down: func(ctx context.Context) error {
+			return db.WithContext(ctx).Migrator().DropTable(model)
+		},
+	}
+}
+
+func addColumn(db *gorm.DB, version int64, name string, model interface{}, fields ...string) Migration {
+	return Migration{
+		Version: version,
+		Name:    name,
+		Up: func(ctx context.Context) error {
+			migrator := db.WithContext(ctx).Migrator()
+			for _, field := range fields {
+				if err := migrator.AddColumn(model, field); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(ctx context.Context) error {
+			migrator := db.WithContext(ctx).Migrator()
+			for i := len(fields) - 1; i >= 0; i-- {
+				if err := migrator.DropColumn(model, fields[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+func addIndex(db *gorm.DB, version int64, name string, model interface{}, index string) Migration {
+	return Migration{
+		Version: version,
+		Name:    name,
+		Up: func(ctx context.Context) error {
+			return db.WithContext(ctx).Migrator().CreateIndex(model, index)
+		},
+		Down: func(ctx context.Context) error {
+			return db.WithContext(ctx).Migrator().DropIndex(model, index)
+		},
+	}
+}
+
+// hashTokens replaces the plaintext tokens stored in a column of
+// user_sessions with their SHA-256. Hashed tokens contain no dot, which
+// makes the migration safe to rerun. A hash cannot be reversed, so Down
+// leaves them in place and the sessions have to log in again after a
+// downgrade.
+func hashTokens(db *gorm.DB, version int64, name, column string) Migration {
+	type session struct {
+		Id    uint
+		Token string
+	}
+	return Migration{
+		Version: version,
+		Name:    name,
+		Up: func(ctx context.Context) error {
+			var batch []session
+			return db.WithContext(ctx).Model(&userSessionV1{}).
+				Select("id", column+" AS token").
+				Where(column+" LIKE ?", "%.%").
+				FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+					for _, s := range batch {
+						if !strings.Contains(s.Token, ".") {
+							continue
+						}
+						sum := sha256.Sum256([]byte(s.Token))
+						err := db.WithContext(ctx).Model(&userSessionV1{}).
+							Where("id = ?", s.Id).
+							Update(column, hex.EncodeToString(sum[:])).Error
+						if err != nil {
+							return err
+						}
+					}
+					return nil
+				}).Error
+		},
+		Down: func(ctx context.Context) error {
+			return nil
+		},
+	}
+}
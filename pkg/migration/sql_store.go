@@ -0,0 +1,141 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const lockPollInterval = 500 * time.Millisecond
+
+var (
+	// lockRefreshInterval is how often the holder of a lock marks it alive
+	// while migrations run, however long they take.
+	lockRefreshInterval = 15 * time.Second
+	// staleLockAfter releases a lock left behind by a process that died
+	// while migrating: one that was not refreshed for several intervals.
+	staleLockAfter = 4 * lockRefreshInterval
+)
+
+// keepAlive calls refresh every lockRefreshInterval until the returned stop
+// is called. stop waits for a running refresh to finish.
+func keepAlive(refresh func(now time.Time)) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(lockRefreshInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				refresh(now)
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+type schemaMigration struct {
+	Version   int64  `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// schemaMigrationLock holds at most one row; its primary key makes inserting
+// that row an atomic test-and-set on every supported database.
+type schemaMigrationLock struct {
+	Id       int `gorm:"primaryKey;autoIncrement:false"`
+	LockedAt time.Time
+}
+
+func (schemaMigrationLock) TableName() string { return "schema_migration_lock" }
+
+type sqlStore struct {
+	db *gorm.DB
+}
+
+// NewSQLStore keeps migration history in the schema_migrations table.
+func NewSQLStore(db *gorm.DB) Store {
+	return &sqlStore{db: db}
+}
+
+func (s *sqlStore) ensureTables(ctx context.Context) error {
+	migrator := s.db.WithContext(ctx).Migrator()
+	for _, table := range []interface{}{&schemaMigration{}, &schemaMigrationLock{}} {
+		if migrator.HasTable(table) {
+			continue
+		}
+		if err := migrator.CreateTable(table); err != nil && !migrator.HasTable(table) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *sqlStore) Lock(ctx context.Context) (func(), error) {
+	if err := s.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+
+	for {
+		err := s.db.WithContext(ctx).Create(&schemaMigrationLock{Id: 1, LockedAt: time.Now()}).Error
+		if err == nil {
+			stop := keepAlive(func(now time.Time) {
+				s.db.Model(&schemaMigrationLock{}).Where("id = ?", 1).Update("locked_at", now)
+			})
+			return func() {
+				stop()
+				s.db.Where("id = ?", 1).Delete(&schemaMigrationLock{})
+			}, nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, err
+		}
+
+		s.db.WithContext(ctx).Where("id = ? AND locked_at < ?", 1, time.Now().Add(-staleLockAfter)).Delete(&schemaMigrationLock{})
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrLocked
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+func (s *sqlStore) Applied(ctx context.Context) ([]Record, error) {
+	if err := s.ensureTables(ctx); err != nil {
+		return nil, err
+	}
+
+	var rows []schemaMigration
+	if err := s.db.WithContext(ctx).Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(rows))
+	for _, row := range rows {
+		records = append(records, Record{Version: row.Version, Name: row.Name, AppliedAt: row.AppliedAt})
+	}
+	return records, nil
+}
+
+func (s *sqlStore) Insert(ctx context.Context, record Record) error {
+	return s.db.WithContext(ctx).Create(&schemaMigration{
+		Version:   record.Version,
+		Name:      record.Name,
+		AppliedAt: record.AppliedAt,
+	}).Error
+}
+
+func (s *sqlStore) Delete(ctx context.Context, version int64) error {
+	return s.db.WithContext(ctx).Where("version = ?", version).Delete(&schemaMigration{}).Error
+}
@@ -0,0 +1,210 @@
+// Package oidc signs users in through an OpenID Connect provider with the
+// authorization code flow and PKCE. The state of a flow in progress travels
+// in a signed cookie, so any instance can complete a flow another started.
+package oidc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/tracing"
+	"strings"
+	"sync"
+	"time"
+
+	gooidc "github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// FlowTimeout bounds how long the user may take at the provider.
+const FlowTimeout = 10 * time.Minute
+
+var (
+	ErrInvalidFlow  = errors.New("oidc: invalid or expired login flow")
+	ErrInvalidToken = errors.New("oidc: invalid id token")
+)
+
+// Identity is the verified account at the provider.
+type Identity struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// Provider talks to one OpenID Connect provider. Discovery happens on first
+// use and is retried until it succeeds, so a provider that is down when the
+// server starts only disables SSO until it is back.
+type Provider struct {
+	cfg    config.OIDCConfig
+	secret []byte
+	now    func() time.Time
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *gooidc.IDTokenVerifier
+}
+
+// New returns a Provider for cfg. secret signs the flow cookies.
+func New(cfg config.OIDCConfig, secret string) *Provider {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("oidc flow"))
+	return &Provider{cfg: cfg, secret: mac.Sum(nil), now: time.Now}
+}
+
+// Name is the provider's display name.
+func (p *Provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *Provider) discover(ctx context.Context) (*oauth2.Config, *gooidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.oauth == nil {
+		provider, err := gooidc.NewProvider(ctx, p.cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("oidc: discovery of %s failed: %w", p.cfg.Issuer, err)
+		}
+		p.oauth = &oauth2.Config{
+			ClientID:     p.cfg.ClientID,
+			ClientSecret: p.cfg.ClientSecret,
+			RedirectURL:  p.cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       p.cfg.Scopes,
+		}
+		p.verifier = provider.Verifier(&gooidc.Config{ClientID: p.cfg.ClientID, Now: p.now})
+	}
+	return p.oauth, p.verifier, nil
+}
+
+// flow is what the callback needs to finish a login: the state to compare,
+// the nonce the id token must carry and the PKCE verifier. Link names the
+// account the identity is linked to, if the flow links rather than logs in.
+type flow struct {
+	State    string    `json:"state"`
+	Nonce    string    `json:"nonce"`
+	Verifier string    `json:"verifier"`
+	Link     string    `json:"link,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+// Start begins a flow and returns the provider URL to send the browser to,
+// together with the cookie value that must come back with the callback.
+func (p *Provider) Start(ctx context.Context, link string) (authURL, cookie string, err error) {
+	span, spanCtx := tracing.StartSpan(ctx, "Start", "oidc")
+	defer span.End()
+
+	oauth, _, err := p.discover(spanCtx)
+	if err != nil {
+		return "", "", err
+	}
+	f := flow{
+		State:    rand.Text(),
+		Nonce:    rand.Text(),
+		Verifier: oauth2.GenerateVerifier(),
+		Link:     link,
+		Expires:  p.now().Add(FlowTimeout),
+	}
+	cookie, err = p.seal(f)
+	if err != nil {
+		return "", "", err
+	}
+	authURL = oauth.AuthCodeURL(f.State, gooidc.Nonce(f.Nonce), oauth2.S256ChallengeOption(f.Verifier))
+	return authURL, cookie, nil
+}
+
+// Finish exchanges the authorization code and verifies the id token. It
+// returns the identity and the account to link it to, if any.
+func (p *Provider) Finish(ctx context.Context, cookie, state, code string) (Identity, string, error) {
+	span, spanCtx := tracing.StartSpan(ctx, "Finish", "oidc")
+	defer span.End()
+
+	f, err := p.open(cookie)
+	if err != nil {
+		return Identity{}, "", err
+	}
+	if subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) != 1 {
+		return Identity{}, "", ErrInvalidFlow
+	}
+
+	oauth, verifier, err := p.discover(spanCtx)
+	if err != nil {
+		return Identity{}, "", err
+	}
+	token, err := oauth.Exchange(spanCtx, code, oauth2.VerifierOption(f.Verifier))
+	if err != nil {
+		return Identity{}, "", fmt.Errorf("oidc: code exchange failed: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, "", fmt.Errorf("%w: token response has no id_token", ErrInvalidToken)
+	}
+	idToken, err := verifier.Verify(spanCtx, raw)
+	if err != nil {
+		return Identity{}, "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(f.Nonce)) != 1 {
+		return Identity{}, "", fmt.Errorf("%w: nonce mismatch", ErrInvalidToken)
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     bool   `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return Identity{}, "", fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return Identity{
+		Issuer:            idToken.Issuer,
+		Subject:           idToken.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, f.Link, nil
+}
+
+// seal encodes f as payload.signature, both base64url.
+func (p *Provider) seal(f flow) (string, error) {
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(p.sign(encoded)), nil
+}
+
+func (p *Provider) open(cookie string) (flow, error) {
+	var f flow
+	encoded, signature, ok := strings.Cut(cookie, ".")
+	if !ok {
+		return f, ErrInvalidFlow
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, p.sign(encoded)) {
+		return f, ErrInvalidFlow
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(payload, &f) != nil || p.now().After(f.Expires) {
+		return f, ErrInvalidFlow
+	}
+	return f, nil
+}
+
+func (p *Provider) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
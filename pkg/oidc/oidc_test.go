@@ -0,0 +1,106 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"go-chat-app/pkg/config"
+	"go-chat-app/pkg/oidc/oidctest"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const redirectURL = "http://chat.example/auth"
+
+func newProvider(t *testing.T) (*Provider, *oidctest.Server) {
+	t.Helper()
+	server := oidctest.NewServer("chat", "s3cret")
+	t.Cleanup(server.Close)
+	server.SetUser(oidctest.Claims{Subject: "248289761001", Email: "alice@example.com", EmailVerified: true, Name: "Alice Liddell", PreferredUsername: "alice"})
+	return New(config.OIDCConfig{
+		Issuer:       server.URL,
+		ClientID:     "chat",
+		ClientSecret: "s3cret",
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "profile", "email"},
+	}, "0123456789abcdef0123"), server
+}
+
+// authorize follows the provider's redirect back to redirectURL and returns
+// the state and code it carries.
+func authorize(t *testing.T, authURL string) (state, code string) {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: status %d, location %q", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+func TestLogin(t *testing.T) {
+	ctx := context.Background()
+	provider, server := newProvider(t)
+
+	authURL, cookie, err := provider.Start(ctx, "alice01")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	state, code := authorize(t, authURL)
+
+	identity, link, err := provider.Finish(ctx, cookie, state, code)
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	want := Identity{Issuer: server.URL, Subject: "248289761001", Email: "alice@example.com", EmailVerified: true, Name: "Alice Liddell", PreferredUsername: "alice"}
+	if identity != want || link != "alice01" {
+		t.Errorf("Finish = %+v, %q", identity, link)
+	}
+
+	if _, _, err := provider.Finish(ctx, cookie, state, code); err == nil {
+		t.Error("authorization code was accepted twice")
+	}
+}
+
+func TestRejectsForgedFlows(t *testing.T) {
+	ctx := context.Background()
+	provider, _ := newProvider(t)
+
+	tests := map[string]func(cookie, state string) (string, string){
+		"wrong state": func(cookie, state string) (string, string) { return cookie, "forged" },
+		"tampered cookie": func(cookie, state string) (string, string) {
+			f, _ := provider.open(cookie)
+			f.Link = "mallory"
+			forged, _ := New(provider.cfg, "another secret 0123").seal(f)
+			return forged, state
+		},
+		"no cookie": func(cookie, state string) (string, string) { return "", state },
+	}
+	for name, forge := range tests {
+		authURL, cookie, err := provider.Start(ctx, "")
+		if err != nil {
+			t.Fatalf("Start: %v", err)
+		}
+		state, code := authorize(t, authURL)
+		cookie, state = forge(cookie, state)
+		if _, _, err := provider.Finish(ctx, cookie, state, code); !errors.Is(err, ErrInvalidFlow) {
+			t.Errorf("%s: expected ErrInvalidFlow, got %v", name, err)
+		}
+	}
+
+	authURL, cookie, err := provider.Start(ctx, "")
+	if err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+	state, code := authorize(t, authURL)
+	provider.now = func() time.Time { return time.Now().Add(FlowTimeout + time.Minute) }
+	if _, _, err := provider.Finish(ctx, cookie, state, code); !errors.Is(err, ErrInvalidFlow) {
+		t.Errorf("expired flow: expected ErrInvalidFlow, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package router
+
+import (
+	"go-chat-app/app/controllers"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/tracing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// AdminRouter installs the admin API. Every route requires the
+// system:administer permission, which only the global admin role holds.
+type AdminRouter struct {
+	admin      *controllers.AdminController
+	middleware *Middleware
+}
+
+func (a AdminRouter) InstallRouter(app *fiber.App) {
+	adminGroup := app.Group("/api/admin", tracing.Middleware(), a.middleware.AuthMiddleware, RequirePermission(models.PermissionAdminister))
+	adminV1 := adminGroup.Group("/v1")
+	adminV1.Get("/users", a.admin.ListUsers)
+	adminV1.Post("/users/:username/disable", a.admin.DisableUser)
+	adminV1.Post("/users/:username/enable", a.admin.EnableUser)
+	adminV1.Delete("/users/:username/sessions", a.admin.LogoutUser)
+	adminV1.Delete("/messages/:id", a.admin.DeleteMessage)
+	adminV1.Get("/stats", a.admin.Stats)
+}
+
+func NewAdminRouter(admin *controllers.AdminController, middleware *Middleware) *AdminRouter {
+	return &AdminRouter{admin: admin, middleware: middleware}
+}
@@ -2,14 +2,20 @@ package router
 
 import (
 	"go-chat-app/app/controllers"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/tracing"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"go.elastic.co/apm/module/apmfiber"
 )
 
 type ApiRouter struct {
+	users      *controllers.UserController
+	messages   *controllers.MessageController
+	oidc       *controllers.OIDCController
+	rooms      *controllers.RoomController
+	middleware *Middleware
 }
 
 func (a ApiRouter) InstallRouter(app *fiber.App) {
@@ -27,18 +33,52 @@ func (a ApiRouter) InstallRouter(app *fiber.App) {
 	})
 
 	userGroup := api.Group("/user")
-	userGroup.Use(apmfiber.Middleware())
+	userGroup.Use(tracing.Middleware())
 	userV1 := userGroup.Group("/v1")
-	userV1.Post("/register", controllers.RegisterUser)
-	userV1.Post("/login", controllers.LoginUser)
-	userV1.Delete("/logout", AuthMiddleware, controllers.LogoutUser)
-	userV1.Put("/refresh-token", MiddlewareRefreshToken, controllers.RefreshToken)
+	userV1.Post("/register", a.users.RegisterUser)
+	userV1.Post("/login", a.users.LoginUser)
+	userV1.Post("/login/2fa", a.users.LoginTwoFactor)
+	userV1.Post("/password/forgot", a.users.RequestPasswordReset)
+	userV1.Post("/password/reset", a.users.ResetPassword)
+	userV1.Put("/email", a.middleware.AuthMiddleware, a.users.UpdateEmail)
+	userV1.Post("/email/verification", a.middleware.AuthMiddleware, a.users.RequestEmailVerification)
+	userV1.Post("/email/verify", a.users.VerifyEmail)
+	userV1.Delete("/logout", a.middleware.AuthMiddleware, a.users.LogoutUser)
+	userV1.Put("/refresh-token", a.middleware.MiddlewareRefreshToken, a.users.RefreshToken)
+	userV1.Get("/sessions", a.middleware.AuthMiddleware, a.users.ListSessions)
+	userV1.Delete("/sessions", a.middleware.AuthMiddleware, a.users.RevokeAllSessions)
+	userV1.Delete("/sessions/:id", a.middleware.AuthMiddleware, a.users.RevokeSession)
+	userV1.Post("/2fa/enroll", a.middleware.AuthMiddleware, a.users.EnrollTwoFactor)
+	userV1.Get("/2fa/qr", a.middleware.AuthMiddleware, a.users.TwoFactorQRCode)
+	userV1.Post("/2fa/confirm", a.middleware.AuthMiddleware, a.users.ConfirmTwoFactor)
+	userV1.Delete("/2fa", a.middleware.AuthMiddleware, a.users.DisableTwoFactor)
+	userV1.Get("/oidc", a.oidc.Provider)
+	if a.oidc.Enabled() {
+		userV1.Get("/oidc/login", a.oidc.Login)
+		userV1.Post("/oidc/link", a.middleware.AuthMiddleware, a.oidc.Link)
+		userV1.Get("/oidc/callback", a.oidc.Callback)
+	}
 
 	messageGroup := api.Group("/message")
-	messageGroup.Use(apmfiber.Middleware())
+	messageGroup.Use(tracing.Middleware())
 	messageV1 := messageGroup.Group("/v1")
-	messageV1.Get("/history", AuthMiddleware, controllers.GetMessagesHistory)
+	messageV1.Get("/history", a.middleware.AuthMiddleware, a.messages.GetMessagesHistory)
+
+	roomGroup := api.Group("/room")
+	roomGroup.Use(tracing.Middleware())
+	roomV1 := roomGroup.Group("/v1")
+	roomV1.Get("/roles", a.middleware.AuthMiddleware, a.rooms.ListRoles)
+	roomV1.Put("/roles/:username", a.middleware.AuthMiddleware, RequirePermission(models.PermissionManageRoles), a.rooms.GrantRole)
+	roomV1.Delete("/roles/:username", a.middleware.AuthMiddleware, RequirePermission(models.PermissionManageRoles), a.rooms.RevokeRole)
+	roomV1.Get("/sanctions", a.middleware.AuthMiddleware, RequirePermission(models.PermissionModerate), a.rooms.ListSanctions)
+	roomV1.Put("/mutes/:username", a.middleware.AuthMiddleware, RequirePermission(models.PermissionModerate), a.rooms.Mute)
+	roomV1.Delete("/mutes/:username", a.middleware.AuthMiddleware, RequirePermission(models.PermissionModerate), a.rooms.Unmute)
+	roomV1.Post("/kicks/:username", a.middleware.AuthMiddleware, RequirePermission(models.PermissionModerate), a.rooms.Kick)
+	roomV1.Put("/bans/:username", a.middleware.AuthMiddleware, RequirePermission(models.PermissionModerate), a.rooms.Ban)
+	roomV1.Delete("/bans/:username", a.middleware.AuthMiddleware, RequirePermission(models.PermissionModerate), a.rooms.Unban)
+	roomV1.Delete("/messages/:id", a.middleware.AuthMiddleware, RequirePermission(models.PermissionDeleteMessage), a.rooms.DeleteMessage)
 }
-func NewApiRouter() *ApiRouter {
-	return &ApiRouter{}
+func NewApiRouter(users *controllers.UserController, messages *controllers.MessageController, oidc *controllers.OIDCController,
+	rooms *controllers.RoomController, middleware *Middleware) *ApiRouter {
+	return &ApiRouter{users: users, messages: messages, oidc: oidc, rooms: rooms, middleware: middleware}
 }
@@ -0,0 +1,19 @@
+package router
+
+import (
+	"go-chat-app/app/controllers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type HealthRouter struct {
+}
+
+func (h HealthRouter) InstallRouter(app *fiber.App) {
+	app.Get("/healthz", controllers.Liveness)
+	app.Get("/readyz", controllers.Readiness)
+}
+
+func NewHealthRouter() *HealthRouter {
+	return &HealthRouter{}
+}
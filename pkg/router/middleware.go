@@ -1,24 +1,41 @@
 package router
 
 import (
+	"context"
+	"errors"
+	"go-chat-app/app/controllers"
+	"go-chat-app/app/models"
 	"go-chat-app/app/repositories"
 	"go-chat-app/pkg/jwt"
+	"go-chat-app/pkg/logger"
 	"go-chat-app/pkg/response"
-	"log"
+	"go-chat-app/pkg/tracing"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/gofiber/contrib/websocket"
 	"github.com/gofiber/fiber/v2"
-	"go.elastic.co/apm"
 )
 
-func AuthMiddleware(ctx *fiber.Ctx) error {
+type Middleware struct {
+	sessions    repositories.SessionRepository
+	revocations repositories.RevocationRepository
+	sockets     controllers.SessionCloser
+}
+
+func NewMiddleware(sessions repositories.SessionRepository, revocations repositories.RevocationRepository, sockets controllers.SessionCloser) *Middleware {
+	return &Middleware{sessions: sessions, revocations: revocations, sockets: sockets}
+}
+
+func (m *Middleware) AuthMiddleware(ctx *fiber.Ctx) error {
 
-	span, spanCtx := apm.StartSpan(ctx.Context(), "AuthMiddleware", "middleware")
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "AuthMiddleware", "middleware")
 	defer span.End()
 
 	authHeader := ctx.Get("Authorization")
 	if authHeader == "" {
-		log.Println("No auth token")
+		slog.WarnContext(spanCtx, "no auth token")
 		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
 	}
 
@@ -30,30 +47,123 @@ func AuthMiddleware(ctx *fiber.Ctx) error {
 		auth = authHeader
 	}
 
-	_, err := repositories.GetUserSession(spanCtx, auth)
+	if !m.authenticate(spanCtx, ctx, auth) {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+	}
+	return ctx.Next()
+}
+
+// WebSocketAuth authenticates a WebSocket upgrade. Browsers cannot set
+// headers on a WebSocket, so the access token may also be passed in the
+// token query parameter.
+func (m *Middleware) WebSocketAuth(ctx *fiber.Ctx) error {
+
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "WebSocketAuth", "middleware")
+	defer span.End()
+
+	if !websocket.IsWebSocketUpgrade(ctx) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	auth := ctx.Query("token")
+	if auth == "" {
+		auth = strings.TrimPrefix(ctx.Get("Authorization"), "Bearer ")
+	}
+	if auth == "" {
+		slog.WarnContext(spanCtx, "no auth token")
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+	}
+
+	if !m.authenticate(spanCtx, ctx, auth) {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+	}
+
+	// The connection is bound to its session so that revoking the session
+	// closes it.
+	claims := ctx.Locals(controllers.ClaimsKey).(*jwt.ClaimToken)
+	session, err := m.sessions.GetUserSession(spanCtx, claims.ID)
 	if err != nil {
-		log.Println("failed to get user session", err)
+		slog.WarnContext(spanCtx, "failed to get user session", "error", err)
 		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
 	}
+	ctx.Locals(controllers.SessionKey, session)
+	return ctx.Next()
+}
+
+// RequireRole admits only callers whose global role is at least role. It
+// must follow AuthMiddleware.
+func RequireRole(role models.Role) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		claims := ctx.Locals(controllers.ClaimsKey).(*jwt.ClaimToken)
+		if !models.Role(claims.Role).AtLeast(role) {
+			slog.WarnContext(ctx.UserContext(), "role required", "username", claims.Username, "role", role)
+			return response.SendFailureResponse(ctx, fiber.StatusForbidden, "Forbidden", nil)
+		}
+		return ctx.Next()
+	}
+}
+
+// RequirePermission admits only callers who hold permission in the room
+// named by the room query parameter, through their global role or their role
+// in that room. It must follow AuthMiddleware.
+func RequirePermission(permission models.Permission) fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		claims := ctx.Locals(controllers.ClaimsKey).(*jwt.ClaimToken)
+		room := ctx.Query("room")
+		if !controllers.RoleIn(claims, room).Can(permission) {
+			slog.WarnContext(ctx.UserContext(), "permission required", "username", claims.Username,
+				"room", room, "permission", permission)
+			return response.SendFailureResponse(ctx, fiber.StatusForbidden, "Forbidden", nil)
+		}
+		return ctx.Next()
+	}
+}
 
+// authenticate checks the signature and expiry of an access token and that
+// it was not revoked, without loading its session, and stores the claims on
+// ctx.
+func (m *Middleware) authenticate(spanCtx context.Context, ctx *fiber.Ctx, auth string) bool {
 	claims, err := jwt.ValidateToken(spanCtx, auth)
 	if err != nil {
-		log.Println("Invalid token")
-		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+		slog.WarnContext(spanCtx, "invalid token", "error", err)
+		return false
 	}
 
 	if time.Now().Unix() > claims.ExpiresAt.Unix() {
-		log.Println("Token expired", claims.ExpiresAt)
-		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Unauthorized", nil)
+		slog.WarnContext(spanCtx, "token expired", "expired_at", claims.ExpiresAt.Time)
+		return false
+	}
+
+	if claims.TokenType != "access" || claims.ID == "" {
+		slog.WarnContext(spanCtx, "not an access token", "token_type", claims.TokenType)
+		return false
+	}
+
+	revoked, err := m.revocations.IsTokenRevoked(spanCtx, claims.ID)
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to check token revocation", "error", err)
+		return false
+	}
+	if revoked {
+		slog.WarnContext(spanCtx, "token revoked", "jti", claims.ID)
+		return false
+	}
+
+	ctx.Locals(controllers.ClaimsKey, claims)
+	return true
+}
+
+// touch records the use of a session. Access tokens are checked without the
+// session, so a session counts as used whenever its tokens are refreshed.
+func (m *Middleware) touch(ctx context.Context, session models.UserSession) {
+	if err := m.sessions.TouchUserSession(ctx, session.Id, time.Now()); err != nil {
+		slog.WarnContext(ctx, "failed to record session use", "error", err)
 	}
-	ctx.Set("username", claims.Username)
-	ctx.Set("full_name", claims.FullName)
-	return ctx.Next()
 }
 
-func MiddlewareRefreshToken(ctx *fiber.Ctx) error {
+func (m *Middleware) MiddlewareRefreshToken(ctx *fiber.Ctx) error {
 
-	span, spanCtx := apm.StartSpan(ctx.Context(), "MiddlewareRefreshToken", "middleware")
+	span, spanCtx := tracing.StartSpan(ctx.UserContext(), "MiddlewareRefreshToken", "middleware")
 	defer span.End()
 
 	authHeader := ctx.Get("Authorization")
@@ -69,7 +179,11 @@ func MiddlewareRefreshToken(ctx *fiber.Ctx) error {
 	}
 
 	// Validate refresh token exists in a database
-	session, err := repositories.GetUserSessionByRefreshToken(spanCtx, auth)
+	hash := jwt.HashToken(auth)
+	session, err := m.sessions.GetUserSessionByRefreshToken(spanCtx, hash)
+	if errors.Is(err, repositories.ErrNotFound) {
+		m.revokeReusedToken(spanCtx, ctx, hash)
+	}
 	if err != nil {
 		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid refresh token", nil)
 	}
@@ -79,14 +193,51 @@ func MiddlewareRefreshToken(ctx *fiber.Ctx) error {
 		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Refresh token expired", nil)
 	}
 
+	m.touch(spanCtx, session)
+
 	// Validate JWT structure (but allow expired tokens)
 	claims, err := jwt.ValidateToken(spanCtx, auth)
 	if err != nil {
 		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid token format", nil)
 	}
+	// Refresh tokens issued before token types were introduced carry none.
+	if claims.TokenType != "" && claims.TokenType != "refresh" {
+		return response.SendFailureResponse(ctx, fiber.StatusUnauthorized, "Invalid refresh token", nil)
+	}
 
-	ctx.Set("username", claims.Username)
-	ctx.Set("full_name", claims.FullName)
-	ctx.Set("refresh_token", auth)
+	ctx.Locals(controllers.SessionKey, session)
+	ctx.Locals(controllers.ClaimsKey, claims)
 	return ctx.Next()
 }
+
+// revokeReusedToken revokes the token family of a refresh token that was
+// already rotated. Only a copy of the token can be presented after
+// rotation, so the legitimate client and the thief are logged out alike.
+func (m *Middleware) revokeReusedToken(spanCtx context.Context, ctx *fiber.Ctx, hash string) {
+	rotated, err := m.sessions.GetRotatedRefreshToken(spanCtx, hash)
+	if errors.Is(err, repositories.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(spanCtx, "failed to check refresh token reuse", "error", err)
+		return
+	}
+
+	err = m.sessions.DeleteUserSessionById(spanCtx, rotated.SessionId)
+	if errors.Is(err, repositories.ErrNotFound) {
+		err = nil
+	}
+	m.sockets.CloseSessions(rotated.SessionId)
+
+	args := []any{
+		"user_id", rotated.UserId,
+		"session_id", rotated.SessionId,
+		"rotated_at", rotated.CreatedAt,
+		"ip", ctx.IP(),
+		"user_agent", ctx.Get(fiber.HeaderUserAgent),
+	}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+	logger.Audit(spanCtx, "refresh token reuse detected", args...)
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"go-chat-app/app/controllers"
+	"go-chat-app/app/models"
+	"go-chat-app/pkg/jwt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// guarded serves / behind guard for a caller holding roles, in place of
+// AuthMiddleware, and returns the status of a GET of target.
+func guarded(t *testing.T, guard fiber.Handler, roles jwt.Roles, target string) int {
+	t.Helper()
+	app := fiber.New()
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		ctx.Locals(controllers.ClaimsKey, &jwt.ClaimToken{Username: "alice01", Roles: roles})
+		return ctx.Next()
+	}, guard, func(ctx *fiber.Ctx) error {
+		return ctx.SendStatus(fiber.StatusNoContent)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(fiber.MethodGet, target, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestRequireRole(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles jwt.Roles
+		want  int
+	}{
+		{"admin", jwt.Roles{Role: "admin"}, fiber.StatusNoContent},
+		{"member", jwt.Roles{}, fiber.StatusForbidden},
+		{"moderator", jwt.Roles{Role: "moderator"}, fiber.StatusForbidden},
+		// Room roles do not count towards the global role.
+		{"owner of a room", jwt.Roles{Rooms: map[string]string{"": "owner"}}, fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := guarded(t, RequireRole(models.RoleAdmin), tt.roles, "/"); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	moderator := jwt.Roles{Rooms: map[string]string{"ops": "moderator"}}
+	tests := []struct {
+		name   string
+		roles  jwt.Roles
+		target string
+		want   int
+	}{
+		{"room role in its room", moderator, "/?room=ops", fiber.StatusNoContent},
+		{"room role in another room", moderator, "/?room=dev", fiber.StatusForbidden},
+		{"room role without a room", moderator, "/", fiber.StatusForbidden},
+		{"role in the default room", jwt.Roles{Rooms: map[string]string{"": "moderator"}}, "/", fiber.StatusNoContent},
+		{"global role", jwt.Roles{Role: "moderator"}, "/?room=dev", fiber.StatusNoContent},
+		{"member", jwt.Roles{}, "/?room=ops", fiber.StatusForbidden},
+	}
+	for _, tt := range tests {
+		if got := guarded(t, RequirePermission(models.PermissionModerate), tt.roles, tt.target); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPermissionsOfRoutes(t *testing.T) {
+	owner := jwt.Roles{Rooms: map[string]string{"ops": "owner"}}
+	tests := []struct {
+		name       string
+		permission models.Permission
+		roles      jwt.Roles
+		target     string
+		want       int
+	}{
+		{"moderator deletes messages in their room", models.PermissionDeleteMessage, jwt.Roles{Rooms: map[string]string{"ops": "moderator"}}, "/?room=ops", fiber.StatusNoContent},
+		{"member deletes messages", models.PermissionDeleteMessage, jwt.Roles{}, "/?room=ops", fiber.StatusForbidden},
+		{"member sends", models.PermissionSendMessage, jwt.Roles{}, "/?room=ops", fiber.StatusNoContent},
+		// No room role reaches the admin API.
+		{"room owner administers", models.PermissionAdminister, owner, "/?room=ops", fiber.StatusForbidden},
+		{"admin administers", models.PermissionAdminister, jwt.Roles{Role: "admin"}, "/", fiber.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := guarded(t, RequirePermission(tt.permission), tt.roles, tt.target); got != tt.want {
+			t.Errorf("%s: status = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,9 +1,47 @@
 package router
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"go-chat-app/app/controllers"
+	"go-chat-app/app/lockout"
+	"go-chat-app/app/repositories"
+	"go-chat-app/pkg/oidc"
 
-func InstallRouter(app *fiber.App) {
-	setup(app, NewApiRouter(), NewHttpRouter())
+	"github.com/gofiber/fiber/v2"
+)
+
+// Dependencies are the services the routes are built on.
+type Dependencies struct {
+	Repos   repositories.Repositories
+	Sockets controllers.SocketHub
+	// OIDC is nil when single sign-on is not configured.
+	OIDC           *oidc.Provider
+	OIDCAutoCreate bool
+	Mail           controllers.AccountMail
+	Lockout        *lockout.Guard
+}
+
+// InstallRouter installs every route.
+func InstallRouter(app *fiber.App, deps Dependencies) {
+	repos := deps.Repos
+	users := controllers.NewUserController(repos.Users, repos.AccountTokens, repos.RoomRoles, repos.Sessions, repos.Revocations,
+		deps.Sockets, deps.Mail, deps.Lockout)
+	middleware := NewMiddleware(repos.Sessions, repos.Revocations, deps.Sockets)
+	setup(app,
+		NewHealthRouter(),
+		NewWellKnownRouter(),
+		NewApiRouter(
+			users,
+			controllers.NewMessageController(repos.Messages, repos.Users, repos.Sanctions),
+			controllers.NewOIDCController(deps.OIDC, deps.OIDCAutoCreate, users),
+			controllers.NewRoomController(repos.Users, repos.RoomRoles, repos.Sanctions, repos.Messages, deps.Sockets),
+			middleware,
+		),
+		NewAdminRouter(
+			controllers.NewAdminController(repos.Users, repos.Sessions, repos.Messages, deps.Sockets),
+			middleware,
+		),
+		NewHttpRouter(),
+	)
 }
 func setup(app *fiber.App, router ...Router) {
 	for _, r := range router {
@@ -0,0 +1,20 @@
+package router
+
+import (
+	"go-chat-app/app/controllers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// WellKnownRouter serves the RFC 8615 well-known URIs other services discover
+// the chat server through.
+type WellKnownRouter struct {
+}
+
+func (w WellKnownRouter) InstallRouter(app *fiber.App) {
+	app.Get("/.well-known/jwks.json", controllers.JWKS)
+}
+
+func NewWellKnownRouter() *WellKnownRouter {
+	return &WellKnownRouter{}
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+var ErrNotExist = errors.New("blob does not exist")
+
+// Blob is a flat object store addressed by slash-separated keys. Put must be
+// atomic: readers see either the previous object or the complete new one.
+// An object store such as S3 fits behind the same interface.
+type Blob interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	// Get returns ErrNotExist for an unknown key.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes an object. Deleting an unknown key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// validKey rejects keys that could escape the store's root.
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("storage: invalid key %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestBlobs(t *testing.T) {
+	backends := map[string]func(t *testing.T) Blob{
+		"File":   func(t *testing.T) Blob { return NewFileBlob(t.TempDir()) },
+		"Memory": func(t *testing.T) Blob { return NewMemoryBlob() },
+	}
+	for name, newBlob := range backends {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			blob := newBlob(t)
+
+			if _, err := blob.Get(ctx, "chunks/a.gz"); !errors.Is(err, ErrNotExist) {
+				t.Errorf("Get of a missing key returned %v, want ErrNotExist", err)
+			}
+
+			for _, content := range []string{"first", "second"} {
+				if err := blob.Put(ctx, "chunks/a.gz", strings.NewReader(content)); err != nil {
+					t.Fatalf("Put: %v", err)
+				}
+				r, err := blob.Get(ctx, "chunks/a.gz")
+				if err != nil {
+					t.Fatalf("Get: %v", err)
+				}
+				data, _ := io.ReadAll(r)
+				r.Close()
+				if string(data) != content {
+					t.Errorf("Get = %q, want %q", data, content)
+				}
+			}
+
+			for range 2 {
+				if err := blob.Delete(ctx, "chunks/a.gz"); err != nil {
+					t.Fatalf("Delete: %v", err)
+				}
+			}
+			if _, err := blob.Get(ctx, "chunks/a.gz"); !errors.Is(err, ErrNotExist) {
+				t.Errorf("Get after Delete returned %v, want ErrNotExist", err)
+			}
+
+			for _, key := range []string{"", "/etc/passwd", "../x", "a/../../x"} {
+				if err := blob.Put(ctx, key, strings.NewReader("x")); err == nil {
+					t.Errorf("Put accepted key %q", key)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+
+	"go.elastic.co/apm"
+	"go.elastic.co/apm/module/apmhttp"
+)
+
+const (
+	traceparentHeader = "traceparent"
+	tracestateHeader  = "tracestate"
+)
+
+type remoteParentKey struct{}
+
+type apmTracer struct {
+	tracer *apm.Tracer
+}
+
+// NewApmTracer wraps an Elastic APM tracer, falling back to apm.DefaultTracer.
+func NewApmTracer(t *apm.Tracer) Tracer {
+	if t == nil {
+		t = apm.DefaultTracer
+	}
+	return apmTracer{tracer: t}
+}
+
+func setApmServiceName(name string) {
+	if name != "" {
+		apm.DefaultTracer.Service.Name = name
+	}
+}
+
+func (a apmTracer) StartTransaction(ctx context.Context, name, kind string) (Span, context.Context) {
+	opts := apm.TransactionOptions{}
+	if parent, ok := ctx.Value(remoteParentKey{}).(apm.TraceContext); ok {
+		opts.TraceContext = parent
+	}
+	tx := a.tracer.StartTransactionOptions(name, kind, opts)
+	return apmTransaction{tx}, apm.ContextWithTransaction(ctx, tx)
+}
+
+func (a apmTracer) StartSpan(ctx context.Context, name, kind string) (Span, context.Context) {
+	span, spanCtx := apm.StartSpan(ctx, name, kind)
+	return apmSpan{span}, spanCtx
+}
+
+func (a apmTracer) Inject(ctx context.Context, carrier Carrier) {
+	if span := apm.SpanFromContext(ctx); span != nil {
+		carrier[traceparentHeader] = apmhttp.FormatTraceparentHeader(span.TraceContext())
+		return
+	}
+	if tx := apm.TransactionFromContext(ctx); tx != nil {
+		carrier[traceparentHeader] = apmhttp.FormatTraceparentHeader(tx.TraceContext())
+	}
+}
+
+func (a apmTracer) Extract(ctx context.Context, carrier Carrier) context.Context {
+	parent, err := apmhttp.ParseTraceparentHeader(carrier[traceparentHeader])
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteParentKey{}, parent)
+}
+
+func (a apmTracer) Shutdown(ctx context.Context) error {
+	a.tracer.Flush(ctx.Done())
+	return nil
+}
+
+type apmTransaction struct {
+	tx *apm.Transaction
+}
+
+func (t apmTransaction) End()                { t.tx.End() }
+func (t apmTransaction) SetName(name string) { t.tx.Name = name }
+
+func (t apmTransaction) SetAttribute(key, value string) {
+	t.tx.Context.SetLabel(key, value)
+}
+
+func (t apmTransaction) RecordError(err error) {
+	if err != nil {
+		t.tx.Outcome = "failure"
+	}
+}
+
+type apmSpan struct {
+	span *apm.Span
+}
+
+func (s apmSpan) End()                { s.span.End() }
+func (s apmSpan) SetName(name string) { s.span.Name = name }
+
+func (s apmSpan) SetAttribute(key, value string) {
+	s.span.Context.SetLabel(key, value)
+}
+
+func (s apmSpan) RecordError(err error) {
+	if err != nil {
+		s.span.Outcome = "failure"
+	}
+}
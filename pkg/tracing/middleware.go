@@ -0,0 +1,36 @@
+package tracing
+
+import (
+	"go-chat-app/pkg/logger"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Middleware starts a transaction for every request and stores it in the
+// request's user context, so handlers should start spans from
+// ctx.UserContext().
+func Middleware() fiber.Handler {
+	return func(ctx *fiber.Ctx) error {
+		carrier := Carrier{}
+		for _, key := range []string{traceparentHeader, tracestateHeader} {
+			if value := ctx.Get(key); value != "" {
+				carrier[key] = value
+			}
+		}
+
+		span, spanCtx := StartTransaction(Extract(ctx.UserContext(), carrier), ctx.Method()+" "+ctx.Path(), "request")
+		defer span.End()
+		if id := logger.RequestID(spanCtx); id != "" {
+			span.SetAttribute("request_id", id)
+		}
+		ctx.SetUserContext(spanCtx)
+
+		err := ctx.Next()
+
+		span.SetName(ctx.Method() + " " + ctx.Route().Path)
+		span.SetAttribute("http.status_code", strconv.Itoa(ctx.Response().StatusCode()))
+		span.RecordError(err)
+		return err
+	}
+}
@@ -0,0 +1,104 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "go-chat-app"
+
+type otelTracer struct {
+	tracer     trace.Tracer
+	provider   trace.TracerProvider
+	propagator propagation.TextMapPropagator
+}
+
+// NewOtelTracer wraps an OpenTelemetry tracer provider.
+func NewOtelTracer(provider trace.TracerProvider) Tracer {
+	return otelTracer{
+		tracer:     provider.Tracer(instrumentationName),
+		provider:   provider,
+		propagator: propagation.TraceContext{},
+	}
+}
+
+// NewOtlpTracer exports spans over OTLP/HTTP. The endpoint and headers are
+// read from the standard OTEL_EXPORTER_OTLP_* environment variables.
+func NewOtlpTracer(ctx context.Context, serviceName string) (Tracer, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return NewOtelTracer(provider), nil
+}
+
+func (o otelTracer) StartTransaction(ctx context.Context, name, kind string) (Span, context.Context) {
+	spanCtx, span := o.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attribute.String("span.type", kind)))
+	return otelSpan{span}, spanCtx
+}
+
+func (o otelTracer) StartSpan(ctx context.Context, name, kind string) (Span, context.Context) {
+	spanCtx, span := o.tracer.Start(ctx, name,
+		trace.WithAttributes(attribute.String("span.type", kind)))
+	return otelSpan{span}, spanCtx
+}
+
+func (o otelTracer) Inject(ctx context.Context, carrier Carrier) {
+	o.propagator.Inject(ctx, propagation.MapCarrier(carrier))
+}
+
+func (o otelTracer) Extract(ctx context.Context, carrier Carrier) context.Context {
+	return o.propagator.Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+func (o otelTracer) Shutdown(ctx context.Context) error {
+	if p, ok := o.provider.(interface{ Shutdown(context.Context) error }); ok {
+		return p.Shutdown(ctx)
+	}
+	return nil
+}
+
+type otelSpan struct {
+	span trace.Span
+}
+
+func (s otelSpan) End()                { s.span.End() }
+func (s otelSpan) SetName(name string) { s.span.SetName(name) }
+
+func (s otelSpan) SetAttribute(key, value string) {
+	s.span.SetAttributes(attribute.String(key, value))
+}
+
+func (s otelSpan) RecordError(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+	}
+}
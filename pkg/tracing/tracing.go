@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+)
+
+const (
+	BackendApm  = "apm"
+	BackendOtel = "otel"
+)
+
+// Carrier holds serialized trace context so it can travel with a message
+// across goroutines, WebSocket writes or a broker hop.
+type Carrier map[string]string
+
+type Span interface {
+	End()
+	SetName(name string)
+	SetAttribute(key, value string)
+	RecordError(err error)
+}
+
+type Tracer interface {
+	// StartTransaction starts a root unit of work, e.g. an HTTP request or a
+	// WebSocket message. It continues a remote trace restored by Extract.
+	StartTransaction(ctx context.Context, name, kind string) (Span, context.Context)
+	StartSpan(ctx context.Context, name, kind string) (Span, context.Context)
+	Inject(ctx context.Context, carrier Carrier)
+	Extract(ctx context.Context, carrier Carrier) context.Context
+	Shutdown(ctx context.Context) error
+}
+
+var tracer Tracer = NewApmTracer(nil)
+
+// Setup selects the tracing backend for the whole process.
+func Setup(backend, serviceName string) error {
+	switch backend {
+	case "", BackendApm:
+		SetTracer(NewApmTracer(nil))
+		setApmServiceName(serviceName)
+	case BackendOtel:
+		t, err := NewOtlpTracer(context.Background(), serviceName)
+		if err != nil {
+			return err
+		}
+		SetTracer(t)
+	default:
+		return fmt.Errorf("unknown tracing backend %q", backend)
+	}
+	return nil
+}
+
+func SetTracer(t Tracer) {
+	tracer = t
+}
+
+func StartTransaction(ctx context.Context, name, kind string) (Span, context.Context) {
+	return tracer.StartTransaction(ctx, name, kind)
+}
+
+func StartSpan(ctx context.Context, name, kind string) (Span, context.Context) {
+	return tracer.StartSpan(ctx, name, kind)
+}
+
+func Inject(ctx context.Context) Carrier {
+	carrier := Carrier{}
+	tracer.Inject(ctx, carrier)
+	return carrier
+}
+
+func Extract(ctx context.Context, carrier Carrier) context.Context {
+	if len(carrier) == 0 {
+		return ctx
+	}
+	return tracer.Extract(ctx, carrier)
+}
+
+func Shutdown(ctx context.Context) error {
+	return tracer.Shutdown(ctx)
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestTracer(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	previous := tracer
+	SetTracer(NewOtelTracer(provider))
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+		SetTracer(previous)
+	})
+	return exporter
+}
+
+func TestStartSpanNestsUnderTransaction(t *testing.T) {
+	exporter := newTestTracer(t)
+
+	tx, ctx := StartTransaction(context.Background(), "Send Message", "websocket")
+	span, _ := StartSpan(ctx, "InsertNewMessage", "repository")
+	span.RecordError(errors.New("boom"))
+	span.End()
+	tx.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	child, root := spans[0], spans[1]
+	if child.Name != "InsertNewMessage" || root.Name != "Send Message" {
+		t.Fatalf("unexpected span names %q, %q", child.Name, root.Name)
+	}
+	if child.Parent.SpanID() != root.SpanContext.SpanID() {
+		t.Errorf("span is not a child of the transaction")
+	}
+	if child.Status.Code != codes.Error {
+		t.Errorf("expected error status, got %v", child.Status.Code)
+	}
+}
+
+func TestInjectExtractContinuesTrace(t *testing.T) {
+	exporter := newTestTracer(t)
+
+	tx, ctx := StartTransaction(context.Background(), "Send Message", "websocket")
+	carrier := Inject(ctx)
+	tx.End()
+
+	if carrier[traceparentHeader] == "" {
+		t.Fatalf("expected a traceparent in the carrier, got %v", carrier)
+	}
+
+	delivery, _ := StartTransaction(Extract(context.Background(), carrier), "Deliver Message", "websocket")
+	delivery.End()
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	if spans[0].SpanContext.TraceID() != spans[1].SpanContext.TraceID() {
+		t.Errorf("delivery did not continue the sender's trace")
+	}
+	if spans[1].Parent.SpanID() != spans[0].SpanContext.SpanID() {
+		t.Errorf("delivery is not parented to the sender's transaction")
+	}
+}
+
+func TestExtractWithoutCarrierKeepsContext(t *testing.T) {
+	ctx := context.Background()
+	if Extract(ctx, nil) != ctx {
+		t.Errorf("expected the context to be returned unchanged")
+	}
+}